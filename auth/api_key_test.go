@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiKeyRepository keeps API keys in memory
+type apiKeyRepository struct {
+	Repository
+	apiKeys []APIKey
+}
+
+func (r *apiKeyRepository) SaveAPIKey(apiKey APIKey) (APIKey, error) {
+	apiKey.ID = len(r.apiKeys) + 1
+	r.apiKeys = append(r.apiKeys, apiKey)
+
+	return apiKey, nil
+}
+
+func (r *apiKeyRepository) FindAPIKeyByHash(keyHash string) (APIKey, error) {
+	for _, apiKey := range r.apiKeys {
+		if apiKey.KeyHash == keyHash {
+			return apiKey, nil
+		}
+	}
+
+	return APIKey{}, nil
+}
+
+func (r *apiKeyRepository) TouchAPIKey(apiKey APIKey, usedAt time.Time) error {
+	r.apiKeys[apiKey.ID-1].LastUsedAt = &usedAt
+
+	return nil
+}
+
+func TestCreateAPIKeyScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string
+		wantScopes []string
+		wantErr    error
+	}{
+		{"no scopes", nil, []string{}, nil},
+		{"valid scopes", []string{ScopeCampaignsRead, ScopeTransactionsWrite}, []string{ScopeCampaignsRead, ScopeTransactionsWrite}, nil},
+		{"repeated scope", []string{ScopeCampaignsRead, ScopeCampaignsRead}, []string{ScopeCampaignsRead}, nil},
+		{"unknown scope", []string{ScopeCampaignsRead, "users:write"}, nil, ErrInvalidScope},
+	}
+
+	for _, tt := range tests {
+		repository := &apiKeyRepository{}
+		s := NewService(repository, roleFinder{})
+
+		apiKey, key, err := s.CreateAPIKey(7, CreateAPIKeyInput{Name: "script", Scopes: tt.scopes})
+
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: CreateAPIKey returned %v, want %v", tt.name, err, tt.wantErr)
+
+			continue
+		}
+
+		if tt.wantErr != nil {
+			if len(repository.apiKeys) != 0 {
+				t.Errorf("%s: stored a key with an invalid scope", tt.name)
+			}
+
+			continue
+		}
+
+		if !reflect.DeepEqual(apiKey.ScopeList(), tt.wantScopes) {
+			t.Errorf("%s: key has scopes %v, want %v", tt.name, apiKey.ScopeList(), tt.wantScopes)
+		}
+
+		if !strings.HasPrefix(key, apiKey.Prefix+"_") || apiKey.KeyHash == key || strings.Contains(apiKey.KeyHash, key) {
+			t.Errorf("%s: key %s doesn't start with its prefix %s or is stored in plain text", tt.name, key, apiKey.Prefix)
+		}
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	repository := &apiKeyRepository{}
+	s := NewService(repository, roleFinder{})
+
+	activeKey := func(scopes ...string) string {
+		_, key, err := s.CreateAPIKey(7, CreateAPIKeyInput{Name: "script", Scopes: scopes})
+
+		if err != nil {
+			t.Fatalf("CreateAPIKey returned error: %v", err)
+		}
+
+		return key
+	}
+
+	validKey := activeKey(ScopeCampaignsRead)
+	revokedKey := activeKey(ScopeCampaignsRead)
+	expiredKey := activeKey(ScopeCampaignsRead)
+
+	now := time.Now()
+	repository.apiKeys[1].RevokedAt = &now
+	repository.apiKeys[2].ExpiresAt = &now
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{"active key", validKey, nil},
+		{"revoked key", revokedKey, ErrInvalidAPIKey},
+		{"expired key", expiredKey, ErrInvalidAPIKey},
+		{"unknown key", APIKeyPrefix + "unknown_key", ErrInvalidAPIKey},
+		{"access token", "eyJhbGciOiJIUzI1NiJ9.e30.signature", ErrInvalidAPIKey},
+	}
+
+	for _, tt := range tests {
+		apiKey, err := s.AuthenticateAPIKey(tt.key)
+
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: AuthenticateAPIKey returned %v, want %v", tt.name, err, tt.wantErr)
+
+			continue
+		}
+
+		if tt.wantErr == nil && (apiKey.UserID != 7 || apiKey.LastUsedAt == nil) {
+			t.Errorf("%s: AuthenticateAPIKey = %+v, want the key of user 7 with its last use recorded", tt.name, apiKey)
+		}
+	}
+}
+
+func TestAPIKeyHasScope(t *testing.T) {
+	apiKey := APIKey{Scopes: ScopeCampaignsRead + "," + ScopeTransactionsRead}
+
+	tests := []struct {
+		scopes []string
+		want   bool
+	}{
+		{nil, true},
+		{[]string{ScopeCampaignsRead}, true},
+		{[]string{ScopeCampaignsRead, ScopeTransactionsRead}, true},
+		{[]string{ScopeCampaignsWrite}, false},
+		{[]string{ScopeCampaignsRead, ScopeCampaignsWrite}, false},
+	}
+
+	for _, tt := range tests {
+		if got := apiKey.HasScope(tt.scopes...); got != tt.want {
+			t.Errorf("HasScope(%v) = %v, want %v", tt.scopes, got, tt.want)
+		}
+	}
+
+	if (APIKey{}).HasScope(ScopeCampaignsRead) {
+		t.Error("a key without scopes has campaigns:read")
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"strings"
+	"time"
+)
+
+// RefreshToken is stored hashed, every refresh rotates it within the same family so a stolen token can be detected
+type RefreshToken struct {
+	ID             int
+	UserID         int
+	FamilyID       string
+	TokenHash      string
+	AccessTokenJTI string
+	ExpiresAt      time.Time
+	RevokedAt      *time.Time
+	ReplacedByID   *int
+	CreatedAt      time.Time
+}
+
+// RevokedToken blocks an access token until it would have expired anyway
+type RevokedToken struct {
+	JTI       string `gorm:"primaryKey"`
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type TokenPair struct {
+	AccessToken          string
+	AccessTokenExpiresAt time.Time
+	RefreshToken         string
+}
+
+// AccessClaims are the claims of a validated access token, set on the request by the authorize middleware.
+// Roles are informative, permission checks use the roles of the user loaded from the database
+type AccessClaims struct {
+	UserID    int
+	Roles     []string
+	TokenID   string
+	FamilyID  string
+	ExpiresAt time.Time
+}
+
+// APIKey is a long lived credential for scripts, only its hash is stored and the key is shown once when created
+type APIKey struct {
+	ID         int
+	UserID     int
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     string
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// ScopeList returns the scopes the key was granted, they are stored comma separated
+func (k APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+
+	return strings.Split(k.Scopes, ",")
+}
+
+// HasScope reports whether the key was granted every one of the scopes
+func (k APIKey) HasScope(scopes ...string) bool {
+	for _, scope := range scopes {
+		granted := false
+
+		for _, keyScope := range k.ScopeList() {
+			if keyScope == scope {
+				granted = true
+
+				break
+			}
+		}
+
+		if !granted {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (k APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+
+	return k.ExpiresAt == nil || k.ExpiresAt.After(now)
+}
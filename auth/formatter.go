@@ -0,0 +1,40 @@
+package auth
+
+import "time"
+
+type APIKeyFormat struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Key        string     `json:"key,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// FormatAPIKey includes the plain key only right after it is created, pass an empty key otherwise
+func FormatAPIKey(apiKey APIKey, key string) APIKeyFormat {
+	return APIKeyFormat{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.ScopeList(),
+		Key:        key,
+		LastUsedAt: apiKey.LastUsedAt,
+		ExpiresAt:  apiKey.ExpiresAt,
+		RevokedAt:  apiKey.RevokedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
+
+func FormatAPIKeys(apiKeys []APIKey) []APIKeyFormat {
+	apiKeysFormat := []APIKeyFormat{}
+
+	for _, apiKey := range apiKeys {
+		apiKeysFormat = append(apiKeysFormat, FormatAPIKey(apiKey, ""))
+	}
+
+	return apiKeysFormat
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	SaveRefreshToken(refreshToken RefreshToken) (RefreshToken, error)
+	FindRefreshTokenByHash(tokenHash string) (RefreshToken, error)
+	RotateRefreshToken(oldToken RefreshToken, newToken RefreshToken) (RefreshToken, error)
+	RevokeFamily(familyID string) error
+	RevokeAllByUserID(userID int) error
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+	SaveAPIKey(apiKey APIKey) (APIKey, error)
+	FindAPIKeyByHash(keyHash string) (APIKey, error)
+	FindAPIKeysByUserID(userID int) ([]APIKey, error)
+	FindAPIKeyByID(ID int) (APIKey, error)
+	RevokeAPIKey(apiKey APIKey) (APIKey, error)
+	RevokeAPIKeysByUserID(userID int) error
+	TouchAPIKey(apiKey APIKey, usedAt time.Time) error
+}
+
+var errRefreshTokenAlreadyUsed = errors.New("Refresh token has already been used.")
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db}
+}
+
+func (r *repository) SaveRefreshToken(refreshToken RefreshToken) (RefreshToken, error) {
+	err := r.db.Create(&refreshToken).Error
+
+	if err != nil {
+		return refreshToken, err
+	}
+
+	return refreshToken, nil
+}
+
+func (r *repository) FindRefreshTokenByHash(tokenHash string) (RefreshToken, error) {
+	var refreshToken RefreshToken
+
+	err := r.db.Where("token_hash = ?", tokenHash).Find(&refreshToken).Error
+
+	if err != nil {
+		return refreshToken, err
+	}
+
+	return refreshToken, nil
+}
+
+func (r *repository) RotateRefreshToken(oldToken RefreshToken, newToken RefreshToken) (RefreshToken, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Only one of two concurrent refreshes with the same token can win, the other one is treated as reuse
+		result := tx.Model(&RefreshToken{}).Where("id = ? AND revoked_at IS NULL", oldToken.ID).Update("revoked_at", now)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errRefreshTokenAlreadyUsed
+		}
+
+		if err := tx.Create(&newToken).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&RefreshToken{}).Where("id = ?", oldToken.ID).Update("replaced_by_id", newToken.ID).Error; err != nil {
+			return err
+		}
+
+		// The access token issued with the old refresh token is superseded as well
+		return revokeAccessTokens(tx, []RefreshToken{oldToken})
+	})
+
+	if err != nil {
+		return newToken, err
+	}
+
+	return newToken, nil
+}
+
+func (r *repository) RevokeFamily(familyID string) error {
+	return r.revokeWhere("family_id = ?", familyID)
+}
+
+func (r *repository) RevokeAllByUserID(userID int) error {
+	return r.revokeWhere("user_id = ?", userID)
+}
+
+// revokeWhere revokes the active refresh tokens matching the condition together with the access tokens issued with them
+func (r *repository) revokeWhere(query string, args ...interface{}) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var activeTokens []RefreshToken
+
+		err := tx.Where(query, args...).Where("revoked_at IS NULL").Find(&activeTokens).Error
+
+		if err != nil || len(activeTokens) == 0 {
+			return err
+		}
+
+		ids := []int{}
+
+		for _, activeToken := range activeTokens {
+			ids = append(ids, activeToken.ID)
+		}
+
+		if err := tx.Model(&RefreshToken{}).Where("id IN ?", ids).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return revokeAccessTokens(tx, activeTokens)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func revokeAccessTokens(tx *gorm.DB, refreshTokens []RefreshToken) error {
+	revokedTokens := []RevokedToken{}
+
+	for _, refreshToken := range refreshTokens {
+		if refreshToken.AccessTokenJTI == "" {
+			continue
+		}
+
+		revokedTokens = append(revokedTokens, RevokedToken{
+			JTI:       refreshToken.AccessTokenJTI,
+			ExpiresAt: refreshToken.CreatedAt.Add(accessTokenTTL()),
+			CreatedAt: time.Now(),
+		})
+	}
+
+	if len(revokedTokens) == 0 {
+		return nil
+	}
+
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&revokedTokens).Error
+}
+
+func (r *repository) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	revokedToken := RevokedToken{JTI: jti, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revokedToken).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) IsAccessTokenRevoked(jti string) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *repository) SaveAPIKey(apiKey APIKey) (APIKey, error) {
+	err := r.db.Create(&apiKey).Error
+
+	if err != nil {
+		return apiKey, err
+	}
+
+	return apiKey, nil
+}
+
+func (r *repository) FindAPIKeyByHash(keyHash string) (APIKey, error) {
+	var apiKey APIKey
+
+	err := r.db.Where("key_hash = ?", keyHash).Find(&apiKey).Error
+
+	if err != nil {
+		return apiKey, err
+	}
+
+	return apiKey, nil
+}
+
+func (r *repository) FindAPIKeysByUserID(userID int) ([]APIKey, error) {
+	var apiKeys []APIKey
+
+	err := r.db.Where("user_id = ?", userID).Order("created_at desc").Find(&apiKeys).Error
+
+	if err != nil {
+		return apiKeys, err
+	}
+
+	return apiKeys, nil
+}
+
+func (r *repository) FindAPIKeyByID(ID int) (APIKey, error) {
+	var apiKey APIKey
+
+	err := r.db.Where("id = ?", ID).Find(&apiKey).Error
+
+	if err != nil {
+		return apiKey, err
+	}
+
+	return apiKey, nil
+}
+
+func (r *repository) RevokeAPIKey(apiKey APIKey) (APIKey, error) {
+	now := time.Now()
+
+	err := r.db.Model(&APIKey{}).Where("id = ? AND revoked_at IS NULL", apiKey.ID).Update("revoked_at", now).Error
+
+	if err != nil {
+		return apiKey, err
+	}
+
+	if apiKey.RevokedAt == nil {
+		apiKey.RevokedAt = &now
+	}
+
+	return apiKey, nil
+}
+
+func (r *repository) RevokeAPIKeysByUserID(userID int) error {
+	err := r.db.Model(&APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now()).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) TouchAPIKey(apiKey APIKey, usedAt time.Time) error {
+	err := r.db.Model(&APIKey{}).Where("id = ?", apiKey.ID).Update("last_used_at", usedAt).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
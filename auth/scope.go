@@ -0,0 +1,21 @@
+package auth
+
+// Scopes an API key can be granted, routes that don't declare any scope only accept access tokens
+const (
+	ScopeCampaignsRead     = "campaigns:read"
+	ScopeCampaignsWrite    = "campaigns:write"
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+)
+
+var scopes = []string{ScopeCampaignsRead, ScopeCampaignsWrite, ScopeTransactionsRead, ScopeTransactionsWrite}
+
+func IsValidScope(scope string) bool {
+	for _, validScope := range scopes {
+		if validScope == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,32 +1,124 @@
 package auth
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/dchest/uniuri"
 	"github.com/dgrijalva/jwt-go"
 )
 
 type Service interface {
-	GenerateToken(userID int) (string, error)
+	GenerateToken(userID int) (TokenPair, error)
 	ValidateToken(token string) (*jwt.Token, error)
+	GetAccessClaims(token *jwt.Token) (AccessClaims, error)
+	IsTokenRevoked(claims AccessClaims) (bool, error)
+	RefreshToken(refreshToken string) (TokenPair, int, error)
+	Logout(claims AccessClaims) error
+	LogoutAll(userID int) error
+	GenerateChallengeToken(userID int) (string, error)
+	ValidateChallengeToken(challengeToken string) (int, error)
+	CreateAPIKey(userID int, input CreateAPIKeyInput) (APIKey, string, error)
+	GetAPIKeys(userID int) ([]APIKey, error)
+	GetAPIKeyByID(ID int) (APIKey, error)
+	RevokeAPIKey(apiKey APIKey) (APIKey, error)
+	RevokeAllAPIKeys(userID int) error
+	AuthenticateAPIKey(key string) (APIKey, error)
 }
 
-type service struct{}
+var ErrInvalidRefreshToken = errors.New("Invalid refresh token")
+var ErrInvalidChallengeToken = errors.New("Invalid or expired challenge token")
+var ErrInvalidAPIKey = errors.New("Invalid, expired or revoked API key")
+var ErrInvalidScope = errors.New("Invalid scope")
+
+// APIKeyPrefix starts every API key so the authorize middleware can tell them apart from access tokens
+const APIKeyPrefix = "bwa_"
+
+// apiKeyTouchInterval limits how often last_used_at is written for a busy key
+const apiKeyTouchInterval = time.Minute
+
+// challengePurpose marks tokens that only prove the password was right, they can't be used as access tokens
+const challengePurpose = "2fa"
+
+// challengeTokenTTL is how long the user has to enter the code from their authenticator
+const challengeTokenTTL = 5 * time.Minute
+
+// RoleFinder looks up the roles put in the access token, user.Service implements it
+type RoleFinder interface {
+	GetUserRoles(userID int) ([]string, error)
+}
+
+type service struct {
+	repository Repository
+	roleFinder RoleFinder
+}
 
 var SECRET_KEY []byte = []byte(os.Getenv("JWT_SECRET_KEY"))
 
-func NewService() Service {
-	return &service{}
+func NewService(repository Repository, roleFinder RoleFinder) Service {
+	return &service{repository, roleFinder}
+}
+
+// accessTokenTTL is kept short since access tokens are checked against the revocation list only, defaults to 15 minutes
+func accessTokenTTL() time.Duration {
+	return durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// refreshTokenTTL defaults to 30 days
+func refreshTokenTTL() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(key))
+
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+
+	return duration
+}
+
+// hashToken is used for refresh tokens and API keys, both are long random strings so a fast hash is enough
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// GenerateToken starts a new session, i.e. a new refresh token family
+func (s *service) GenerateToken(userID int) (TokenPair, error) {
+	return s.issueTokenPair(userID, uniuri.NewLen(32), nil)
 }
 
-func (s *service) GenerateToken(userID int) (string, error) {
-	// Mapping claims (userID, iat)
+// issueTokenPair signs an access token and stores its refresh token, rotating oldToken out of the family if given
+func (s *service) issueTokenPair(userID int, familyID string, oldToken *RefreshToken) (TokenPair, error) {
+	var tokenPair TokenPair
+
+	// Roles are read on every issue so granted or revoked roles show up on the next refresh
+	roles, err := s.roleFinder.GetUserRoles(userID)
+
+	if err != nil {
+		return tokenPair, err
+	}
+
+	now := time.Now()
+	jti := uniuri.NewLen(32)
+	tokenPair.AccessTokenExpiresAt = now.Add(accessTokenTTL())
+
+	// Mapping claims (userID, iat, jti, fid, roles)
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
-		"iat":     time.Now(),
+		"roles":   roles,
+		"exp":     tokenPair.AccessTokenExpiresAt.Unix(),
+		"iat":     now.Unix(),
+		"jti":     jti,
+		"fid":     familyID,
 	}
 
 	// Generate token with claims
@@ -36,11 +128,32 @@ func (s *service) GenerateToken(userID int) (string, error) {
 	signedToken, err := token.SignedString(SECRET_KEY)
 
 	if err != nil {
-		return signedToken, err
+		return tokenPair, err
 	}
 
-	// Return signed token
-	return signedToken, nil
+	tokenPair.AccessToken = signedToken
+	tokenPair.RefreshToken = uniuri.NewLen(64)
+
+	refreshToken := RefreshToken{
+		UserID:         userID,
+		FamilyID:       familyID,
+		TokenHash:      hashToken(tokenPair.RefreshToken),
+		AccessTokenJTI: jti,
+		ExpiresAt:      now.Add(refreshTokenTTL()),
+		CreatedAt:      now,
+	}
+
+	if oldToken == nil {
+		_, err = s.repository.SaveRefreshToken(refreshToken)
+	} else {
+		_, err = s.repository.RotateRefreshToken(*oldToken, refreshToken)
+	}
+
+	if err != nil {
+		return tokenPair, err
+	}
+
+	return tokenPair, nil
 }
 
 func (s *service) ValidateToken(accessToken string) (*jwt.Token, error) {
@@ -70,3 +183,269 @@ func (s *service) ValidateToken(accessToken string) (*jwt.Token, error) {
 
 	return token, nil
 }
+
+func (s *service) GetAccessClaims(token *jwt.Token) (AccessClaims, error) {
+	var accessClaims AccessClaims
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+
+	if !ok {
+		return accessClaims, errors.New("Invalid access token claims.")
+	}
+
+	userID, _ := claims["user_id"].(float64)
+	jti, _ := claims["jti"].(string)
+	familyID, _ := claims["fid"].(string)
+	exp, _ := claims["exp"].(float64)
+
+	// Tokens issued before revocation existed have no jti, they can't be logged out so they aren't accepted anymore
+	if userID <= 0 || jti == "" || claims["purpose"] != nil {
+		return accessClaims, errors.New("Invalid access token claims.")
+	}
+
+	roles := []string{}
+	roleClaims, _ := claims["roles"].([]interface{})
+
+	for _, roleClaim := range roleClaims {
+		if role, ok := roleClaim.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+
+	accessClaims = AccessClaims{
+		UserID:    int(userID),
+		Roles:     roles,
+		TokenID:   jti,
+		FamilyID:  familyID,
+		ExpiresAt: time.Unix(int64(exp), 0),
+	}
+
+	return accessClaims, nil
+}
+
+func (s *service) IsTokenRevoked(claims AccessClaims) (bool, error) {
+	isRevoked, err := s.repository.IsAccessTokenRevoked(claims.TokenID)
+
+	if err != nil {
+		return isRevoked, err
+	}
+
+	return isRevoked, nil
+}
+
+// RefreshToken trades a refresh token for a new token pair and returns the ID of the user it belongs to
+func (s *service) RefreshToken(refreshToken string) (TokenPair, int, error) {
+	foundToken, err := s.repository.FindRefreshTokenByHash(hashToken(refreshToken))
+
+	if err != nil {
+		return TokenPair{}, 0, err
+	}
+
+	if foundToken.ID <= 0 {
+		return TokenPair{}, 0, ErrInvalidRefreshToken
+	}
+
+	// A rotated token being used again means it was copied, end the whole session for both holders
+	if foundToken.RevokedAt != nil {
+		if err := s.repository.RevokeFamily(foundToken.FamilyID); err != nil {
+			return TokenPair{}, 0, err
+		}
+
+		return TokenPair{}, 0, fmt.Errorf("%w, token reuse detected", ErrInvalidRefreshToken)
+	}
+
+	if !time.Now().Before(foundToken.ExpiresAt) {
+		return TokenPair{}, 0, fmt.Errorf("%w, token has expired", ErrInvalidRefreshToken)
+	}
+
+	tokenPair, err := s.issueTokenPair(foundToken.UserID, foundToken.FamilyID, &foundToken)
+
+	if errors.Is(err, errRefreshTokenAlreadyUsed) {
+		if err := s.repository.RevokeFamily(foundToken.FamilyID); err != nil {
+			return TokenPair{}, 0, err
+		}
+
+		return TokenPair{}, 0, fmt.Errorf("%w, token reuse detected", ErrInvalidRefreshToken)
+	}
+
+	if err != nil {
+		return tokenPair, 0, err
+	}
+
+	return tokenPair, foundToken.UserID, nil
+}
+
+// Logout ends the session the access token belongs to
+func (s *service) Logout(claims AccessClaims) error {
+	if err := s.repository.RevokeAccessToken(claims.TokenID, claims.ExpiresAt); err != nil {
+		return err
+	}
+
+	if err := s.repository.RevokeFamily(claims.FamilyID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LogoutAll ends every session of the user
+func (s *service) LogoutAll(userID int) error {
+	err := s.repository.RevokeAllByUserID(userID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GenerateChallengeToken is handed out after the password check when the user has two-factor authentication enabled
+func (s *service) GenerateChallengeToken(userID int) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"purpose": challengePurpose,
+		"exp":     time.Now().Add(challengeTokenTTL).Unix(),
+		"iat":     time.Now().Unix(),
+	}
+
+	signedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(SECRET_KEY)
+
+	if err != nil {
+		return signedToken, err
+	}
+
+	return signedToken, nil
+}
+
+// ValidateChallengeToken returns the ID of the user the challenge was issued to
+func (s *service) ValidateChallengeToken(challengeToken string) (int, error) {
+	token, err := s.ValidateToken(challengeToken)
+
+	if err != nil || !token.Valid {
+		return 0, ErrInvalidChallengeToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+
+	if !ok || claims["purpose"] != challengePurpose {
+		return 0, ErrInvalidChallengeToken
+	}
+
+	userID, _ := claims["user_id"].(float64)
+
+	if userID <= 0 {
+		return 0, ErrInvalidChallengeToken
+	}
+
+	return int(userID), nil
+}
+
+// CreateAPIKey returns the stored key together with the plain key, which can't be recovered afterwards
+func (s *service) CreateAPIKey(userID int, input CreateAPIKeyInput) (APIKey, string, error) {
+	grantedScopes := []string{}
+	seen := map[string]bool{}
+
+	for _, scope := range input.Scopes {
+		if !IsValidScope(scope) {
+			return APIKey{}, "", fmt.Errorf("%w, %s", ErrInvalidScope, scope)
+		}
+
+		if !seen[scope] {
+			grantedScopes = append(grantedScopes, scope)
+			seen[scope] = true
+		}
+	}
+
+	prefix := uniuri.NewLenChars(8, []byte("abcdefghijklmnopqrstuvwxyz0123456789"))
+	key := APIKeyPrefix + prefix + "_" + uniuri.NewLen(40)
+
+	apiKey := APIKey{
+		UserID:    userID,
+		Name:      input.Name,
+		Prefix:    APIKeyPrefix + prefix,
+		KeyHash:   hashToken(key),
+		Scopes:    strings.Join(grantedScopes, ","),
+		CreatedAt: time.Now(),
+	}
+
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	savedAPIKey, err := s.repository.SaveAPIKey(apiKey)
+
+	if err != nil {
+		return savedAPIKey, "", err
+	}
+
+	return savedAPIKey, key, nil
+}
+
+func (s *service) GetAPIKeys(userID int) ([]APIKey, error) {
+	apiKeys, err := s.repository.FindAPIKeysByUserID(userID)
+
+	if err != nil {
+		return apiKeys, err
+	}
+
+	return apiKeys, nil
+}
+
+func (s *service) GetAPIKeyByID(ID int) (APIKey, error) {
+	apiKey, err := s.repository.FindAPIKeyByID(ID)
+
+	if err != nil {
+		return apiKey, err
+	}
+
+	return apiKey, nil
+}
+
+func (s *service) RevokeAPIKey(apiKey APIKey) (APIKey, error) {
+	revokedAPIKey, err := s.repository.RevokeAPIKey(apiKey)
+
+	if err != nil {
+		return revokedAPIKey, err
+	}
+
+	return revokedAPIKey, nil
+}
+
+func (s *service) RevokeAllAPIKeys(userID int) error {
+	err := s.repository.RevokeAPIKeysByUserID(userID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey looks the key up by its hash and records when it was last used
+func (s *service) AuthenticateAPIKey(key string) (APIKey, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.repository.FindAPIKeyByHash(hashToken(key))
+
+	if err != nil {
+		return apiKey, err
+	}
+
+	now := time.Now()
+
+	if apiKey.ID <= 0 || !apiKey.IsActive(now) {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		// Failing to record the usage shouldn't fail the request
+		if err := s.repository.TouchAPIKey(apiKey, now); err == nil {
+			apiKey.LastUsedAt = &now
+		}
+	}
+
+	return apiKey, nil
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type roleFinder struct{}
+
+func (roleFinder) GetUserRoles(userID int) ([]string, error) {
+	return []string{"user"}, nil
+}
+
+// tokenRepository keeps refresh tokens and revoked access tokens in memory the way the database does
+type tokenRepository struct {
+	Repository
+	refreshTokens []RefreshToken
+	revokedJTIs   map[string]bool
+	// rotateErr is returned by the next rotation, e.g. when a concurrent refresh won the race
+	rotateErr error
+}
+
+func newTokenRepository() *tokenRepository {
+	return &tokenRepository{revokedJTIs: map[string]bool{}}
+}
+
+func (r *tokenRepository) SaveRefreshToken(refreshToken RefreshToken) (RefreshToken, error) {
+	refreshToken.ID = len(r.refreshTokens) + 1
+	r.refreshTokens = append(r.refreshTokens, refreshToken)
+
+	return refreshToken, nil
+}
+
+func (r *tokenRepository) FindRefreshTokenByHash(tokenHash string) (RefreshToken, error) {
+	for _, refreshToken := range r.refreshTokens {
+		if refreshToken.TokenHash == tokenHash {
+			return refreshToken, nil
+		}
+	}
+
+	return RefreshToken{}, nil
+}
+
+func (r *tokenRepository) RotateRefreshToken(oldToken RefreshToken, newToken RefreshToken) (RefreshToken, error) {
+	if r.rotateErr != nil {
+		err := r.rotateErr
+		r.rotateErr = nil
+
+		return newToken, err
+	}
+
+	now := time.Now()
+	r.refreshTokens[oldToken.ID-1].RevokedAt = &now
+	r.revokedJTIs[oldToken.AccessTokenJTI] = true
+
+	return r.SaveRefreshToken(newToken)
+}
+
+func (r *tokenRepository) RevokeFamily(familyID string) error {
+	now := time.Now()
+
+	for i, refreshToken := range r.refreshTokens {
+		if refreshToken.FamilyID == familyID && refreshToken.RevokedAt == nil {
+			r.refreshTokens[i].RevokedAt = &now
+			r.revokedJTIs[refreshToken.AccessTokenJTI] = true
+		}
+	}
+
+	return nil
+}
+
+func (r *tokenRepository) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	r.revokedJTIs[jti] = true
+
+	return nil
+}
+
+func (r *tokenRepository) IsAccessTokenRevoked(jti string) (bool, error) {
+	return r.revokedJTIs[jti], nil
+}
+
+func accessClaims(t *testing.T, s Service, accessToken string) AccessClaims {
+	token, err := s.ValidateToken(accessToken)
+
+	if err != nil || !token.Valid {
+		t.Fatalf("ValidateToken returned error: %v", err)
+	}
+
+	claims, err := s.GetAccessClaims(token)
+
+	if err != nil {
+		t.Fatalf("GetAccessClaims returned error: %v", err)
+	}
+
+	return claims
+}
+
+func isRevoked(t *testing.T, s Service, accessToken string) bool {
+	revoked, err := s.IsTokenRevoked(accessClaims(t, s, accessToken))
+
+	if err != nil {
+		t.Fatalf("IsTokenRevoked returned error: %v", err)
+	}
+
+	return revoked
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	defer func(secretKey []byte) { SECRET_KEY = secretKey }(SECRET_KEY)
+	SECRET_KEY = []byte("test-secret")
+
+	s := NewService(newTokenRepository(), roleFinder{})
+
+	firstPair, err := s.GenerateToken(7)
+
+	if err != nil {
+		t.Fatalf("GenerateToken returned error: %v", err)
+	}
+
+	secondPair, userID, err := s.RefreshToken(firstPair.RefreshToken)
+
+	if err != nil || userID != 7 {
+		t.Fatalf("RefreshToken = (%d, %v), want user 7", userID, err)
+	}
+
+	if secondPair.RefreshToken == firstPair.RefreshToken {
+		t.Error("RefreshToken handed out the same refresh token again")
+	}
+
+	if accessClaims(t, s, secondPair.AccessToken).FamilyID != accessClaims(t, s, firstPair.AccessToken).FamilyID {
+		t.Error("the rotated token pair belongs to another session")
+	}
+
+	if roles := accessClaims(t, s, secondPair.AccessToken).Roles; !reflect.DeepEqual(roles, []string{"user"}) {
+		t.Errorf("the rotated access token has roles %v, want the current roles of the user", roles)
+	}
+
+	if !isRevoked(t, s, firstPair.AccessToken) {
+		t.Error("the access token of the rotated refresh token is still valid")
+	}
+
+	if isRevoked(t, s, secondPair.AccessToken) {
+		t.Error("the new access token is revoked")
+	}
+
+	thirdPair, _, err := s.RefreshToken(secondPair.RefreshToken)
+
+	if err != nil {
+		t.Fatalf("second RefreshToken returned error: %v", err)
+	}
+
+	// Someone replays the first refresh token, the whole session ends
+	if _, _, err := s.RefreshToken(firstPair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshToken with a rotated token returned %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	if _, _, err := s.RefreshToken(thirdPair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshToken after reuse was detected returned %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	if !isRevoked(t, s, thirdPair.AccessToken) {
+		t.Error("the latest access token is still valid after reuse was detected")
+	}
+}
+
+func TestRefreshTokenConcurrentReuse(t *testing.T) {
+	defer func(secretKey []byte) { SECRET_KEY = secretKey }(SECRET_KEY)
+	SECRET_KEY = []byte("test-secret")
+
+	repository := newTokenRepository()
+	s := NewService(repository, roleFinder{})
+
+	tokenPair, err := s.GenerateToken(7)
+
+	if err != nil {
+		t.Fatalf("GenerateToken returned error: %v", err)
+	}
+
+	// Another refresh with the same token won the race, this one is treated as reuse
+	repository.rotateErr = errRefreshTokenAlreadyUsed
+
+	if _, _, err := s.RefreshToken(tokenPair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshToken that lost the race returned %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	if !isRevoked(t, s, tokenPair.AccessToken) {
+		t.Error("the session is still valid after reuse was detected")
+	}
+}
+
+func TestRefreshTokenRejectsUnknownAndExpiredTokens(t *testing.T) {
+	defer func(secretKey []byte) { SECRET_KEY = secretKey }(SECRET_KEY)
+	SECRET_KEY = []byte("test-secret")
+
+	repository := newTokenRepository()
+	s := NewService(repository, roleFinder{})
+
+	if _, _, err := s.RefreshToken("unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshToken with an unknown token returned %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	tokenPair, err := s.GenerateToken(7)
+
+	if err != nil {
+		t.Fatalf("GenerateToken returned error: %v", err)
+	}
+
+	repository.refreshTokens[0].ExpiresAt = time.Now().Add(-time.Second)
+
+	if _, _, err := s.RefreshToken(tokenPair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshToken with an expired token returned %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestLogoutEndsTheSession(t *testing.T) {
+	defer func(secretKey []byte) { SECRET_KEY = secretKey }(SECRET_KEY)
+	SECRET_KEY = []byte("test-secret")
+
+	s := NewService(newTokenRepository(), roleFinder{})
+
+	tokenPair, err := s.GenerateToken(7)
+
+	if err != nil {
+		t.Fatalf("GenerateToken returned error: %v", err)
+	}
+
+	if err := s.Logout(accessClaims(t, s, tokenPair.AccessToken)); err != nil {
+		t.Fatalf("Logout returned error: %v", err)
+	}
+
+	if !isRevoked(t, s, tokenPair.AccessToken) {
+		t.Error("the access token is still valid after logging out")
+	}
+
+	if _, _, err := s.RefreshToken(tokenPair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshToken after logging out returned %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
@@ -2,31 +2,120 @@ package campaign
 
 import (
 	"bwastartup/entities/user"
+	"bwastartup/imaging"
 	"time"
 )
 
+const (
+	FundingModelKeepItAll    = "keep_it_all"
+	FundingModelAllOrNothing = "all_or_nothing"
+
+	FundingStatusActive = "active"
+	FundingStatusFunded = "funded"
+	FundingStatusFailed = "failed"
+)
+
 type Campaign struct {
-	ID             int
-	UserID         int
-	Name           string
-	Highlight      string
-	Description    string
-	GoalAmount     int
-	CurrentAmount  int
-	Perks          string
-	BackersCount   int
-	Slug           string
-	CampaignImages []CampaignImage
-	User           user.User
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	ID              int
+	UserID          int
+	Name            string
+	Highlight       string
+	Description     string
+	GoalAmount      int
+	CurrentAmount   int
+	Perks           string
+	BackersCount    int
+	Slug            string
+	FundingModel    string
+	FundingStatus   string
+	Status          string
+	StartsAt        *time.Time
+	EndsAt          *time.Time
+	CampaignImages  []CampaignImage
+	CampaignRewards []CampaignReward
+	User            user.User
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
 
-type CampaignImage struct {
+// IsOpenForPledges tells whether backers can still pledge to the campaign at the given time
+func (c Campaign) IsOpenForPledges(now time.Time) bool {
+	if c.Status != StatusPublished || c.FundingStatus != FundingStatusActive {
+		return false
+	}
+
+	if c.StartsAt != nil && now.Before(*c.StartsAt) {
+		return false
+	}
+
+	if c.EndsAt != nil && !now.Before(*c.EndsAt) {
+		return false
+	}
+
+	return true
+}
+
+// CampaignSlugRedirect keeps a slug a campaign used before it was renamed, so old links still resolve
+type CampaignSlugRedirect struct {
+	ID         int
+	CampaignID int
+	Slug       string
+	CreatedAt  time.Time
+}
+
+// CampaignStatusHistory records every move of a campaign through its lifecycle and who made it
+type CampaignStatusHistory struct {
 	ID         int
 	CampaignID int
-	Filename   string
-	IsCover    bool
+	OldStatus  string
+	NewStatus  string
+	UserID     *int
+	Notes      string
 	CreatedAt  time.Time
-	UpdatedAt  time.Time
+}
+
+type CampaignImage struct {
+	ID                int
+	CampaignID        int
+	Filename          string
+	CardFilename      string
+	ThumbnailFilename string
+	IsCover           bool
+	Position          int
+	UploadFileID      *int
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+func (i CampaignImage) Keys() imaging.Keys {
+	return imaging.Keys{Thumbnail: i.ThumbnailFilename, Card: i.CardFilename, Full: i.Filename}
+}
+
+type CampaignReward struct {
+	ID                  int
+	CampaignID          int
+	Title               string
+	Description         string
+	MinimumAmount       int
+	Quantity            *int
+	ClaimedCount        int
+	EstimatedDeliveryAt *time.Time
+	RequiresShipping    bool
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+// Remaining returns how many more backers can pick the reward, nil means it's unlimited
+func (r CampaignReward) Remaining() *int {
+	if r.Quantity == nil {
+		return nil
+	}
+
+	remaining := *r.Quantity - r.ClaimedCount
+
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &remaining
 }
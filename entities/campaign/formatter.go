@@ -1,22 +1,29 @@
 package campaign
 
 import (
+	"bwastartup/imaging"
+	"bwastartup/storage"
 	"time"
-
-	"github.com/muktiwbw/gdstorage"
 )
 
 type CampaignFormat struct {
 	ID            int                       `json:"id"`
 	Name          string                    `json:"name"`
+	Slug          string                    `json:"slug"`
 	Highlight     string                    `json:"highlight"`
 	Description   string                    `json:"description"`
 	CoverImage    string                    `json:"cover_image"`
 	Images        []CampaignImageFormat     `json:"images"`
+	Rewards       []CampaignRewardFormat    `json:"rewards"`
 	GoalAmount    int                       `json:"goal_amount"`
 	CurrentAmount int                       `json:"current_amount"`
 	BackersCount  int                       `json:"backers_count"`
 	Perks         string                    `json:"perks"`
+	FundingModel  string                    `json:"funding_model"`
+	FundingStatus string                    `json:"funding_status"`
+	Status        string                    `json:"status"`
+	StartsAt      *time.Time                `json:"starts_at"`
+	EndsAt        *time.Time                `json:"ends_at"`
 	User          CampaignUserSnippetFormat `json:"user"`
 	CreatedAt     time.Time                 `json:"created_at"`
 }
@@ -28,15 +35,27 @@ type CampaignUserSnippetFormat struct {
 }
 
 type CampaignThumbnailFormat struct {
-	ID            int       `json:"id"`
-	Name          string    `json:"name"`
-	Highlight     string    `json:"highlight"`
-	Image         string    `json:"image"`
-	GoalAmount    int       `json:"goal_amount"`
-	CurrentAmount int       `json:"current_amount"`
-	BackersCount  int       `json:"backers_count"`
-	UserID        int       `json:"user_id"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID            int                      `json:"id"`
+	Name          string                   `json:"name"`
+	Slug          string                   `json:"slug"`
+	Highlight     string                   `json:"highlight"`
+	Image         string                   `json:"image"`
+	ImageURLs     imaging.RenditionsFormat `json:"image_renditions"`
+	GoalAmount    int                      `json:"goal_amount"`
+	CurrentAmount int                      `json:"current_amount"`
+	BackersCount  int                      `json:"backers_count"`
+	FundingModel  string                   `json:"funding_model"`
+	FundingStatus string                   `json:"funding_status"`
+	Status        string                   `json:"status"`
+	EndsAt        *time.Time               `json:"ends_at"`
+	UserID        int                      `json:"user_id"`
+	CreatedAt     time.Time                `json:"created_at"`
+}
+
+type CampaignSearchResultFormat struct {
+	CampaignThumbnailFormat
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
 }
 
 type CampaignSnippetFormat struct {
@@ -45,9 +64,30 @@ type CampaignSnippetFormat struct {
 	Highlight string `json:"highlight"`
 }
 
+type CampaignStatusHistoryFormat struct {
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	UserID    *int      `json:"user_id"`
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type CampaignImageFormat struct {
-	Filename string `json:"filename"`
-	IsCover  bool   `json:"is_cover"`
+	ID         int                      `json:"id"`
+	Filename   string                   `json:"filename"`
+	IsCover    bool                     `json:"is_cover"`
+	Renditions imaging.RenditionsFormat `json:"renditions"`
+}
+
+type CampaignRewardFormat struct {
+	ID                  int        `json:"id"`
+	Title               string     `json:"title"`
+	Description         string     `json:"description"`
+	MinimumAmount       int        `json:"minimum_amount"`
+	Quantity            *int       `json:"quantity"`
+	Remaining           *int       `json:"remaining"`
+	EstimatedDeliveryAt *time.Time `json:"estimated_delivery_at"`
+	RequiresShipping    bool       `json:"requires_shipping"`
 }
 
 func FormatCampaign(campaign Campaign) CampaignFormat {
@@ -57,27 +97,34 @@ func FormatCampaign(campaign Campaign) CampaignFormat {
 ImageFilterLoop:
 	for _, image := range campaign.CampaignImages {
 		if image.IsCover {
-			coverImage = gdstorage.GetURL(image.Filename)
+			coverImage = storage.URL(image.Filename)
 
 			break ImageFilterLoop
 		}
 	}
 
 	if campaign.User.Avatar != "" {
-		avatar = gdstorage.GetURL(campaign.User.Avatar)
+		avatar = imaging.FormatRenditions(campaign.User.AvatarKeys()).Thumbnail
 	}
 
 	return CampaignFormat{
 		ID:            campaign.ID,
 		Name:          campaign.Name,
+		Slug:          campaign.Slug,
 		Highlight:     campaign.Highlight,
 		Description:   campaign.Description,
 		CoverImage:    coverImage,
 		Images:        FormatCampaignImages(campaign.CampaignImages),
+		Rewards:       FormatCampaignRewards(campaign.CampaignRewards),
 		GoalAmount:    campaign.GoalAmount,
 		CurrentAmount: campaign.CurrentAmount,
 		BackersCount:  campaign.BackersCount,
 		Perks:         campaign.Perks,
+		FundingModel:  campaign.FundingModel,
+		FundingStatus: campaign.FundingStatus,
+		Status:        campaign.Status,
+		StartsAt:      campaign.StartsAt,
+		EndsAt:        campaign.EndsAt,
 		User: CampaignUserSnippetFormat{
 			ID:     campaign.User.ID,
 			Name:   campaign.User.Name,
@@ -88,14 +135,14 @@ ImageFilterLoop:
 }
 
 func FormatCampaignThumbnail(campaign Campaign) CampaignThumbnailFormat {
-	var image string
+	var image imaging.RenditionsFormat
 
 	if len(campaign.CampaignImages) >= 1 {
 
 	ImageFilterLoop:
 		for _, i := range campaign.CampaignImages {
 			if i.IsCover {
-				image = gdstorage.GetURL(i.Filename)
+				image = imaging.FormatRenditions(i.Keys())
 
 				break ImageFilterLoop
 			}
@@ -105,22 +152,86 @@ func FormatCampaignThumbnail(campaign Campaign) CampaignThumbnailFormat {
 	return CampaignThumbnailFormat{
 		ID:            campaign.ID,
 		Name:          campaign.Name,
+		Slug:          campaign.Slug,
 		Highlight:     campaign.Highlight,
-		Image:         image,
+		Image:         image.Card,
+		ImageURLs:     image,
 		GoalAmount:    campaign.GoalAmount,
 		CurrentAmount: campaign.CurrentAmount,
 		BackersCount:  campaign.BackersCount,
+		FundingModel:  campaign.FundingModel,
+		FundingStatus: campaign.FundingStatus,
+		Status:        campaign.Status,
+		EndsAt:        campaign.EndsAt,
 		UserID:        campaign.UserID,
 		CreatedAt:     campaign.CreatedAt,
 	}
 }
 
+func FormatCampaignStatusHistories(histories []CampaignStatusHistory) []CampaignStatusHistoryFormat {
+	formattedHistories := []CampaignStatusHistoryFormat{}
+
+	for _, history := range histories {
+		formattedHistories = append(formattedHistories, CampaignStatusHistoryFormat{
+			OldStatus: history.OldStatus,
+			NewStatus: history.NewStatus,
+			UserID:    history.UserID,
+			Notes:     history.Notes,
+			CreatedAt: history.CreatedAt,
+		})
+	}
+
+	return formattedHistories
+}
+
 func FormatCampaignImages(images []CampaignImage) []CampaignImageFormat {
 	formattedCampaignImages := []CampaignImageFormat{}
 
 	for _, image := range images {
-		formattedCampaignImages = append(formattedCampaignImages, CampaignImageFormat{Filename: gdstorage.GetURL(image.Filename), IsCover: image.IsCover})
+		formattedCampaignImages = append(formattedCampaignImages, CampaignImageFormat{
+			ID:         image.ID,
+			Filename:   storage.URL(image.Filename),
+			IsCover:    image.IsCover,
+			Renditions: imaging.FormatRenditions(image.Keys()),
+		})
 	}
 
 	return formattedCampaignImages
 }
+
+func FormatCampaignReward(reward CampaignReward) CampaignRewardFormat {
+	return CampaignRewardFormat{
+		ID:                  reward.ID,
+		Title:               reward.Title,
+		Description:         reward.Description,
+		MinimumAmount:       reward.MinimumAmount,
+		Quantity:            reward.Quantity,
+		Remaining:           reward.Remaining(),
+		EstimatedDeliveryAt: reward.EstimatedDeliveryAt,
+		RequiresShipping:    reward.RequiresShipping,
+	}
+}
+
+func FormatCampaignRewards(rewards []CampaignReward) []CampaignRewardFormat {
+	formattedCampaignRewards := []CampaignRewardFormat{}
+
+	for _, reward := range rewards {
+		formattedCampaignRewards = append(formattedCampaignRewards, FormatCampaignReward(reward))
+	}
+
+	return formattedCampaignRewards
+}
+
+func FormatCampaignSearchResults(results []SearchResult) []CampaignSearchResultFormat {
+	formattedResults := []CampaignSearchResultFormat{}
+
+	for _, result := range results {
+		formattedResults = append(formattedResults, CampaignSearchResultFormat{
+			CampaignThumbnailFormat: FormatCampaignThumbnail(result.Campaign),
+			Rank:                    result.Rank,
+			Snippet:                 result.Snippet,
+		})
+	}
+
+	return formattedResults
+}
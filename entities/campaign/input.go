@@ -1,25 +1,85 @@
 package campaign
 
+import (
+	"bwastartup/helpers"
+	"time"
+)
+
 type GetCampaignByIDInput struct {
 	ID int `uri:"campaign_id" binding:"required"`
 }
 
+type GetCampaignBySlugInput struct {
+	Slug string `uri:"slug" binding:"required"`
+}
+
+type GetCampaignsInput struct {
+	helpers.PaginationInput
+	Sort             string   `form:"sort" binding:"omitempty,oneof=newest most_funded closest_to_goal ending_soon most_backers"`
+	UserID           int      `form:"user_id" binding:"omitempty,min=1"`
+	Status           string   `form:"status" binding:"omitempty,oneof=active funded failed"`
+	MinProgress      *float64 `form:"min_progress" binding:"omitempty,min=0"`
+	MaxProgress      *float64 `form:"max_progress" binding:"omitempty,min=0"`
+	MinGoal          int      `form:"min_goal" binding:"omitempty,min=0"`
+	MaxGoal          int      `form:"max_goal" binding:"omitempty,min=0"`
+	CampaignStatuses []string `form:"campaign_status" binding:"omitempty,dive,oneof=draft in_review published suspended closed"`
+}
+
+type SearchCampaignsInput struct {
+	helpers.PaginationInput
+	Q string `form:"q" binding:"required"`
+}
+
 type CreateCampaignInput struct {
-	UserID      int
-	Name        string `json:"name" binding:"required"`
-	Highlight   string `json:"highlight" binding:"required"`
-	Description string `json:"description" binding:"required"`
-	GoalAmount  int    `json:"goal_amount" binding:"required"`
-	Perks       string `json:"perks" binding:"required"`
+	UserID       int
+	Name         string     `json:"name" binding:"required"`
+	Highlight    string     `json:"highlight" binding:"required"`
+	Description  string     `json:"description" binding:"required"`
+	GoalAmount   int        `json:"goal_amount" binding:"required"`
+	Perks        string     `json:"perks" binding:"required"`
+	FundingModel string     `json:"funding_model" binding:"omitempty,oneof=keep_it_all all_or_nothing"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
 }
 
 type UpdateCampaignInput struct {
-	ID            int
-	Name          string `json:"name"`
-	Highlight     string `json:"highlight"`
-	Description   string `json:"description"`
-	GoalAmount    int    `json:"goal_amount"`
-	Perks         string `json:"perks"`
-	CurrentAmount int
-	BackersCount  int64
+	ID          int
+	Name        string `json:"name"`
+	Highlight   string `json:"highlight"`
+	Description string `json:"description"`
+	GoalAmount  int    `json:"goal_amount"`
+	Perks       string `json:"perks"`
+}
+
+type UpdateCampaignStatusInput struct {
+	Status string `json:"status" binding:"required,oneof=draft in_review published suspended closed"`
+	Notes  string `json:"notes" binding:"max=2000"`
+}
+
+type GetCampaignImageInput struct {
+	CampaignID int `uri:"campaign_id" binding:"required"`
+	ID         int `uri:"image_id" binding:"required"`
+}
+
+type UpdateCampaignImageInput struct {
+	IsCover *bool `json:"is_cover" binding:"required"`
+}
+
+// ReorderCampaignImagesInput lists every image of the campaign in the new order
+type ReorderCampaignImagesInput struct {
+	ImageIDs []int `json:"image_ids" binding:"required,min=1"`
+}
+
+type GetCampaignRewardInput struct {
+	CampaignID int `uri:"campaign_id" binding:"required"`
+	ID         int `uri:"reward_id" binding:"required"`
+}
+
+type CampaignRewardInput struct {
+	Title               string     `json:"title" binding:"required"`
+	Description         string     `json:"description" binding:"required"`
+	MinimumAmount       int        `json:"minimum_amount" binding:"required,min=1"`
+	Quantity            *int       `json:"quantity" binding:"omitempty,min=1"`
+	EstimatedDeliveryAt *time.Time `json:"estimated_delivery_at"`
+	RequiresShipping    bool       `json:"requires_shipping"`
 }
@@ -0,0 +1,126 @@
+package campaign
+
+import (
+	"bwastartup/entities/user"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusInReview  = "in_review"
+	StatusPublished = "published"
+	StatusSuspended = "suspended"
+	StatusClosed    = "closed"
+)
+
+var ErrInvalidStatusTransition = errors.New("Invalid campaign status transition")
+var ErrForbiddenStatusTransition = errors.New("Not allowed to change the campaign status")
+
+// transitionRule tells who may move a campaign along one edge of the lifecycle
+type transitionRule struct {
+	// owner lets the creator of the campaign take the edge
+	owner bool
+	// permission lets anyone but the creator take the edge when one of their roles grants it
+	permission user.Permission
+	// notesRequired makes staff explain themselves, e.g. why a campaign was rejected or suspended
+	notesRequired bool
+}
+
+// Every status that is missing from this table is final
+var allowedTransitions = map[string]map[string]transitionRule{
+	StatusDraft: {
+		StatusInReview: {owner: true},
+	},
+	StatusInReview: {
+		// The creator withdraws the submission, a moderator rejects it
+		StatusDraft:     {owner: true, permission: user.PermissionModerateCampaigns, notesRequired: true},
+		StatusPublished: {permission: user.PermissionModerateCampaigns},
+	},
+	StatusPublished: {
+		StatusSuspended: {permission: user.PermissionManageCampaigns, notesRequired: true},
+		StatusClosed:    {permission: user.PermissionManageCampaigns},
+	},
+	StatusSuspended: {
+		StatusPublished: {permission: user.PermissionManageCampaigns},
+		StatusClosed:    {permission: user.PermissionManageCampaigns},
+	},
+}
+
+// takeDownTransitions are taken by the platform itself, without an actor, when a campaign has to leave public view
+// and the review queue, e.g. because its creator deleted their account. Drafts and closed campaigns stay as they are
+var takeDownTransitions = map[string]string{
+	StatusInReview:  StatusDraft,
+	StatusPublished: StatusClosed,
+	StatusSuspended: StatusClosed,
+}
+
+// IsVisible tells whether the campaign shows up in public listings, search and detail pages
+func (c Campaign) IsVisible() bool {
+	return isVisibleStatus(c.Status)
+}
+
+// VisibleStatuses narrows the statuses asked for in a public listing down to the visible ones,
+// no statuses at all means every visible one
+func VisibleStatuses(requested []string) []string {
+	if len(requested) == 0 {
+		return visibleStatuses()
+	}
+
+	statuses := []string{}
+
+	for _, status := range requested {
+		if isVisibleStatus(status) {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses
+}
+
+func visibleStatuses() []string {
+	return []string{StatusPublished, StatusClosed}
+}
+
+func isVisibleStatus(status string) bool {
+	for _, visible := range visibleStatuses() {
+		if status == visible {
+			return true
+		}
+	}
+
+	return false
+}
+
+// everPublishedStatuses are the statuses of campaigns that may have taken pledges
+func everPublishedStatuses() []string {
+	return []string{StatusPublished, StatusSuspended, StatusClosed}
+}
+
+func checkTransition(campaign Campaign, to string, actor user.User, notes string) error {
+	rule, ok := allowedTransitions[campaign.Status][to]
+
+	if !ok {
+		return fmt.Errorf("%w from %s to %s", ErrInvalidStatusTransition, campaign.Status, to)
+	}
+
+	// Creators never review their own campaign, even when they are moderators themselves
+	if actor.ID == campaign.UserID {
+		if !rule.owner {
+			return fmt.Errorf("%w, the creator can't move the campaign from %s to %s", ErrForbiddenStatusTransition, campaign.Status, to)
+		}
+
+		return nil
+	}
+
+	if rule.permission == "" || !actor.HasPermission(rule.permission) {
+		return fmt.Errorf("%w from %s to %s", ErrForbiddenStatusTransition, campaign.Status, to)
+	}
+
+	if rule.notesRequired && strings.TrimSpace(notes) == "" {
+		return fmt.Errorf("%w, notes are required to move the campaign from %s to %s", ErrInvalidStatusTransition, campaign.Status, to)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package campaign
+
+import (
+	"bwastartup/entities/user"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCheckTransition(t *testing.T) {
+	defer os.Setenv("TWO_FACTOR_REQUIRED_ROLES", os.Getenv("TWO_FACTOR_REQUIRED_ROLES"))
+	os.Setenv("TWO_FACTOR_REQUIRED_ROLES", "")
+
+	creator := user.User{ID: 1, Role: user.RoleCreator}
+	moderatingCreator := user.User{ID: 1, Role: user.RoleCreator, Roles: []user.UserRole{{Role: user.RoleModerator}}}
+	moderator := user.User{ID: 2, Role: user.RoleUser, Roles: []user.UserRole{{Role: user.RoleModerator}}}
+	admin := user.User{ID: 3, Role: user.RoleAdmin}
+	stranger := user.User{ID: 4, Role: user.RoleUser}
+
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		actor   user.User
+		notes   string
+		wantErr error
+	}{
+		{"creator submits", StatusDraft, StatusInReview, creator, "", nil},
+		{"moderator can't submit for the creator", StatusDraft, StatusInReview, moderator, "", ErrForbiddenStatusTransition},
+		{"creator withdraws without notes", StatusInReview, StatusDraft, creator, "", nil},
+		{"moderator rejects with notes", StatusInReview, StatusDraft, moderator, "Missing reward details", nil},
+		{"moderator rejects without notes", StatusInReview, StatusDraft, moderator, " ", ErrInvalidStatusTransition},
+		{"moderator publishes", StatusInReview, StatusPublished, moderator, "", nil},
+		{"admin publishes", StatusInReview, StatusPublished, admin, "", nil},
+		{"creator can't publish", StatusInReview, StatusPublished, creator, "", ErrForbiddenStatusTransition},
+		{"moderating creator can't publish their own campaign", StatusInReview, StatusPublished, moderatingCreator, "", ErrForbiddenStatusTransition},
+		{"stranger can't publish", StatusInReview, StatusPublished, stranger, "", ErrForbiddenStatusTransition},
+		{"admin suspends with notes", StatusPublished, StatusSuspended, admin, "Reported as fraud", nil},
+		{"admin suspends without notes", StatusPublished, StatusSuspended, admin, "", ErrInvalidStatusTransition},
+		{"moderator can't suspend", StatusPublished, StatusSuspended, moderator, "Reported as fraud", ErrForbiddenStatusTransition},
+		{"admin closes", StatusPublished, StatusClosed, admin, "", nil},
+		{"admin reinstates", StatusSuspended, StatusPublished, admin, "", nil},
+		{"admin closes a suspended campaign", StatusSuspended, StatusClosed, admin, "", nil},
+		{"draft can't be published directly", StatusDraft, StatusPublished, admin, "", ErrInvalidStatusTransition},
+		{"published can't go back to review", StatusPublished, StatusInReview, admin, "", ErrInvalidStatusTransition},
+		{"closed is final", StatusClosed, StatusPublished, admin, "", ErrInvalidStatusTransition},
+		{"same status", StatusPublished, StatusPublished, admin, "", ErrInvalidStatusTransition},
+		{"unknown status", StatusDraft, "archived", creator, "", ErrInvalidStatusTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTransition(Campaign{UserID: creator.ID, Status: tt.from}, tt.to, tt.actor, tt.notes)
+
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("checkTransition from %s to %s returned %v", tt.from, tt.to, err)
+			}
+
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkTransition from %s to %s returned %v, want %v", tt.from, tt.to, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckTransitionRequiresTwoFactorForStaff(t *testing.T) {
+	defer os.Setenv("TWO_FACTOR_REQUIRED_ROLES", os.Getenv("TWO_FACTOR_REQUIRED_ROLES"))
+	os.Setenv("TWO_FACTOR_REQUIRED_ROLES", "admin")
+
+	cmp := Campaign{UserID: 1, Status: StatusPublished}
+	admin := user.User{ID: 3, Role: user.RoleAdmin}
+
+	if err := checkTransition(cmp, StatusClosed, admin, ""); !errors.Is(err, ErrForbiddenStatusTransition) {
+		t.Errorf("admin without two-factor authentication: checkTransition returned %v, want ErrForbiddenStatusTransition", err)
+	}
+
+	enabledAt := time.Now()
+	admin.TwoFactorEnabledAt = &enabledAt
+
+	if err := checkTransition(cmp, StatusClosed, admin, ""); err != nil {
+		t.Errorf("admin with two-factor authentication: checkTransition returned %v", err)
+	}
+}
+
+func TestEveryTransitionHasSomeoneToTakeIt(t *testing.T) {
+	for from, edges := range allowedTransitions {
+		for to, rule := range edges {
+			if !rule.owner && rule.permission == "" {
+				t.Errorf("nobody may move a campaign from %s to %s", from, to)
+			}
+		}
+	}
+}
+
+func TestVisibleStatuses(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested []string
+		want      []string
+	}{
+		{"nothing requested", nil, []string{StatusPublished, StatusClosed}},
+		{"visible status", []string{StatusClosed}, []string{StatusClosed}},
+		{"hidden statuses dropped", []string{StatusDraft, StatusPublished, StatusSuspended, StatusInReview}, []string{StatusPublished}},
+		{"only hidden statuses", []string{StatusDraft}, []string{}},
+	}
+
+	for _, tt := range tests {
+		got := VisibleStatuses(tt.requested)
+
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: VisibleStatuses(%v) = %v, want %v", tt.name, tt.requested, got, tt.want)
+
+			continue
+		}
+
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: VisibleStatuses(%v) = %v, want %v", tt.name, tt.requested, got, tt.want)
+			}
+		}
+	}
+}
@@ -1,33 +1,132 @@
 package campaign
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type Repository interface {
-	All() ([]Campaign, error)
+	All(input GetCampaignsInput) ([]Campaign, int64, error)
+	AllByIDs(campaignIDs []int) ([]Campaign, error)
 	AllByUserID(userID int) ([]Campaign, error)
+	Search(input SearchCampaignsInput) ([]SearchHit, int64, error)
 	Get(campaignID int) (Campaign, error)
+	GetBySlug(slug string) (Campaign, error)
+	GetSlugRedirect(slug string) (CampaignSlugRedirect, error)
+	IsSlugTaken(slug string, campaignID int) (bool, error)
 	Save(campaign Campaign) (Campaign, error)
 	Update(campaign Campaign, newValuesCampaign Campaign) (Campaign, error)
 	Delete(campaign Campaign) error
+	UpdateStatus(campaign Campaign, history CampaignStatusHistory) (Campaign, error)
+	AllStatusHistories(campaignID int) ([]CampaignStatusHistory, error)
 	ResetCampaignImageCover(campaignID int) error
 	SaveCampaignImage(image CampaignImage) (CampaignImage, error)
 	SaveCampaignImages(images []CampaignImage) ([]CampaignImage, error)
+	GetCampaignImage(imageID int) (CampaignImage, error)
+	AllCampaignImages(campaignID int) ([]CampaignImage, error)
+	GetCampaignImageByUploadFileID(uploadFileID int) (CampaignImage, error)
+	AddCampaignImage(image CampaignImage) (CampaignImage, error)
+	UpdateCampaignImageCover(image CampaignImage, isCover bool) (CampaignImage, error)
+	ReorderCampaignImages(campaignID int, imageIDs []int) error
+	DeleteCampaignImage(image CampaignImage) error
+	AllEndedActive(now time.Time) ([]Campaign, error)
+	AllFailedWithFunds() ([]Campaign, error)
+	UpdateFundingStatus(campaign Campaign, status string) (Campaign, error)
+	AllRewards(campaignID int) ([]CampaignReward, error)
+	GetReward(rewardID int) (CampaignReward, error)
+	SaveReward(reward CampaignReward) (CampaignReward, error)
+	UpdateReward(reward CampaignReward) (CampaignReward, error)
+	DeleteReward(reward CampaignReward) error
 }
 
 type repository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	search SearchRepository
+}
+
+func NewRepository(db *gorm.DB, search SearchRepository) Repository {
+	return &repository{db, search}
+}
+
+func (r *repository) All(input GetCampaignsInput) ([]Campaign, int64, error) {
+	var campaigns []Campaign
+	var total int64
+
+	query := r.db.Model(&Campaign{})
+
+	if input.UserID > 0 {
+		query = query.Where("user_id = ?", input.UserID)
+	}
+
+	if input.Status != "" {
+		query = query.Where("funding_status = ?", input.Status)
+	}
+
+	// An empty but non-nil list matches nothing, that's what a public listing asking only for hidden statuses gets
+	if input.CampaignStatuses != nil {
+		query = query.Where("status IN ?", input.CampaignStatuses)
+	}
+
+	// Funding progress is in percent of the goal
+	if input.MinProgress != nil {
+		query = query.Where("current_amount * 100.0 / NULLIF(goal_amount, 0) >= ?", *input.MinProgress)
+	}
+
+	if input.MaxProgress != nil {
+		query = query.Where("current_amount * 100.0 / NULLIF(goal_amount, 0) <= ?", *input.MaxProgress)
+	}
+
+	if input.MinGoal > 0 {
+		query = query.Where("goal_amount >= ?", input.MinGoal)
+	}
+
+	if input.MaxGoal > 0 {
+		query = query.Where("goal_amount <= ?", input.MaxGoal)
+	}
+
+	// A new session lets the filtered query be reused for both the count and the page
+	query = query.Session(&gorm.Session{})
+
+	if err := query.Count(&total).Error; err != nil {
+		return campaigns, total, err
+	}
+
+	err := query.Preload("CampaignImages", "is_cover = true").
+		Order(campaignSortOrder(input.Sort)).
+		Order("id desc").
+		Limit(input.GetLimit()).
+		Offset(input.GetOffset()).
+		Find(&campaigns).Error
+
+	if err != nil {
+		return campaigns, total, err
+	}
+
+	return campaigns, total, nil
 }
 
-func NewRepository(db *gorm.DB) Repository {
-	return &repository{db}
+func campaignSortOrder(sort string) string {
+	switch sort {
+	case "most_funded":
+		return "current_amount desc"
+	case "closest_to_goal":
+		return "GREATEST(goal_amount - current_amount, 0) asc"
+	case "ending_soon":
+		return "ends_at asc nulls last"
+	case "most_backers":
+		return "backers_count desc"
+	}
+
+	return "created_at desc"
 }
 
-func (r *repository) All() ([]Campaign, error) {
+func (r *repository) AllByIDs(campaignIDs []int) ([]Campaign, error) {
 	var campaigns []Campaign
 
-	err := r.db.Preload("CampaignImages", "is_cover = true").Find(&campaigns).Error
+	err := r.db.Where("id IN ?", campaignIDs).Preload("CampaignImages", "is_cover = true").Find(&campaigns).Error
 
 	if err != nil {
 		return campaigns, err
@@ -39,7 +138,7 @@ func (r *repository) All() ([]Campaign, error) {
 func (r *repository) AllByUserID(userID int) ([]Campaign, error) {
 	var campaigns []Campaign
 
-	err := r.db.Preload("CampaignImages", "is_cover = true").Where("user_id = ?", userID).Find(&campaigns).Error
+	err := r.db.Where("user_id = ?", userID).Preload("CampaignImages", func(db *gorm.DB) *gorm.DB { return db.Order("position asc, id asc") }).Preload("CampaignRewards").Order("id asc").Find(&campaigns).Error
 
 	if err != nil {
 		return campaigns, err
@@ -48,10 +147,40 @@ func (r *repository) AllByUserID(userID int) ([]Campaign, error) {
 	return campaigns, nil
 }
 
+func (r *repository) Search(input SearchCampaignsInput) ([]SearchHit, int64, error) {
+	hits, total, err := r.search.Search(input)
+
+	if err != nil {
+		return hits, total, err
+	}
+
+	return hits, total, nil
+}
+
 func (r *repository) Get(campaignID int) (Campaign, error) {
 	var campaign Campaign
 
-	err := r.db.Where("id = ?", campaignID).Preload("CampaignImages").Preload("User").Find(&campaign).Error
+	err := r.db.Where("id = ?", campaignID).
+		Preload("CampaignImages", func(db *gorm.DB) *gorm.DB { return db.Order("position asc, id asc") }).
+		Preload("CampaignRewards", func(db *gorm.DB) *gorm.DB { return db.Order("minimum_amount asc, id asc") }).
+		Preload("User").
+		Find(&campaign).Error
+
+	if err != nil {
+		return campaign, err
+	}
+
+	return campaign, nil
+}
+
+func (r *repository) GetBySlug(slug string) (Campaign, error) {
+	var campaign Campaign
+
+	err := r.db.Where("slug = ?", slug).
+		Preload("CampaignImages", func(db *gorm.DB) *gorm.DB { return db.Order("position asc, id asc") }).
+		Preload("CampaignRewards", func(db *gorm.DB) *gorm.DB { return db.Order("minimum_amount asc, id asc") }).
+		Preload("User").
+		Find(&campaign).Error
 
 	if err != nil {
 		return campaign, err
@@ -60,6 +189,37 @@ func (r *repository) Get(campaignID int) (Campaign, error) {
 	return campaign, nil
 }
 
+func (r *repository) GetSlugRedirect(slug string) (CampaignSlugRedirect, error) {
+	var redirect CampaignSlugRedirect
+
+	err := r.db.Where("slug = ?", slug).Find(&redirect).Error
+
+	if err != nil {
+		return redirect, err
+	}
+
+	return redirect, nil
+}
+
+// IsSlugTaken tells whether another campaign uses the slug, either as its current slug or as one it redirects from
+func (r *repository) IsSlugTaken(slug string, campaignID int) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&Campaign{}).Where("slug = ? AND id <> ?", slug, campaignID).Count(&count).Error
+
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	err = r.db.Model(&CampaignSlugRedirect{}).Where("slug = ? AND campaign_id <> ?", slug, campaignID).Count(&count).Error
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
 func (r *repository) Save(campaign Campaign) (Campaign, error) {
 	err := r.db.Create(&campaign).Error
 
@@ -67,16 +227,42 @@ func (r *repository) Save(campaign Campaign) (Campaign, error) {
 		return campaign, err
 	}
 
+	if err := r.syncSearch(campaign); err != nil {
+		return campaign, err
+	}
+
 	return campaign, nil
 }
 
 func (r *repository) Update(campaign Campaign, newValuesCampaign Campaign) (Campaign, error) {
-	err := r.db.Model(&campaign).Updates(newValuesCampaign).Error
+	oldSlug := campaign.Slug
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&campaign).Updates(newValuesCampaign).Error; err != nil {
+			return err
+		}
+
+		if newValuesCampaign.Slug == "" || newValuesCampaign.Slug == oldSlug {
+			return nil
+		}
+
+		// A campaign renamed back to an earlier name takes its old slug back from the redirects
+		if err := tx.Where("campaign_id = ? AND slug = ?", campaign.ID, newValuesCampaign.Slug).Delete(&CampaignSlugRedirect{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&CampaignSlugRedirect{CampaignID: campaign.ID, Slug: oldSlug, CreatedAt: time.Now()}).Error
+	})
 
 	if err != nil {
 		return campaign, err
 	}
 
+	// Updates copies the changed fields onto campaign, so it holds the current name, highlight and description
+	if err := r.syncSearch(campaign); err != nil {
+		return campaign, err
+	}
+
 	return campaign, nil
 }
 
@@ -87,9 +273,63 @@ func (r *repository) Delete(campaign Campaign) error {
 		return err
 	}
 
+	if err := r.search.Remove(campaign.ID); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+func (r *repository) UpdateStatus(campaign Campaign, history CampaignStatusHistory) (Campaign, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Only move the row if nobody else changed its status in the meantime
+		result := tx.Model(&Campaign{}).
+			Where("id = ? AND status = ?", campaign.ID, history.OldStatus).
+			Updates(map[string]interface{}{"status": history.NewStatus, "updated_at": campaign.UpdatedAt})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w, campaign is no longer %s", ErrInvalidStatusTransition, history.OldStatus)
+		}
+
+		return tx.Create(&history).Error
+	})
+
+	if err != nil {
+		return campaign, err
+	}
+
+	if err := r.syncSearch(campaign); err != nil {
+		return campaign, err
+	}
+
+	return campaign, nil
+}
+
+func (r *repository) AllStatusHistories(campaignID int) ([]CampaignStatusHistory, error) {
+	var histories []CampaignStatusHistory
+
+	err := r.db.Where("campaign_id = ?", campaignID).Order("created_at asc, id asc").Find(&histories).Error
+
+	if err != nil {
+		return histories, err
+	}
+
+	return histories, nil
+}
+
+// syncSearch keeps only the campaigns the public can see in the search index
+func (r *repository) syncSearch(campaign Campaign) error {
+	if campaign.IsVisible() {
+		return r.search.Index(campaign)
+	}
+
+	return r.search.Remove(campaign.ID)
+}
+
 func (r *repository) ResetCampaignImageCover(campaignID int) error {
 	err := r.db.Model(&CampaignImage{}).Where("campaign_id = ?", campaignID).Update("is_cover", false).Error
 
@@ -117,3 +357,250 @@ func (r *repository) SaveCampaignImages(images []CampaignImage) ([]CampaignImage
 
 	return images, nil
 }
+
+func (r *repository) GetCampaignImage(imageID int) (CampaignImage, error) {
+	var image CampaignImage
+
+	err := r.db.Where("id = ?", imageID).Find(&image).Error
+
+	if err != nil {
+		return image, err
+	}
+
+	return image, nil
+}
+
+func (r *repository) AllCampaignImages(campaignID int) ([]CampaignImage, error) {
+	var images []CampaignImage
+
+	err := r.db.Where("campaign_id = ?", campaignID).Order("position asc, id asc").Find(&images).Error
+
+	if err != nil {
+		return images, err
+	}
+
+	return images, nil
+}
+
+func (r *repository) GetCampaignImageByUploadFileID(uploadFileID int) (CampaignImage, error) {
+	var image CampaignImage
+
+	err := r.db.Where("upload_file_id = ?", uploadFileID).Find(&image).Error
+
+	if err != nil {
+		return image, err
+	}
+
+	return image, nil
+}
+
+// AddCampaignImage puts the image after the existing ones, a cover image takes over the cover of the campaign.
+// An upload file only ever gets one image, when it already has one that image is returned instead
+func (r *repository) AddCampaignImage(image CampaignImage) (CampaignImage, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if image.UploadFileID != nil {
+			var existingImage CampaignImage
+
+			if err := tx.Where("upload_file_id = ?", *image.UploadFileID).Find(&existingImage).Error; err != nil {
+				return err
+			}
+
+			if existingImage.ID > 0 {
+				image = existingImage
+
+				return nil
+			}
+		}
+
+		if err := tx.Model(&CampaignImage{}).Where("campaign_id = ?", image.CampaignID).Select("COALESCE(MAX(position), -1) + 1").Scan(&image.Position).Error; err != nil {
+			return err
+		}
+
+		if image.IsCover {
+			if err := tx.Model(&CampaignImage{}).Where("campaign_id = ?", image.CampaignID).Update("is_cover", false).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&image).Error
+	})
+
+	if err != nil {
+		return image, err
+	}
+
+	return image, nil
+}
+
+// UpdateCampaignImageCover makes the image the only cover of its campaign, or just removes its cover flag
+func (r *repository) UpdateCampaignImageCover(image CampaignImage, isCover bool) (CampaignImage, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if isCover {
+			if err := tx.Model(&CampaignImage{}).Where("campaign_id = ? AND id <> ?", image.CampaignID, image.ID).Update("is_cover", false).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&image).Updates(map[string]interface{}{"is_cover": isCover, "updated_at": time.Now()}).Error
+	})
+
+	if err != nil {
+		return image, err
+	}
+
+	image.IsCover = isCover
+
+	return image, nil
+}
+
+func (r *repository) ReorderCampaignImages(campaignID int, imageIDs []int) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for position, imageID := range imageIDs {
+			err := tx.Model(&CampaignImage{}).Where("id = ? AND campaign_id = ?", imageID, campaignID).Updates(map[string]interface{}{"position": position, "updated_at": time.Now()}).Error
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteCampaignImage hands the cover over to the first remaining image when the cover is deleted
+func (r *repository) DeleteCampaignImage(image CampaignImage) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&image).Error; err != nil {
+			return err
+		}
+
+		if !image.IsCover {
+			return nil
+		}
+
+		var nextCover CampaignImage
+
+		if err := tx.Where("campaign_id = ?", image.CampaignID).Order("position asc, id asc").Limit(1).Find(&nextCover).Error; err != nil {
+			return err
+		}
+
+		if nextCover.ID <= 0 {
+			return nil
+		}
+
+		return tx.Model(&nextCover).Update("is_cover", true).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) AllEndedActive(now time.Time) ([]Campaign, error) {
+	var campaigns []Campaign
+
+	// Campaigns that never got published can't hold any pledges, there is nothing to settle
+	err := r.db.Where("funding_status = ? AND ends_at <= ? AND status IN ?", FundingStatusActive, now, everPublishedStatuses()).Order("ends_at asc").Find(&campaigns).Error
+
+	if err != nil {
+		return campaigns, err
+	}
+
+	return campaigns, nil
+}
+
+// AllFailedWithFunds finds failed campaigns that still hold settled money, current_amount leaves out what was refunded
+func (r *repository) AllFailedWithFunds() ([]Campaign, error) {
+	var campaigns []Campaign
+
+	err := r.db.Where("funding_status = ? AND current_amount > 0", FundingStatusFailed).Order("id asc").Find(&campaigns).Error
+
+	if err != nil {
+		return campaigns, err
+	}
+
+	return campaigns, nil
+}
+
+func (r *repository) UpdateFundingStatus(campaign Campaign, status string) (Campaign, error) {
+	// Funding is settled only once, a campaign that already left "active" keeps its outcome
+	result := r.db.Model(&campaign).Where("funding_status = ?", FundingStatusActive).Updates(map[string]interface{}{
+		"funding_status": status,
+		"updated_at":     time.Now(),
+	})
+
+	if result.Error != nil {
+		return campaign, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return campaign, errors.New("Campaign funding has already been settled.")
+	}
+
+	campaign.FundingStatus = status
+
+	return campaign, nil
+}
+
+func (r *repository) AllRewards(campaignID int) ([]CampaignReward, error) {
+	var rewards []CampaignReward
+
+	err := r.db.Where("campaign_id = ?", campaignID).Order("minimum_amount asc, id asc").Find(&rewards).Error
+
+	if err != nil {
+		return rewards, err
+	}
+
+	return rewards, nil
+}
+
+func (r *repository) GetReward(rewardID int) (CampaignReward, error) {
+	var reward CampaignReward
+
+	err := r.db.Where("id = ?", rewardID).Find(&reward).Error
+
+	if err != nil {
+		return reward, err
+	}
+
+	return reward, nil
+}
+
+func (r *repository) SaveReward(reward CampaignReward) (CampaignReward, error) {
+	err := r.db.Create(&reward).Error
+
+	if err != nil {
+		return reward, err
+	}
+
+	return reward, nil
+}
+
+func (r *repository) UpdateReward(reward CampaignReward) (CampaignReward, error) {
+	// claimed_count is left out, it's only ever changed by pledges
+	err := r.db.Model(&reward).Select("title", "description", "minimum_amount", "quantity", "estimated_delivery_at", "requires_shipping", "updated_at").Updates(&reward).Error
+
+	if err != nil {
+		return reward, err
+	}
+
+	return reward, nil
+}
+
+func (r *repository) DeleteReward(reward CampaignReward) error {
+	err := r.db.Delete(&reward).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package campaign
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Snippets are returned as HTML. Matches are first wrapped in these control characters, which turn into <mark> tags
+// only once the campaign text around them has been escaped
+const (
+	snippetStartSel = "\x02"
+	snippetStopSel  = "\x03"
+)
+
+var snippetMarker = strings.NewReplacer(snippetStartSel, "<mark>", snippetStopSel, "</mark>")
+
+// SearchRepository keeps a full-text index of campaigns, it's kept in sync by the campaign repository
+type SearchRepository interface {
+	Index(campaign Campaign) error
+	Remove(campaignID int) error
+	Search(input SearchCampaignsInput) ([]SearchHit, int64, error)
+}
+
+type SearchHit struct {
+	CampaignID int
+	Rank       float64
+	Snippet    string
+}
+
+type SearchResult struct {
+	Campaign Campaign
+	Rank     float64
+	Snippet  string
+}
+
+// markSnippet escapes the snippet text and turns the match sentinels into <mark> tags
+func markSnippet(snippet string) string {
+	return snippetMarker.Replace(html.EscapeString(snippet))
+}
+
+// stripSnippetSentinels drops sentinels a creator typed into the text, only the highlighter may place them
+func stripSnippetSentinels(text string) string {
+	return strings.NewReplacer(snippetStartSel, "", snippetStopSel, "").Replace(text)
+}
+
+// searchTerms splits a free-text query into lowercase words, dropping anything that isn't a letter or a digit
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
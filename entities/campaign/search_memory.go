@@ -0,0 +1,162 @@
+package campaign
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memorySearchRepository is a naive in-process index for tests and local development, it only knows
+// about campaigns created or updated since the process started
+type memorySearchRepository struct {
+	mu        sync.RWMutex
+	campaigns map[int]Campaign
+}
+
+func NewMemorySearchRepository() SearchRepository {
+	return &memorySearchRepository{campaigns: map[int]Campaign{}}
+}
+
+func (r *memorySearchRepository) Index(campaign Campaign) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.campaigns[campaign.ID] = campaign
+
+	return nil
+}
+
+func (r *memorySearchRepository) Remove(campaignID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.campaigns, campaignID)
+
+	return nil
+}
+
+func (r *memorySearchRepository) Search(input SearchCampaignsInput) ([]SearchHit, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	hits := []SearchHit{}
+	terms := searchTerms(input.Q)
+
+	if len(terms) == 0 {
+		return hits, 0, nil
+	}
+
+	for _, campaign := range r.campaigns {
+		// Same weights as the Postgres index: name > highlight > description
+		nameHits := countPrefixMatches(campaign.Name, terms)
+		highlightHits := countPrefixMatches(campaign.Highlight, terms)
+		descriptionHits := countPrefixMatches(campaign.Description, terms)
+
+		if !matchesAllTerms(campaign.Name+" "+campaign.Highlight+" "+campaign.Description, terms) {
+			continue
+		}
+
+		hits = append(hits, SearchHit{
+			CampaignID: campaign.ID,
+			Rank:       float64(nameHits)*1.0 + float64(highlightHits)*0.4 + float64(descriptionHits)*0.2,
+			Snippet:    highlightTerms(campaign.Highlight+" "+campaign.Description, terms),
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank == hits[j].Rank {
+			return hits[i].CampaignID > hits[j].CampaignID
+		}
+
+		return hits[i].Rank > hits[j].Rank
+	})
+
+	total := int64(len(hits))
+	start := input.GetOffset()
+
+	if start > len(hits) {
+		start = len(hits)
+	}
+
+	end := start + input.GetLimit()
+
+	if end > len(hits) {
+		end = len(hits)
+	}
+
+	return hits[start:end], total, nil
+}
+
+func matchesAllTerms(text string, terms []string) bool {
+	words := searchTerms(text)
+
+	for _, term := range terms {
+		if !hasPrefixedWord(words, term) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func countPrefixMatches(text string, terms []string) int {
+	count := 0
+
+	for _, word := range searchTerms(text) {
+		for _, term := range terms {
+			if strings.HasPrefix(word, term) {
+				count++
+
+				break
+			}
+		}
+	}
+
+	return count
+}
+
+func hasPrefixedWord(words []string, term string) bool {
+	for _, word := range words {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// highlightTerms wraps matching words in <mark> like ts_headline does, the rest of the text is HTML escaped, keeping at most 20 words around the first match
+func highlightTerms(text string, terms []string) string {
+	words := strings.Fields(stripSnippetSentinels(text))
+	firstMatch := -1
+
+	for i, word := range words {
+		normalized := searchTerms(word)
+
+		for _, term := range terms {
+			if hasPrefixedWord(normalized, term) {
+				words[i] = snippetStartSel + word + snippetStopSel
+
+				if firstMatch < 0 {
+					firstMatch = i
+				}
+
+				break
+			}
+		}
+	}
+
+	start := firstMatch - 5
+
+	if start < 0 {
+		start = 0
+	}
+
+	end := start + 20
+
+	if end > len(words) {
+		end = len(words)
+	}
+
+	return markSnippet(strings.Join(words[start:end], " "))
+}
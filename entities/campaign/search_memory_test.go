@@ -0,0 +1,166 @@
+package campaign
+
+import (
+	"bwastartup/helpers"
+	"testing"
+)
+
+func searchFixture() SearchRepository {
+	repository := NewMemorySearchRepository()
+
+	repository.Index(Campaign{ID: 1, Name: "Solar lamps for Flores", Highlight: "Light for every house", Description: "Villages without electricity"})
+	repository.Index(Campaign{ID: 2, Name: "School library", Highlight: "Books and solar panels", Description: "A library for the village school"})
+	repository.Index(Campaign{ID: 3, Name: "Coffee roastery", Highlight: "Fair trade beans", Description: "Roasting coffee from Flores"})
+	repository.Index(Campaign{ID: 4, Name: "Removed campaign", Highlight: "Solar", Description: "Solar"})
+	repository.Remove(4)
+
+	return repository
+}
+
+func TestMemorySearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		q         string
+		wantIDs   []int
+		wantTotal int64
+	}{
+		{"name beats highlight", "solar", []int{1, 2}, 2},
+		{"prefix match", "lib", []int{2}, 1},
+		{"case and punctuation ignored", "FLORES!!", []int{1, 3}, 2},
+		{"every term has to match", "solar flores", []int{1}, 1},
+		{"description only", "electricity", []int{1}, 1},
+		{"no match", "bicycle", []int{}, 0},
+		{"no terms", "?!", []int{}, 0},
+		{"removed campaigns are gone", "removed", []int{}, 0},
+	}
+
+	repository := searchFixture()
+
+	for _, tt := range tests {
+		hits, total, err := repository.Search(SearchCampaignsInput{Q: tt.q})
+
+		if err != nil {
+			t.Fatalf("%s: Search returned error: %v", tt.name, err)
+		}
+
+		ids := []int{}
+
+		for _, hit := range hits {
+			ids = append(ids, hit.CampaignID)
+		}
+
+		if total != tt.wantTotal || len(ids) != len(tt.wantIDs) {
+			t.Errorf("%s: Search(%q) = %v (total %d), want %v (total %d)", tt.name, tt.q, ids, total, tt.wantIDs, tt.wantTotal)
+
+			continue
+		}
+
+		for i := range ids {
+			if ids[i] != tt.wantIDs[i] {
+				t.Errorf("%s: Search(%q) = %v, want %v", tt.name, tt.q, ids, tt.wantIDs)
+
+				break
+			}
+		}
+	}
+}
+
+func TestMemorySearchPagination(t *testing.T) {
+	repository := searchFixture()
+
+	tests := []struct {
+		page    int
+		wantIDs []int
+	}{
+		{1, []int{1}},
+		{2, []int{3}},
+		{3, []int{}},
+	}
+
+	for _, tt := range tests {
+		hits, total, err := repository.Search(SearchCampaignsInput{PaginationInput: helpers.PaginationInput{Page: tt.page, Limit: 1}, Q: "flores"})
+
+		if err != nil || total != 2 {
+			t.Fatalf("page %d: Search = (total %d, %v), want total 2", tt.page, total, err)
+		}
+
+		if len(hits) != len(tt.wantIDs) || (len(hits) == 1 && hits[0].CampaignID != tt.wantIDs[0]) {
+			t.Errorf("page %d: Search returned %+v, want campaigns %v", tt.page, hits, tt.wantIDs)
+		}
+	}
+}
+
+func TestHighlightTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{"marks prefix matches", "Solar lamps for solaria", []string{"sol"}, "<mark>Solar</mark> lamps for <mark>solaria</mark>"},
+		{"escapes the text", "<b>Solar</b> & wind", []string{"solar"}, "<mark>&lt;b&gt;Solar&lt;/b&gt;</mark> &amp; wind"},
+		{"escapes script tags", "<script>alert(1)</script> solar", []string{"solar"}, "&lt;script&gt;alert(1)&lt;/script&gt; <mark>solar</mark>"},
+		{"typed sentinels can't open a mark", "\x02<img src=x onerror=alert(1)>\x03 solar", []string{"solar"}, "&lt;img src=x onerror=alert(1)&gt; <mark>solar</mark>"},
+		{"no match", "Coffee beans", []string{"solar"}, "Coffee beans"},
+		{
+			"keeps twenty words from five before the first match",
+			"a b c d e f g h i j solar k l m n o p q r s t u v w x y z",
+			[]string{"solar"},
+			"f g h i j <mark>solar</mark> k l m n o p q r s t u v w x",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := highlightTerms(tt.text, tt.terms); got != tt.want {
+			t.Errorf("%s: highlightTerms = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMarkSnippet(t *testing.T) {
+	tests := []struct {
+		snippet string
+		want    string
+	}{
+		{"\x02Solar\x03 lamps", "<mark>Solar</mark> lamps"},
+		{"<mark>fake</mark> \x02solar\x03", "&lt;mark&gt;fake&lt;/mark&gt; <mark>solar</mark>"},
+		{`"quoted" & 'single'`, "&#34;quoted&#34; &amp; &#39;single&#39;"},
+	}
+
+	for _, tt := range tests {
+		if got := markSnippet(tt.snippet); got != tt.want {
+			t.Errorf("markSnippet(%q) = %q, want %q", tt.snippet, got, tt.want)
+		}
+	}
+}
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"Solar Lamps", []string{"solar", "lamps"}},
+		{"  solar,lamps!! ", []string{"solar", "lamps"}},
+		{"kopi-luwak 2021", []string{"kopi", "luwak", "2021"}},
+		{"<script>", []string{"script"}},
+		{"!?", []string{}},
+	}
+
+	for _, tt := range tests {
+		got := searchTerms(tt.query)
+
+		if len(got) != len(tt.want) {
+			t.Errorf("searchTerms(%q) = %v, want %v", tt.query, got, tt.want)
+
+			continue
+		}
+
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("searchTerms(%q) = %v, want %v", tt.query, got, tt.want)
+
+				break
+			}
+		}
+	}
+}
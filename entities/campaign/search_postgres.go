@@ -0,0 +1,82 @@
+package campaign
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const searchVectorExpr = "setweight(to_tsvector('simple', coalesce(name, '')), 'A') || " +
+	"setweight(to_tsvector('simple', coalesce(highlight, '')), 'B') || " +
+	"setweight(to_tsvector('simple', coalesce(description, '')), 'C')"
+
+const searchHeadlineOptions = "StartSel=" + snippetStartSel + ", StopSel=" + snippetStopSel + ", MaxFragments=2, MaxWords=20, MinWords=5"
+
+type postgresSearchRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresSearchRepository(db *gorm.DB) SearchRepository {
+	return &postgresSearchRepository{db}
+}
+
+func (r *postgresSearchRepository) Index(campaign Campaign) error {
+	// The vector is built from the stored columns, so this has to run after the campaign is saved
+	err := r.db.Model(&Campaign{}).Where("id = ?", campaign.ID).UpdateColumn("search_vector", gorm.Expr(searchVectorExpr)).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresSearchRepository) Remove(campaignID int) error {
+	// The vector lives on the campaign row, clearing it hides a campaign that is still around but no longer public
+	err := r.db.Model(&Campaign{}).Where("id = ?", campaignID).UpdateColumn("search_vector", nil).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *postgresSearchRepository) Search(input SearchCampaignsInput) ([]SearchHit, int64, error) {
+	var hits []SearchHit
+	var total int64
+
+	terms := searchTerms(input.Q)
+
+	if len(terms) == 0 {
+		return hits, total, nil
+	}
+
+	// Every term is matched as a prefix, "kop" finds "kopi"
+	tsQuery := strings.Join(terms, ":* & ") + ":*"
+
+	query := r.db.Model(&Campaign{}).Where("search_vector @@ to_tsquery('simple', ?)", tsQuery).Session(&gorm.Session{})
+
+	if err := query.Count(&total).Error; err != nil {
+		return hits, total, err
+	}
+
+	err := query.
+		Select("id AS campaign_id, ts_rank(search_vector, to_tsquery('simple', ?)) AS rank, "+
+			"ts_headline('simple', translate(coalesce(highlight, '') || ' ' || coalesce(description, ''), chr(2) || chr(3), ''), to_tsquery('simple', ?), ?) AS snippet",
+			tsQuery, tsQuery, searchHeadlineOptions).
+		Order("rank desc, id desc").
+		Limit(input.GetLimit()).
+		Offset(input.GetOffset()).
+		Scan(&hits).Error
+
+	if err != nil {
+		return hits, total, err
+	}
+
+	for i := range hits {
+		hits[i].Snippet = markSnippet(hits[i].Snippet)
+	}
+
+	return hits, total, nil
+}
@@ -1,46 +1,71 @@
 package campaign
 
 import (
+	"bwastartup/entities/user"
+	"bwastartup/imaging"
+	"bwastartup/storage"
+	"errors"
 	"fmt"
-	"mime/multipart"
-	"os"
-	"path/filepath"
+	"io"
+	"log"
 	"time"
 
 	"github.com/gosimple/slug"
-	"github.com/muktiwbw/gdstorage"
 )
 
 type Service interface {
-	GetAllCampaigns() ([]Campaign, error)
-	GetCampaigsByUserID(userID int) ([]Campaign, error)
+	GetAllCampaigns(input GetCampaignsInput) ([]Campaign, int64, error)
+	GetCampaignsByUserID(userID int) ([]Campaign, error)
+	SearchCampaigns(input SearchCampaignsInput) ([]SearchResult, int64, error)
 	GetCampaignByID(id int) (Campaign, error)
+	GetCampaignBySlug(slug string) (Campaign, error)
+	GetCampaignSlugRedirect(slug string) (CampaignSlugRedirect, error)
 	CreateCampaign(input CreateCampaignInput) (Campaign, error)
 	UpdateCampaign(campaign Campaign, updateValues UpdateCampaignInput) (Campaign, error)
 	DeleteCampaign(campaign Campaign) error
-	CreateCampaignImages(campaignID int, coverIndex int, files []*multipart.FileHeader) ([]CampaignImage, error)
+	TransitionStatus(campaign Campaign, status string, actor user.User, notes string) (Campaign, error)
+	TakeDown(campaign Campaign, notes string) (Campaign, error)
+	GetStatusHistories(campaignID int) ([]CampaignStatusHistory, error)
+	AddCampaignImage(campaignID int, uploadFileID int, body io.Reader, keyPrefix string, isCover bool) (CampaignImage, error)
+	GetCampaignImageByID(imageID int) (CampaignImage, error)
+	UpdateCampaignImage(image CampaignImage, input UpdateCampaignImageInput) (CampaignImage, error)
+	ReorderCampaignImages(campaign Campaign, input ReorderCampaignImagesInput) ([]CampaignImage, error)
+	DeleteCampaignImage(image CampaignImage) error
+	GetEndedCampaigns(now time.Time) ([]Campaign, error)
+	GetFailedCampaignsWithFunds() ([]Campaign, error)
+	UpdateFundingStatus(campaign Campaign, status string) (Campaign, error)
+	GetCampaignRewards(campaignID int) ([]CampaignReward, error)
+	GetCampaignRewardByID(rewardID int) (CampaignReward, error)
+	CreateCampaignReward(campaignID int, input CampaignRewardInput) (CampaignReward, error)
+	UpdateCampaignReward(reward CampaignReward, input CampaignRewardInput) (CampaignReward, error)
+	DeleteCampaignReward(reward CampaignReward) error
 }
 
+var ErrInvalidSchedule = errors.New("Invalid campaign schedule")
+var ErrInvalidReward = errors.New("Invalid campaign reward")
+var ErrInvalidImageOrder = errors.New("Invalid campaign image order")
+
 type service struct {
 	repository Repository
-	gds        gdstorage.GoogleDriveStorage
+	store      storage.Store
 }
 
-func NewService(repository Repository, gds gdstorage.GoogleDriveStorage) Service {
-	return &service{repository, gds}
+func NewService(repository Repository, store storage.Store) Service {
+	return &service{repository, store}
 }
 
-func (s *service) GetAllCampaigns() ([]Campaign, error) {
-	campaigns, err := s.repository.All()
+func (s *service) GetAllCampaigns(input GetCampaignsInput) ([]Campaign, int64, error) {
+	campaigns, total, err := s.repository.All(input)
 
 	if err != nil {
-		return campaigns, err
+		return campaigns, total, err
 	}
 
-	return campaigns, err
+	return campaigns, total, nil
 }
 
-func (s *service) GetCampaigsByUserID(userID int) ([]Campaign, error) {
+// GetCampaignsByUserID returns every campaign of the user at once, listings should use GetAllCampaigns
+func (s *service) GetCampaignsByUserID(userID int) ([]Campaign, error) {
 	campaigns, err := s.repository.AllByUserID(userID)
 
 	if err != nil {
@@ -50,6 +75,47 @@ func (s *service) GetCampaigsByUserID(userID int) ([]Campaign, error) {
 	return campaigns, nil
 }
 
+func (s *service) SearchCampaigns(input SearchCampaignsInput) ([]SearchResult, int64, error) {
+	results := []SearchResult{}
+
+	hits, total, err := s.repository.Search(input)
+
+	if err != nil || len(hits) == 0 {
+		return results, total, err
+	}
+
+	campaignIDs := []int{}
+
+	for _, hit := range hits {
+		campaignIDs = append(campaignIDs, hit.CampaignID)
+	}
+
+	campaigns, err := s.repository.AllByIDs(campaignIDs)
+
+	if err != nil {
+		return results, total, err
+	}
+
+	campaignsByID := map[int]Campaign{}
+
+	for _, campaign := range campaigns {
+		campaignsByID[campaign.ID] = campaign
+	}
+
+	// Keep the ranking order of the hits, skipping campaigns deleted or hidden since they were indexed
+	for _, hit := range hits {
+		campaign, ok := campaignsByID[hit.CampaignID]
+
+		if !ok || !campaign.IsVisible() {
+			continue
+		}
+
+		results = append(results, SearchResult{Campaign: campaign, Rank: hit.Rank, Snippet: hit.Snippet})
+	}
+
+	return results, total, nil
+}
+
 func (s *service) GetCampaignByID(id int) (Campaign, error) {
 	campaign, err := s.repository.Get(id)
 
@@ -60,7 +126,50 @@ func (s *service) GetCampaignByID(id int) (Campaign, error) {
 	return campaign, nil
 }
 
+func (s *service) GetCampaignBySlug(slug string) (Campaign, error) {
+	campaign, err := s.repository.GetBySlug(slug)
+
+	if err != nil {
+		return campaign, err
+	}
+
+	return campaign, nil
+}
+
+func (s *service) GetCampaignSlugRedirect(slug string) (CampaignSlugRedirect, error) {
+	redirect, err := s.repository.GetSlugRedirect(slug)
+
+	if err != nil {
+		return redirect, err
+	}
+
+	return redirect, nil
+}
+
 func (s *service) CreateCampaign(input CreateCampaignInput) (Campaign, error) {
+	if input.FundingModel == "" {
+		input.FundingModel = FundingModelKeepItAll
+	}
+
+	// All-or-nothing campaigns are settled at their deadline, so they can't run forever
+	if input.FundingModel == FundingModelAllOrNothing && input.EndsAt == nil {
+		return Campaign{}, fmt.Errorf("%w, all-or-nothing campaigns need an end date", ErrInvalidSchedule)
+	}
+
+	if input.EndsAt != nil && !input.EndsAt.After(time.Now()) {
+		return Campaign{}, fmt.Errorf("%w, end date must be in the future", ErrInvalidSchedule)
+	}
+
+	if input.StartsAt != nil && input.EndsAt != nil && !input.EndsAt.After(*input.StartsAt) {
+		return Campaign{}, fmt.Errorf("%w, end date must be after the start date", ErrInvalidSchedule)
+	}
+
+	campaignSlug, err := s.uniqueSlug(input.UserID, input.Name, 0)
+
+	if err != nil {
+		return Campaign{}, err
+	}
+
 	campaign := Campaign{
 		UserID:        input.UserID,
 		Name:          input.Name,
@@ -70,7 +179,12 @@ func (s *service) CreateCampaign(input CreateCampaignInput) (Campaign, error) {
 		CurrentAmount: 0,
 		Perks:         input.Perks,
 		BackersCount:  0,
-		Slug:          slug.Make(fmt.Sprintf("%d %s", input.UserID, input.Name)),
+		Slug:          campaignSlug,
+		FundingModel:  input.FundingModel,
+		FundingStatus: FundingStatusActive,
+		Status:        StatusDraft,
+		StartsAt:      input.StartsAt,
+		EndsAt:        input.EndsAt,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
@@ -85,15 +199,25 @@ func (s *service) CreateCampaign(input CreateCampaignInput) (Campaign, error) {
 }
 
 func (s *service) UpdateCampaign(campaign Campaign, updateValues UpdateCampaignInput) (Campaign, error) {
+	// Campaign stats are owned by the transaction repository and never set from here
 	newValuesCampaign := Campaign{
-		Name:          updateValues.Name,
-		Highlight:     updateValues.Highlight,
-		Description:   updateValues.Description,
-		GoalAmount:    updateValues.GoalAmount,
-		Perks:         updateValues.Perks,
-		UpdatedAt:     time.Now(),
-		CurrentAmount: updateValues.CurrentAmount,
-		BackersCount:  int(updateValues.BackersCount),
+		Name:        updateValues.Name,
+		Highlight:   updateValues.Highlight,
+		Description: updateValues.Description,
+		GoalAmount:  updateValues.GoalAmount,
+		Perks:       updateValues.Perks,
+		UpdatedAt:   time.Now(),
+	}
+
+	// Renamed campaigns get a new slug, the repository keeps the old one as a redirect
+	if updateValues.Name != "" && updateValues.Name != campaign.Name {
+		campaignSlug, err := s.uniqueSlug(campaign.UserID, updateValues.Name, campaign.ID)
+
+		if err != nil {
+			return campaign, err
+		}
+
+		newValuesCampaign.Slug = campaignSlug
 	}
 
 	updatedCampaign, err := s.repository.Update(campaign, newValuesCampaign)
@@ -105,6 +229,26 @@ func (s *service) UpdateCampaign(campaign Campaign, updateValues UpdateCampaignI
 	return updatedCampaign, nil
 }
 
+// uniqueSlug appends -2, -3, ... to the slug until no other campaign uses it
+func (s *service) uniqueSlug(userID int, name string, campaignID int) (string, error) {
+	baseSlug := slug.Make(fmt.Sprintf("%d %s", userID, name))
+	candidate := baseSlug
+
+	for i := 2; ; i++ {
+		taken, err := s.repository.IsSlugTaken(candidate, campaignID)
+
+		if err != nil {
+			return candidate, err
+		}
+
+		if !taken {
+			return candidate, nil
+		}
+
+		candidate = fmt.Sprintf("%s-%d", baseSlug, i)
+	}
+}
+
 func (s *service) DeleteCampaign(campaign Campaign) error {
 	err := s.repository.Delete(campaign)
 
@@ -115,48 +259,282 @@ func (s *service) DeleteCampaign(campaign Campaign) error {
 	return nil
 }
 
-func (s *service) CreateCampaignImages(campaignID int, coverIndex int, files []*multipart.FileHeader) ([]CampaignImage, error) {
-	// * Store images to Google Ddrive
-	driveFileInputs := []*gdstorage.StoreFileInput{}
+// TransitionStatus moves the campaign through its lifecycle on behalf of actor, the creator or a member of staff
+func (s *service) TransitionStatus(campaign Campaign, status string, actor user.User, notes string) (Campaign, error) {
+	if err := checkTransition(campaign, status, actor, notes); err != nil {
+		return campaign, err
+	}
+
+	// A campaign that ended while it was a draft could never take a pledge once published
+	if (status == StatusInReview || status == StatusPublished) && campaign.EndsAt != nil && !campaign.EndsAt.After(time.Now()) {
+		return campaign, fmt.Errorf("%w, end date must be in the future", ErrInvalidSchedule)
+	}
+
+	return s.updateStatus(campaign, status, &actor.ID, notes)
+}
+
+// TakeDown moves the campaign along its take down transition on behalf of the platform, the history has no user
+func (s *service) TakeDown(campaign Campaign, notes string) (Campaign, error) {
+	status, ok := takeDownTransitions[campaign.Status]
 
-	for _, file := range files {
-		fileExt := filepath.Ext(file.Filename)
-		fileName := fmt.Sprintf("campaign-%d%s", campaignID, fileExt)
+	if !ok {
+		return campaign, nil
+	}
+
+	return s.updateStatus(campaign, status, nil, notes)
+}
 
-		driveFileInputs = append(driveFileInputs, &gdstorage.StoreFileInput{Name: fileName, FileHeader: file})
+func (s *service) updateStatus(campaign Campaign, status string, userID *int, notes string) (Campaign, error) {
+	history := CampaignStatusHistory{
+		CampaignID: campaign.ID,
+		OldStatus:  campaign.Status,
+		NewStatus:  status,
+		UserID:     userID,
+		Notes:      notes,
+		CreatedAt:  time.Now(),
 	}
 
-	driveFileIDs, err := s.gds.StoreFiles(driveFileInputs, os.Getenv("DRIVE_APP_CAMPAIGN_IMAGES_DIR_ID"))
+	campaign.Status = status
+	campaign.UpdatedAt = history.CreatedAt
+
+	updatedCampaign, err := s.repository.UpdateStatus(campaign, history)
+
+	if err != nil {
+		return updatedCampaign, err
+	}
+
+	return updatedCampaign, nil
+}
+
+func (s *service) GetStatusHistories(campaignID int) ([]CampaignStatusHistory, error) {
+	histories, err := s.repository.AllStatusHistories(campaignID)
+
 	if err != nil {
-		return []CampaignImage{}, err
+		return histories, err
+	}
+
+	return histories, nil
+}
+
+// AddCampaignImage stores the renditions of one uploaded file and its row, the renditions are removed again when the
+// row can't be saved. A file that already has its image, e.g. when a job is retried, keeps that one, only files from
+// an attempt that crashed before its row was saved can be left behind in storage
+func (s *service) AddCampaignImage(campaignID int, uploadFileID int, body io.Reader, keyPrefix string, isCover bool) (CampaignImage, error) {
+	existingImage, err := s.repository.GetCampaignImageByUploadFileID(uploadFileID)
+
+	if err != nil || existingImage.ID > 0 {
+		return existingImage, err
 	}
 
-	// * Save images data to DB
-	campaignImages := []CampaignImage{}
+	keys, err := imaging.UploadReader(s.store, keyPrefix, body, imaging.CampaignImageSizes)
+	if err != nil {
+		return CampaignImage{}, err
+	}
 
-	for i, driveFileID := range driveFileIDs {
-		campaignImage := CampaignImage{}
-		campaignImage.CampaignID = campaignID
-		campaignImage.Filename = driveFileID
-		campaignImage.IsCover = false
-		campaignImage.CreatedAt = time.Now()
-		campaignImage.UpdatedAt = time.Now()
+	campaignImage := CampaignImage{
+		CampaignID:        campaignID,
+		Filename:          keys.Full,
+		CardFilename:      keys.Card,
+		ThumbnailFilename: keys.Thumbnail,
+		IsCover:           isCover,
+		UploadFileID:      &uploadFileID,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
 
-		if i == coverIndex {
-			campaignImage.IsCover = true
+	savedImage, err := s.repository.AddCampaignImage(campaignImage)
+	if err != nil || savedImage.Filename != keys.Full {
+		if deleteErr := imaging.Delete(s.store, keys); deleteErr != nil {
+			log.Printf("Unable to delete the files of an unsaved campaign image: %v\n", deleteErr)
 		}
+	}
 
-		campaignImages = append(campaignImages, campaignImage)
+	if err != nil {
+		return savedImage, err
 	}
 
-	if err := s.repository.ResetCampaignImageCover(campaignID); err != nil {
-		return []CampaignImage{}, err
+	return savedImage, nil
+}
+
+func (s *service) GetCampaignImageByID(imageID int) (CampaignImage, error) {
+	image, err := s.repository.GetCampaignImage(imageID)
+
+	if err != nil {
+		return image, err
 	}
 
-	createdImages, err := s.repository.SaveCampaignImages(campaignImages)
+	return image, nil
+}
+
+func (s *service) UpdateCampaignImage(image CampaignImage, input UpdateCampaignImageInput) (CampaignImage, error) {
+	updatedImage, err := s.repository.UpdateCampaignImageCover(image, *input.IsCover)
+
 	if err != nil {
-		return campaignImages, err
+		return updatedImage, err
+	}
+
+	return updatedImage, nil
+}
+
+// ReorderCampaignImages needs every image of the campaign exactly once, so positions stay unique
+func (s *service) ReorderCampaignImages(campaign Campaign, input ReorderCampaignImagesInput) ([]CampaignImage, error) {
+	images, err := s.repository.AllCampaignImages(campaign.ID)
+
+	if err != nil {
+		return images, err
+	}
+
+	if len(input.ImageIDs) != len(images) {
+		return images, fmt.Errorf("%w, expected the IDs of all %d images", ErrInvalidImageOrder, len(images))
+	}
+
+	remaining := map[int]bool{}
+
+	for _, image := range images {
+		remaining[image.ID] = true
+	}
+
+	for _, imageID := range input.ImageIDs {
+		if !remaining[imageID] {
+			return images, fmt.Errorf("%w, image %d is unknown or listed twice", ErrInvalidImageOrder, imageID)
+		}
+
+		delete(remaining, imageID)
+	}
+
+	if err := s.repository.ReorderCampaignImages(campaign.ID, input.ImageIDs); err != nil {
+		return images, err
+	}
+
+	reorderedImages, err := s.repository.AllCampaignImages(campaign.ID)
+
+	if err != nil {
+		return reorderedImages, err
+	}
+
+	return reorderedImages, nil
+}
+
+// DeleteCampaignImage removes the row first, a file left behind in storage is only logged
+func (s *service) DeleteCampaignImage(image CampaignImage) error {
+	err := s.repository.DeleteCampaignImage(image)
+
+	if err != nil {
+		return err
+	}
+
+	if err := imaging.Delete(s.store, image.Keys()); err != nil {
+		log.Printf("Unable to delete the files of campaign image %d: %v\n", image.ID, err)
+	}
+
+	return nil
+}
+
+func (s *service) GetEndedCampaigns(now time.Time) ([]Campaign, error) {
+	campaigns, err := s.repository.AllEndedActive(now)
+
+	if err != nil {
+		return campaigns, err
+	}
+
+	return campaigns, nil
+}
+
+func (s *service) GetFailedCampaignsWithFunds() ([]Campaign, error) {
+	campaigns, err := s.repository.AllFailedWithFunds()
+
+	if err != nil {
+		return campaigns, err
 	}
 
-	return createdImages, nil
+	return campaigns, nil
+}
+
+func (s *service) UpdateFundingStatus(campaign Campaign, status string) (Campaign, error) {
+	updatedCampaign, err := s.repository.UpdateFundingStatus(campaign, status)
+
+	if err != nil {
+		return updatedCampaign, err
+	}
+
+	return updatedCampaign, nil
+}
+
+func (s *service) GetCampaignRewards(campaignID int) ([]CampaignReward, error) {
+	rewards, err := s.repository.AllRewards(campaignID)
+
+	if err != nil {
+		return rewards, err
+	}
+
+	return rewards, nil
+}
+
+func (s *service) GetCampaignRewardByID(rewardID int) (CampaignReward, error) {
+	reward, err := s.repository.GetReward(rewardID)
+
+	if err != nil {
+		return reward, err
+	}
+
+	return reward, nil
+}
+
+func (s *service) CreateCampaignReward(campaignID int, input CampaignRewardInput) (CampaignReward, error) {
+	reward := CampaignReward{
+		CampaignID:          campaignID,
+		Title:               input.Title,
+		Description:         input.Description,
+		MinimumAmount:       input.MinimumAmount,
+		Quantity:            input.Quantity,
+		ClaimedCount:        0,
+		EstimatedDeliveryAt: input.EstimatedDeliveryAt,
+		RequiresShipping:    input.RequiresShipping,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+	}
+
+	newReward, err := s.repository.SaveReward(reward)
+
+	if err != nil {
+		return newReward, err
+	}
+
+	return newReward, nil
+}
+
+func (s *service) UpdateCampaignReward(reward CampaignReward, input CampaignRewardInput) (CampaignReward, error) {
+	if input.Quantity != nil && *input.Quantity < reward.ClaimedCount {
+		return reward, fmt.Errorf("%w, %d backers already picked this reward", ErrInvalidReward, reward.ClaimedCount)
+	}
+
+	reward.Title = input.Title
+	reward.Description = input.Description
+	reward.MinimumAmount = input.MinimumAmount
+	reward.Quantity = input.Quantity
+	reward.EstimatedDeliveryAt = input.EstimatedDeliveryAt
+	reward.RequiresShipping = input.RequiresShipping
+	reward.UpdatedAt = time.Now()
+
+	updatedReward, err := s.repository.UpdateReward(reward)
+
+	if err != nil {
+		return updatedReward, err
+	}
+
+	return updatedReward, nil
+}
+
+func (s *service) DeleteCampaignReward(reward CampaignReward) error {
+	if reward.ClaimedCount > 0 {
+		return fmt.Errorf("%w, %d backers already picked this reward", ErrInvalidReward, reward.ClaimedCount)
+	}
+
+	err := s.repository.DeleteReward(reward)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
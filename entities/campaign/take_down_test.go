@@ -0,0 +1,61 @@
+package campaign
+
+import "testing"
+
+// statusRepository records the status updates the service makes
+type statusRepository struct {
+	Repository
+	histories []CampaignStatusHistory
+}
+
+func (r *statusRepository) UpdateStatus(campaign Campaign, history CampaignStatusHistory) (Campaign, error) {
+	r.histories = append(r.histories, history)
+
+	return campaign, nil
+}
+
+func TestTakeDown(t *testing.T) {
+	tests := []struct {
+		from string
+		want string
+	}{
+		{StatusDraft, StatusDraft},
+		{StatusInReview, StatusDraft},
+		{StatusPublished, StatusClosed},
+		{StatusSuspended, StatusClosed},
+		{StatusClosed, StatusClosed},
+	}
+
+	for _, tt := range tests {
+		repository := &statusRepository{}
+		s := &service{repository: repository}
+
+		got, err := s.TakeDown(Campaign{ID: 7, UserID: 1, Status: tt.from}, "Creator deleted their account")
+
+		if err != nil {
+			t.Fatalf("TakeDown from %s returned error: %v", tt.from, err)
+		}
+
+		if got.Status != tt.want {
+			t.Errorf("TakeDown from %s = %s, want %s", tt.from, got.Status, tt.want)
+		}
+
+		if tt.from == tt.want {
+			if len(repository.histories) != 0 {
+				t.Errorf("TakeDown from %s recorded a status change", tt.from)
+			}
+
+			continue
+		}
+
+		if len(repository.histories) != 1 {
+			t.Fatalf("TakeDown from %s recorded %d status changes, want 1", tt.from, len(repository.histories))
+		}
+
+		history := repository.histories[0]
+
+		if history.OldStatus != tt.from || history.NewStatus != tt.want || history.UserID != nil || history.Notes == "" {
+			t.Errorf("TakeDown from %s recorded %+v", tt.from, history)
+		}
+	}
+}
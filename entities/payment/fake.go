@@ -0,0 +1,168 @@
+package payment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+type fakeOrder struct {
+	amount         int64
+	refundedAmount int64
+	status         string
+}
+
+// fakeGateway keeps its orders in memory and never leaves the process, it's meant for tests and local development
+type fakeGateway struct {
+	serverKey  string
+	paymentURL string
+	mu         sync.Mutex
+	orders     map[string]*fakeOrder
+}
+
+func NewFakeGateway(serverKey string, paymentURL string) Gateway {
+	return &fakeGateway{
+		serverKey:  serverKey,
+		paymentURL: paymentURL,
+		orders:     map[string]*fakeOrder{},
+	}
+}
+
+func (g *fakeGateway) CreateCharge(charge Charge) (ChargeResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.orders[charge.OrderID]; ok {
+		return ChargeResult{}, fmt.Errorf("Order %s already exists", charge.OrderID)
+	}
+
+	g.orders[charge.OrderID] = &fakeOrder{amount: charge.Amount, status: "pending"}
+
+	// The same order always gets the same token
+	hash := sha256.Sum256([]byte(charge.OrderID))
+	token := "fake-" + hex.EncodeToString(hash[:])[:32]
+
+	return ChargeResult{Token: token, PaymentURL: fmt.Sprintf("%s/%s", g.paymentURL, token)}, nil
+}
+
+func (g *fakeGateway) GetStatus(orderID string) (StatusResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	order, err := g.find(orderID)
+	if err != nil {
+		return StatusResult{}, err
+	}
+
+	return g.statusResult(orderID, order), nil
+}
+
+func (g *fakeGateway) Cancel(orderID string) (StatusResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	order, err := g.find(orderID)
+	if err != nil {
+		return StatusResult{}, err
+	}
+
+	if order.status != "pending" {
+		return StatusResult{}, fmt.Errorf("Order %s can't be cancelled, it is %s", orderID, order.status)
+	}
+
+	order.status = "cancel"
+
+	return g.statusResult(orderID, order), nil
+}
+
+func (g *fakeGateway) Refund(orderID string, refund RefundRequest) (RefundResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	order, err := g.find(orderID)
+	if err != nil {
+		return RefundResult{}, err
+	}
+
+	// Card payments are refundable once captured, other payment types once settled
+	if order.status != "capture" && order.status != "settlement" && order.status != "partial_refund" {
+		return RefundResult{}, fmt.Errorf("Order %s can't be refunded, it is %s", orderID, order.status)
+	}
+
+	if refund.Amount <= 0 || order.refundedAmount+refund.Amount > order.amount {
+		return RefundResult{}, fmt.Errorf("Refund amount exceeds what is left of order %s", orderID)
+	}
+
+	order.refundedAmount += refund.Amount
+	order.status = "partial_refund"
+
+	if order.refundedAmount == order.amount {
+		order.status = "refund"
+	}
+
+	return RefundResult{RefundKey: refund.RefundKey, Amount: refund.Amount, TransactionStatus: order.status}, nil
+}
+
+// SimulateNotification moves an order to the given Midtrans transaction status and returns the signed
+// notification Midtrans would have sent for it
+func (g *fakeGateway) SimulateNotification(orderID string, transactionStatus string) (NotificationInput, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	order, err := g.find(orderID)
+	if err != nil {
+		return NotificationInput{}, err
+	}
+
+	order.status = transactionStatus
+	result := g.statusResult(orderID, order)
+
+	return NotificationInput{
+		TransactionID:     "fake-" + orderID,
+		OrderID:           orderID,
+		StatusCode:        result.StatusCode,
+		GrossAmount:       result.GrossAmount,
+		SignatureKey:      signNotification(orderID, result.StatusCode, result.GrossAmount, g.serverKey),
+		TransactionStatus: transactionStatus,
+		FraudStatus:       result.FraudStatus,
+		PaymentType:       "fake",
+	}, nil
+}
+
+func (g *fakeGateway) find(orderID string) (*fakeOrder, error) {
+	order, ok := g.orders[orderID]
+
+	if !ok {
+		return nil, fmt.Errorf("Order %s not found", orderID)
+	}
+
+	return order, nil
+}
+
+func (g *fakeGateway) statusResult(orderID string, order *fakeOrder) StatusResult {
+	statusCode := "200"
+
+	switch order.status {
+	case "pending":
+		statusCode = "201"
+	case "deny", "cancel":
+		statusCode = "202"
+	case "expire":
+		statusCode = "407"
+	}
+
+	fraudStatus := ""
+
+	if order.status == "capture" {
+		fraudStatus = "accept"
+	}
+
+	return StatusResult{
+		OrderID:           orderID,
+		StatusCode:        statusCode,
+		GrossAmount:       fmt.Sprintf("%d.00", order.amount),
+		TransactionStatus: order.status,
+		FraudStatus:       fraudStatus,
+	}
+}
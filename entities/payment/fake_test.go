@@ -0,0 +1,100 @@
+package payment
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFakeGatewayChargeNotifyRefund(t *testing.T) {
+	tests := []struct {
+		name              string
+		transactionStatus string
+		wantStatus        string
+	}{
+		{"settled payment", "settlement", "paid"},
+		{"captured card payment", "capture", "paid"},
+	}
+
+	for _, tt := range tests {
+		s := NewService(NewFakeGateway("server-key", "http://localhost/pay"), "server-key")
+
+		charge, err := s.CreateCharge(Charge{OrderID: "order-1", Amount: 100000})
+
+		if err != nil {
+			t.Fatalf("%s: CreateCharge returned error: %v", tt.name, err)
+		}
+
+		if charge.PaymentURL != "http://localhost/pay/"+charge.Token {
+			t.Errorf("%s: payment URL is %s, want it to end with the token %s", tt.name, charge.PaymentURL, charge.Token)
+		}
+
+		if _, err := s.Refund("order-1", RefundRequest{RefundKey: "refund-0", Amount: 100000}); err == nil {
+			t.Errorf("%s: Refund of an unpaid order returned no error", tt.name)
+		}
+
+		notification, err := s.SimulateNotification("order-1", tt.transactionStatus)
+
+		if err != nil {
+			t.Fatalf("%s: SimulateNotification returned error: %v", tt.name, err)
+		}
+
+		if err := s.VerifyNotification(notification); err != nil {
+			t.Errorf("%s: VerifyNotification returned error: %v", tt.name, err)
+		}
+
+		if status := s.GetTransactionStatus(notification); status != tt.wantStatus {
+			t.Errorf("%s: GetTransactionStatus = %s, want %s", tt.name, status, tt.wantStatus)
+		}
+
+		refunds := []struct {
+			amount     int64
+			wantStatus string
+			wantErr    bool
+		}{
+			{40000, "partial_refund", false},
+			{70000, "", true},
+			{60000, "refund", false},
+			{1, "", true},
+		}
+
+		for i, refund := range refunds {
+			result, err := s.Refund("order-1", RefundRequest{RefundKey: fmt.Sprintf("refund-%d", i+1), Amount: refund.amount})
+
+			if (err != nil) != refund.wantErr {
+				t.Errorf("%s: refund %d returned %v, want error %v", tt.name, i, err, refund.wantErr)
+
+				continue
+			}
+
+			if !refund.wantErr && result.TransactionStatus != refund.wantStatus {
+				t.Errorf("%s: refund %d left the order %s, want %s", tt.name, i, result.TransactionStatus, refund.wantStatus)
+			}
+		}
+
+		status, err := s.GetStatus("order-1")
+
+		if err != nil || status.TransactionStatus != "refund" {
+			t.Errorf("%s: GetStatus = (%s, %v), want refund", tt.name, status.TransactionStatus, err)
+		}
+	}
+}
+
+func TestFakeGatewayRejectsForgedNotifications(t *testing.T) {
+	s := NewService(NewFakeGateway("server-key", "http://localhost/pay"), "server-key")
+
+	if _, err := s.CreateCharge(Charge{OrderID: "order-1", Amount: 100000}); err != nil {
+		t.Fatalf("CreateCharge returned error: %v", err)
+	}
+
+	notification, err := s.SimulateNotification("order-1", "settlement")
+
+	if err != nil {
+		t.Fatalf("SimulateNotification returned error: %v", err)
+	}
+
+	notification.GrossAmount = "1.00"
+
+	if err := s.VerifyNotification(notification); err == nil {
+		t.Error("VerifyNotification accepted a notification with a changed amount")
+	}
+}
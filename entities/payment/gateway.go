@@ -0,0 +1,53 @@
+package payment
+
+type Gateway interface {
+	CreateCharge(charge Charge) (ChargeResult, error)
+	GetStatus(orderID string) (StatusResult, error)
+	Cancel(orderID string) (StatusResult, error)
+	Refund(orderID string, refund RefundRequest) (RefundResult, error)
+}
+
+// NotificationSimulator is implemented by gateways that can produce notifications on their own,
+// which lets the whole payment flow run without reaching Midtrans
+type NotificationSimulator interface {
+	SimulateNotification(orderID string, transactionStatus string) (NotificationInput, error)
+}
+
+type Charge struct {
+	OrderID  string
+	Amount   int64
+	Customer Customer
+	ItemID   string
+	ItemName string
+}
+
+type Customer struct {
+	FirstName string
+	LastName  string
+	Email     string
+}
+
+type ChargeResult struct {
+	Token      string
+	PaymentURL string
+}
+
+type StatusResult struct {
+	OrderID           string
+	StatusCode        string
+	GrossAmount       string
+	TransactionStatus string
+	FraudStatus       string
+}
+
+type RefundRequest struct {
+	RefundKey string
+	Amount    int64
+	Reason    string
+}
+
+type RefundResult struct {
+	RefundKey         string
+	Amount            int64
+	TransactionStatus string
+}
@@ -0,0 +1,26 @@
+package payment
+
+type NotificationInput struct {
+	TransactionID     string `json:"transaction_id"`
+	OrderID           string `json:"order_id" binding:"required"`
+	StatusCode        string `json:"status_code" binding:"required"`
+	GrossAmount       string `json:"gross_amount" binding:"required"`
+	SignatureKey      string `json:"signature_key" binding:"required"`
+	TransactionStatus string `json:"transaction_status" binding:"required"`
+	FraudStatus       string `json:"fraud_status"`
+	PaymentType       string `json:"payment_type"`
+	// Refunds lists every refund of the order, it comes with refund and partial_refund notifications
+	Refunds []NotificationRefund `json:"refunds"`
+}
+
+type NotificationRefund struct {
+	RefundChargebackID int64  `json:"refund_chargeback_id"`
+	RefundKey          string `json:"refund_key"`
+	RefundAmount       string `json:"refund_amount"`
+	Reason             string `json:"reason"`
+}
+
+type SimulateNotificationInput struct {
+	OrderID           string `json:"order_id" binding:"required"`
+	TransactionStatus string `json:"transaction_status" binding:"required,oneof=capture settlement pending deny cancel expire"`
+}
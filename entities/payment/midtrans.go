@@ -0,0 +1,177 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/veritrans/go-midtrans"
+)
+
+const (
+	midtransSandboxAPIURL    = "https://api.sandbox.midtrans.com/v2"
+	midtransProductionAPIURL = "https://api.midtrans.com/v2"
+)
+
+type midtransGateway struct {
+	client     midtrans.Client
+	snapURL    string
+	apiURL     string
+	httpClient *http.Client
+}
+
+type midtransCoreResponse struct {
+	StatusCode        string `json:"status_code"`
+	StatusMessage     string `json:"status_message"`
+	OrderID           string `json:"order_id"`
+	GrossAmount       string `json:"gross_amount"`
+	TransactionStatus string `json:"transaction_status"`
+	FraudStatus       string `json:"fraud_status"`
+	RefundKey         string `json:"refund_key"`
+	RefundAmount      string `json:"refund_amount"`
+}
+
+func NewMidtransGateway(serverKey string, clientKey string, production bool, snapURL string) Gateway {
+	client := midtrans.NewClient()
+	client.ServerKey = serverKey
+	client.ClientKey = clientKey
+	client.APIEnvType = midtrans.Sandbox
+
+	apiURL := midtransSandboxAPIURL
+
+	if production {
+		client.APIEnvType = midtrans.Production
+		apiURL = midtransProductionAPIURL
+	}
+
+	return &midtransGateway{
+		client:     client,
+		snapURL:    snapURL,
+		apiURL:     apiURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (g *midtransGateway) CreateCharge(charge Charge) (ChargeResult, error) {
+	snapGateway := midtrans.SnapGateway{
+		Client: g.client,
+	}
+
+	snapReq := &midtrans.SnapReq{
+		TransactionDetails: midtrans.TransactionDetails{
+			OrderID:  charge.OrderID,
+			GrossAmt: charge.Amount,
+		},
+		CustomerDetail: &midtrans.CustDetail{
+			FName: charge.Customer.FirstName,
+			LName: charge.Customer.LastName,
+			Email: charge.Customer.Email,
+		},
+		Items: &[]midtrans.ItemDetail{
+			{
+				ID:    charge.ItemID,
+				Price: charge.Amount,
+				Qty:   1,
+				Name:  charge.ItemName,
+			},
+		},
+	}
+
+	snapTokenResp, err := snapGateway.GetToken(snapReq)
+
+	if err != nil {
+		return ChargeResult{}, err
+	}
+
+	return ChargeResult{Token: snapTokenResp.Token, PaymentURL: fmt.Sprintf("%s/%s", g.snapURL, snapTokenResp.Token)}, nil
+}
+
+func (g *midtransGateway) GetStatus(orderID string) (StatusResult, error) {
+	resp, err := g.call(http.MethodGet, fmt.Sprintf("/%s/status", orderID), nil)
+
+	if err != nil {
+		return StatusResult{}, err
+	}
+
+	return resp.statusResult(), nil
+}
+
+func (g *midtransGateway) Cancel(orderID string) (StatusResult, error) {
+	resp, err := g.call(http.MethodPost, fmt.Sprintf("/%s/cancel", orderID), nil)
+
+	if err != nil {
+		return StatusResult{}, err
+	}
+
+	return resp.statusResult(), nil
+}
+
+func (g *midtransGateway) Refund(orderID string, refund RefundRequest) (RefundResult, error) {
+	body := map[string]interface{}{
+		"refund_key": refund.RefundKey,
+		"amount":     refund.Amount,
+		"reason":     refund.Reason,
+	}
+
+	resp, err := g.call(http.MethodPost, fmt.Sprintf("/%s/refund", orderID), body)
+
+	if err != nil {
+		return RefundResult{}, err
+	}
+
+	amount, _ := strconv.ParseFloat(resp.RefundAmount, 64)
+
+	return RefundResult{RefundKey: resp.RefundKey, Amount: int64(amount), TransactionStatus: resp.TransactionStatus}, nil
+}
+
+func (g *midtransGateway) call(method string, path string, body interface{}) (midtransCoreResponse, error) {
+	var coreResp midtransCoreResponse
+	var payload bytes.Buffer
+
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return coreResp, err
+		}
+	}
+
+	req, err := http.NewRequest(method, g.apiURL+path, &payload)
+	if err != nil {
+		return coreResp, err
+	}
+
+	req.SetBasicAuth(g.client.ServerKey, "")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := g.httpClient.Do(req)
+	if err != nil {
+		return coreResp, err
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(&coreResp); err != nil {
+		return coreResp, err
+	}
+
+	// Midtrans answers with HTTP 200 and puts the actual result in status_code, 407 means the transaction expired
+	switch coreResp.StatusCode {
+	case "200", "201", "202", "407":
+		return coreResp, nil
+	}
+
+	return coreResp, errors.New(fmt.Sprintf("Midtrans error %s: %s", coreResp.StatusCode, coreResp.StatusMessage))
+}
+
+func (r midtransCoreResponse) statusResult() StatusResult {
+	return StatusResult{
+		OrderID:           r.OrderID,
+		StatusCode:        r.StatusCode,
+		GrossAmount:       r.GrossAmount,
+		TransactionStatus: r.TransactionStatus,
+		FraudStatus:       r.FraudStatus,
+	}
+}
@@ -1,56 +1,132 @@
 package payment
 
 import (
-	"os"
-
-	"github.com/veritrans/go-midtrans"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 )
 
 type Service interface {
-	GenerateSnapLink(map[string]interface{}) (midtrans.SnapResponse, error)
+	CreateCharge(charge Charge) (ChargeResult, error)
+	GetStatus(orderID string) (StatusResult, error)
+	Cancel(orderID string) (StatusResult, error)
+	Refund(orderID string, refund RefundRequest) (RefundResult, error)
+	VerifyNotification(input NotificationInput) error
+	GetTransactionStatus(input NotificationInput) string
+	SimulateNotification(orderID string, transactionStatus string) (NotificationInput, error)
+}
+
+type service struct {
+	gateway   Gateway
+	serverKey string
+}
+
+func NewService(gateway Gateway, serverKey string) Service {
+	return &service{gateway, serverKey}
+}
+
+func (s *service) CreateCharge(charge Charge) (ChargeResult, error) {
+	result, err := s.gateway.CreateCharge(charge)
+
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (s *service) GetStatus(orderID string) (StatusResult, error) {
+	result, err := s.gateway.GetStatus(orderID)
+
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (s *service) Cancel(orderID string) (StatusResult, error) {
+	result, err := s.gateway.Cancel(orderID)
+
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
 }
 
-type service struct{}
+func (s *service) Refund(orderID string, refund RefundRequest) (RefundResult, error) {
+	result, err := s.gateway.Refund(orderID, refund)
+
+	if err != nil {
+		return result, err
+	}
 
-func NewService() Service {
-	return &service{}
+	return result, nil
 }
 
-func (s *service) GenerateSnapLink(snapReqData map[string]interface{}) (midtrans.SnapResponse, error) {
-	midclient := midtrans.NewClient()
-	midclient.ServerKey = os.Getenv("MIDTRANS_SERVER_KEY")
-	midclient.ClientKey = os.Getenv("MIDTRANS_CLIENT_KEY")
-	midclient.APIEnvType = midtrans.Sandbox
+func (s *service) VerifyNotification(input NotificationInput) error {
+	signature := signNotification(input.OrderID, input.StatusCode, input.GrossAmount, s.serverKey)
 
-	snapGateway := midtrans.SnapGateway{
-		Client: midclient,
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(input.SignatureKey)) != 1 {
+		return errors.New("Invalid notification signature.")
 	}
 
-	snapReq := &midtrans.SnapReq{
-		TransactionDetails: midtrans.TransactionDetails{
-			OrderID:  snapReqData["transaction"].(map[string]interface{})["orderID"].(string),
-			GrossAmt: snapReqData["transaction"].(map[string]interface{})["grossAmt"].(int64),
-		},
-		CustomerDetail: &midtrans.CustDetail{
-			FName: snapReqData["customer"].(map[string]interface{})["fName"].(string),
-			LName: snapReqData["customer"].(map[string]interface{})["lName"].(string),
-			Email: snapReqData["customer"].(map[string]interface{})["email"].(string),
-		},
-		Items: &[]midtrans.ItemDetail{
-			midtrans.ItemDetail{
-				ID:    snapReqData["project"].(map[string]interface{})["id"].(string),
-				Price: snapReqData["transaction"].(map[string]interface{})["grossAmt"].(int64),
-				Qty:   1,
-				Name:  snapReqData["project"].(map[string]interface{})["name"].(string),
-			},
-		},
+	return nil
+}
+
+func (s *service) GetTransactionStatus(input NotificationInput) string {
+	switch input.TransactionStatus {
+	case "capture":
+		// Card payments flagged by the fraud detection system stay pending until reviewed on the dashboard
+		if input.FraudStatus == "challenge" {
+			return "pending"
+		}
+
+		if input.FraudStatus == "deny" {
+			return "failed"
+		}
+
+		return "paid"
+	case "settlement":
+		return "paid"
+	case "pending":
+		return "pending"
+	case "deny":
+		return "failed"
+	case "cancel":
+		return "cancelled"
+	case "expire":
+		return "expired"
+	case "refund":
+		return "refunded"
+	case "partial_refund":
+		return "partially_refunded"
 	}
 
-	snapTokenResp, err := snapGateway.GetToken(snapReq)
+	return ""
+}
+
+func (s *service) SimulateNotification(orderID string, transactionStatus string) (NotificationInput, error) {
+	simulator, ok := s.gateway.(NotificationSimulator)
+
+	if !ok {
+		return NotificationInput{}, errors.New("The configured payment gateway can't simulate notifications.")
+	}
+
+	notification, err := simulator.SimulateNotification(orderID, transactionStatus)
 
 	if err != nil {
-		return snapTokenResp, err
+		return notification, err
 	}
 
-	return snapTokenResp, nil
+	return notification, nil
+}
+
+// Midtrans signs every notification with SHA512(order_id + status_code + gross_amount + server key)
+func signNotification(orderID string, statusCode string, grossAmount string, serverKey string) string {
+	hash := sha512.Sum512([]byte(orderID + statusCode + grossAmount + serverKey))
+
+	return hex.EncodeToString(hash[:])
 }
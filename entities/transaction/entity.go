@@ -7,15 +7,39 @@ import (
 )
 
 type Transaction struct {
-	ID         int
-	CampaignID int
-	UserID     int
-	Amount     int
-	Status     string
-	Code       string
-	PaymentURL string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-	Campaign   campaign.Campaign
-	User       user.User
+	ID              int
+	CampaignID      int
+	UserID          int
+	RewardID        *int
+	Amount          int
+	RefundedAmount  int
+	Status          Status
+	Code            string
+	PaymentURL      string
+	ShippingAddress string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Campaign        campaign.Campaign
+	User            user.User
+}
+
+type TransactionStatusHistory struct {
+	ID            int
+	TransactionID int
+	OldStatus     Status
+	NewStatus     Status
+	Actor         Actor
+	Reason        string
+	CreatedAt     time.Time
+}
+
+type Refund struct {
+	ID            int
+	TransactionID int
+	UserID        *int
+	Amount        int
+	Reason        string
+	RefundKey     string
+	Status        RefundStatus
+	CreatedAt     time.Time
 }
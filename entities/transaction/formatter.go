@@ -5,14 +5,16 @@ import (
 )
 
 type TransactionFormat struct {
-	ID         int                       `json:"id"`
-	Amount     int                       `json:"amount"`
-	Status     string                    `json:"status"`
-	Code       string                    `json:"code"`
-	PaymentURL string                    `json:"payment_url"`
-	Campaign   CampaignTransactionFormat `json:"campaign"`
-	User       UserTransactionFormat     `json:"user"`
-	CreatedAt  time.Time                 `json:"created_at"`
+	ID             int                       `json:"id"`
+	RewardID       *int                      `json:"reward_id"`
+	Amount         int                       `json:"amount"`
+	RefundedAmount int                       `json:"refunded_amount"`
+	Status         string                    `json:"status"`
+	Code           string                    `json:"code"`
+	PaymentURL     string                    `json:"payment_url"`
+	Campaign       CampaignTransactionFormat `json:"campaign"`
+	User           UserTransactionFormat     `json:"user"`
+	CreatedAt      time.Time                 `json:"created_at"`
 }
 
 type CampaignTransactionFormat struct {
@@ -29,11 +31,13 @@ type UserTransactionFormat struct {
 
 func FormatTransaction(transaction Transaction) TransactionFormat {
 	return TransactionFormat{
-		ID:         transaction.ID,
-		Amount:     transaction.Amount,
-		Status:     transaction.Status,
-		Code:       transaction.Code,
-		PaymentURL: transaction.PaymentURL,
+		ID:             transaction.ID,
+		RewardID:       transaction.RewardID,
+		Amount:         transaction.Amount,
+		RefundedAmount: transaction.RefundedAmount,
+		Status:         string(transaction.Status),
+		Code:           transaction.Code,
+		PaymentURL:     transaction.PaymentURL,
 		Campaign: CampaignTransactionFormat{
 			ID:        transaction.Campaign.ID,
 			Name:      transaction.Campaign.Name,
@@ -47,3 +51,59 @@ func FormatTransaction(transaction Transaction) TransactionFormat {
 		CreatedAt: transaction.CreatedAt,
 	}
 }
+
+type TransactionStatusHistoryFormat struct {
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	Actor     string    `json:"actor"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func FormatTransactionStatusHistories(histories []TransactionStatusHistory) []TransactionStatusHistoryFormat {
+	formattedHistories := []TransactionStatusHistoryFormat{}
+
+	for _, history := range histories {
+		formattedHistories = append(formattedHistories, TransactionStatusHistoryFormat{
+			OldStatus: string(history.OldStatus),
+			NewStatus: string(history.NewStatus),
+			Actor:     string(history.Actor),
+			Reason:    history.Reason,
+			CreatedAt: history.CreatedAt,
+		})
+	}
+
+	return formattedHistories
+}
+
+type RefundFormat struct {
+	ID        int       `json:"id"`
+	Amount    int       `json:"amount"`
+	Reason    string    `json:"reason"`
+	RefundKey string    `json:"refund_key"`
+	Status    string    `json:"status"`
+	UserID    *int      `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func FormatRefund(refund Refund) RefundFormat {
+	return RefundFormat{
+		ID:        refund.ID,
+		Amount:    refund.Amount,
+		Reason:    refund.Reason,
+		RefundKey: refund.RefundKey,
+		Status:    string(refund.Status),
+		UserID:    refund.UserID,
+		CreatedAt: refund.CreatedAt,
+	}
+}
+
+func FormatRefunds(refunds []Refund) []RefundFormat {
+	formattedRefunds := []RefundFormat{}
+
+	for _, refund := range refunds {
+		formattedRefunds = append(formattedRefunds, FormatRefund(refund))
+	}
+
+	return formattedRefunds
+}
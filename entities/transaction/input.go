@@ -1,11 +1,30 @@
 package transaction
 
+import "bwastartup/helpers"
+
 type GetTransactionByIDInput struct {
 	ID int `uri:"transaction_id" binding:"required"`
 }
 
 type TransactionInput struct {
-	CampaignID int
-	UserID     int
-	Amount     int `json:"amount" binding:"required"`
+	CampaignID      int
+	UserID          int
+	Amount          int    `json:"amount" binding:"required"`
+	RewardID        *int   `json:"reward_id" binding:"omitempty,min=1"`
+	ShippingAddress string `json:"shipping_address"`
+}
+
+type RefundInput struct {
+	UserID int
+	Actor  Actor
+	Amount int    `json:"amount" binding:"required,min=1"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+type GetTransactionsInput struct {
+	helpers.PaginationInput
+	Status     string `form:"status" binding:"omitempty,oneof=pending paid failed expired cancelled refunded partially_refunded"`
+	Sort       string `form:"sort" binding:"omitempty,oneof=newest oldest highest_amount lowest_amount"`
+	UserID     int    `form:"-"`
+	CampaignID int    `form:"-"`
 }
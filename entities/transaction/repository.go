@@ -1,17 +1,29 @@
 package transaction
 
 import (
+	"bwastartup/entities/campaign"
+	"fmt"
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
 	Save(transaction Transaction) (Transaction, error)
 	Update(transaction Transaction) (Transaction, error)
-	All() ([]Transaction, error)
+	All(input GetTransactionsInput) ([]Transaction, int64, error)
 	AllByRef(id int, field string) ([]Transaction, error)
 	Get(id int) (Transaction, error)
-	Verify(transaction Transaction) (Transaction, error)
-	CalculateCampaignStats(campaignID int) (currentAmount int, backerCount int64, err error)
+	GetByCode(code string) (Transaction, error)
+	UpdateStatus(transaction Transaction, history TransactionStatusHistory) (Transaction, error)
+	AllStatusHistories(transactionID int) ([]TransactionStatusHistory, error)
+	ReserveRefund(refund Refund) (Refund, error)
+	ReleaseRefund(refund Refund) error
+	CompleteRefund(refund Refund, actor Actor, reason string) (Transaction, Refund, error)
+	AllRefunds(transactionID int) ([]Refund, error)
+	RecalculateCampaignStats(campaignID int) (currentAmount int, backerCount int64, err error)
+	AllCampaignIDs() ([]int, error)
 }
 
 type repository struct {
@@ -23,7 +35,15 @@ func NewRepository(db *gorm.DB) Repository {
 }
 
 func (r *repository) Save(transaction Transaction) (Transaction, error) {
-	err := r.db.Create(&transaction).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if transaction.RewardID != nil {
+			if err := claimReward(tx, *transaction.RewardID, transaction.CampaignID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&transaction).Error
+	})
 
 	if err != nil {
 		return transaction, err
@@ -42,17 +62,56 @@ func (r *repository) Update(transaction Transaction) (Transaction, error) {
 	return transaction, nil
 }
 
-func (r *repository) All() ([]Transaction, error) {
+func (r *repository) All(input GetTransactionsInput) ([]Transaction, int64, error) {
 	var transactions []Transaction
+	var total int64
+
+	query := r.db.Model(&Transaction{})
+
+	if input.UserID > 0 {
+		query = query.Where("user_id = ?", input.UserID)
+	}
+
+	if input.CampaignID > 0 {
+		query = query.Where("campaign_id = ?", input.CampaignID)
+	}
+
+	if input.Status != "" {
+		query = query.Where("status = ?", input.Status)
+	}
 
-	err := r.db.Preload("Campaign").Preload("User").Find(&transactions).Error
+	// A new session lets the filtered query be reused for both the count and the page
+	query = query.Session(&gorm.Session{})
+
+	if err := query.Count(&total).Error; err != nil {
+		return transactions, total, err
+	}
+
+	err := query.Preload("Campaign").Preload("User").
+		Order(transactionSortOrder(input.Sort)).
+		Order("id desc").
+		Limit(input.GetLimit()).
+		Offset(input.GetOffset()).
+		Find(&transactions).Error
 
 	if err != nil {
-		return transactions, err
+		return transactions, total, err
 	}
 
-	return transactions, nil
+	return transactions, total, nil
+}
+
+func transactionSortOrder(sort string) string {
+	switch sort {
+	case "oldest":
+		return "created_at asc"
+	case "highest_amount":
+		return "amount desc"
+	case "lowest_amount":
+		return "amount asc"
+	}
 
+	return "created_at desc"
 }
 
 func (r *repository) AllByRef(id int, field string) ([]Transaction, error) {
@@ -79,8 +138,56 @@ func (r *repository) Get(id int) (Transaction, error) {
 	return transaction, nil
 }
 
-func (r *repository) Verify(transaction Transaction) (Transaction, error) {
-	err := r.db.Save(&transaction).Error
+func (r *repository) GetByCode(code string) (Transaction, error) {
+	var transaction Transaction
+
+	err := r.db.Where("code = ?", code).Preload("Campaign").Preload("User").Find(&transaction).Error
+
+	if err != nil {
+		return transaction, err
+	}
+
+	return transaction, nil
+}
+
+func (r *repository) UpdateStatus(transaction Transaction, history TransactionStatusHistory) (Transaction, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Only move the row if nobody else changed its status in the meantime
+		newValues := map[string]interface{}{"status": history.NewStatus, "updated_at": transaction.UpdatedAt}
+
+		// Refunds made outside of our API (e.g. on the Midtrans dashboard) only tell us the whole amount went back
+		if history.NewStatus == StatusRefunded {
+			newValues["refunded_amount"] = gorm.Expr("amount")
+		}
+
+		result := tx.Model(&Transaction{}).
+			Where("id = ? AND status = ?", transaction.ID, history.OldStatus).
+			Updates(newValues)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w, transaction is no longer %s", ErrInvalidStatusTransition, history.OldStatus)
+		}
+
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+
+		if err := releaseRewardIfDropped(tx, transaction, history); err != nil {
+			return err
+		}
+
+		if history.OldStatus.IsSettled() || history.NewStatus.IsSettled() {
+			_, _, err := recalculateCampaignStats(tx, transaction.CampaignID)
+
+			return err
+		}
+
+		return nil
+	})
 
 	if err != nil {
 		return transaction, err
@@ -89,25 +196,274 @@ func (r *repository) Verify(transaction Transaction) (Transaction, error) {
 	return transaction, nil
 }
 
-func (r *repository) CalculateCampaignStats(campaignID int) (currentAmount int, backerCount int64, err error) {
-	err = r.db.Model(&Transaction{}).Where("campaign_id = ?", campaignID).Count(&backerCount).Error
+func (r *repository) AllStatusHistories(transactionID int) ([]TransactionStatusHistory, error) {
+	var histories []TransactionStatusHistory
+
+	err := r.db.Where("transaction_id = ?", transactionID).Order("created_at asc, id asc").Find(&histories).Error
+
+	if err != nil {
+		return histories, err
+	}
+
+	return histories, nil
+}
+
+// ReserveRefund stores the refund as pending while the transaction row is locked, pending refunds count towards
+// the refunded amount so concurrent refunds can't reserve more than was paid
+func (r *repository) ReserveRefund(refund Refund) (Refund, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		lockedTransaction, err := lockTransaction(tx, refund.TransactionID)
+
+		if err != nil {
+			return err
+		}
+
+		if !lockedTransaction.Status.IsSettled() {
+			return fmt.Errorf("%w from %s to %s", ErrInvalidStatusTransition, lockedTransaction.Status, StatusPartiallyRefunded)
+		}
+
+		var pendingAmount int
+
+		err = tx.Model(&Refund{}).
+			Select("coalesce(sum(amount), 0)").
+			Where("transaction_id = ? AND status = ?", refund.TransactionID, RefundStatusPending).
+			Scan(&pendingAmount).Error
+
+		if err != nil {
+			return err
+		}
+
+		if lockedTransaction.RefundedAmount+pendingAmount+refund.Amount > lockedTransaction.Amount {
+			return ErrRefundExceedsAmount
+		}
+
+		return tx.Create(&refund).Error
+	})
+
+	if err != nil {
+		return refund, err
+	}
+
+	return refund, nil
+}
+
+func (r *repository) ReleaseRefund(refund Refund) error {
+	err := r.db.Model(&Refund{}).Where("id = ? AND status = ?", refund.ID, RefundStatusPending).Update("status", RefundStatusFailed).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CompleteRefund books the money of a refund the gateway paid out. A refund that isn't stored yet (e.g. one made on
+// the Midtrans dashboard) is created, one that is already completed is left alone so notifications can repeat
+func (r *repository) CompleteRefund(refund Refund, actor Actor, reason string) (Transaction, Refund, error) {
+	var lockedTransaction Transaction
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		lockedTransaction, err = lockTransaction(tx, refund.TransactionID)
+
+		if err != nil {
+			return err
+		}
+
+		var storedRefund Refund
+
+		if err := tx.Where("refund_key = ?", refund.RefundKey).Find(&storedRefund).Error; err != nil {
+			return err
+		}
+
+		if storedRefund.ID > 0 {
+			refund = storedRefund
+		}
+
+		if refund.Status == RefundStatusCompleted {
+			return nil
+		}
+
+		refundedAmount := lockedTransaction.RefundedAmount + refund.Amount
+
+		if refundedAmount > lockedTransaction.Amount {
+			return ErrRefundExceedsAmount
+		}
+
+		history := TransactionStatusHistory{
+			TransactionID: lockedTransaction.ID,
+			OldStatus:     lockedTransaction.Status,
+			NewStatus:     refundedStatus(lockedTransaction.Amount, refundedAmount),
+			Actor:         actor,
+			Reason:        reason,
+			CreatedAt:     time.Now(),
+		}
+
+		if err := checkTransition(history.OldStatus, history.NewStatus); err != nil {
+			return err
+		}
+
+		refund.Status = RefundStatusCompleted
+
+		if refund.ID > 0 {
+			err = tx.Model(&refund).Update("status", refund.Status).Error
+		} else {
+			err = tx.Create(&refund).Error
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&lockedTransaction).Updates(map[string]interface{}{
+			"status":          history.NewStatus,
+			"refunded_amount": refundedAmount,
+			"updated_at":      history.CreatedAt,
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		lockedTransaction.Status = history.NewStatus
+		lockedTransaction.RefundedAmount = refundedAmount
+		lockedTransaction.UpdatedAt = history.CreatedAt
+
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+
+		if err := releaseRewardIfDropped(tx, lockedTransaction, history); err != nil {
+			return err
+		}
+
+		_, _, err = recalculateCampaignStats(tx, lockedTransaction.CampaignID)
+
+		return err
+	})
+
+	if err != nil {
+		return lockedTransaction, refund, err
+	}
+
+	return lockedTransaction, refund, nil
+}
+
+func (r *repository) AllRefunds(transactionID int) ([]Refund, error) {
+	var refunds []Refund
+
+	err := r.db.Where("transaction_id = ?", transactionID).Order("created_at asc, id asc").Find(&refunds).Error
+
+	if err != nil {
+		return refunds, err
+	}
+
+	return refunds, nil
+}
+
+func (r *repository) RecalculateCampaignStats(campaignID int) (currentAmount int, backerCount int64, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		currentAmount, backerCount, err = recalculateCampaignStats(tx, campaignID)
+
+		return err
+	})
 
 	if err != nil {
 		return currentAmount, backerCount, err
 	}
 
-	var trx Transaction
+	return currentAmount, backerCount, nil
+}
+
+func (r *repository) AllCampaignIDs() ([]int, error) {
+	var campaignIDs []int
+
+	err := r.db.Model(&campaign.Campaign{}).Order("id asc").Pluck("id", &campaignIDs).Error
+
+	if err != nil {
+		return campaignIDs, err
+	}
+
+	return campaignIDs, nil
+}
+
+// lockTransaction reads the transaction row and keeps it locked until the DB transaction ends
+func lockTransaction(tx *gorm.DB, transactionID int) (Transaction, error) {
+	var lockedTransaction Transaction
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", transactionID).Take(&lockedTransaction).Error
+
+	if err != nil {
+		return lockedTransaction, err
+	}
+
+	return lockedTransaction, nil
+}
+
+// claimReward takes one unit of a reward, the conditional update lets concurrent pledges race for the last units safely
+func claimReward(tx *gorm.DB, rewardID int, campaignID int) error {
+	result := tx.Model(&campaign.CampaignReward{}).
+		Where("id = ? AND campaign_id = ? AND (quantity IS NULL OR claimed_count < quantity)", rewardID, campaignID).
+		Update("claimed_count", gorm.Expr("claimed_count + 1"))
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrRewardUnavailable
+	}
+
+	return nil
+}
 
-	err = r.db.Model(&Transaction{}).Where("campaign_id = ?", campaignID).Select("sum(amount) as amount").Scan(&trx).Error
+// releaseRewardIfDropped gives the reward unit back once a transaction will never be paid or got its money back
+func releaseRewardIfDropped(tx *gorm.DB, transaction Transaction, history TransactionStatusHistory) error {
+	if transaction.RewardID == nil || !history.OldStatus.HoldsReward() || history.NewStatus.HoldsReward() {
+		return nil
+	}
+
+	return tx.Model(&campaign.CampaignReward{}).
+		Where("id = ? AND claimed_count > 0", *transaction.RewardID).
+		Update("claimed_count", gorm.Expr("claimed_count - 1")).Error
+}
+
+// recalculateCampaignStats must run inside a DB transaction, the campaign row stays locked until it commits
+func recalculateCampaignStats(tx *gorm.DB, campaignID int) (currentAmount int, backerCount int64, err error) {
+	var lockedCampaign campaign.Campaign
+
+	// Concurrent pledges to the same campaign wait here, so each one sums up the previous ones
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", campaignID).Take(&lockedCampaign).Error
 
 	if err != nil {
 		return currentAmount, backerCount, err
 	}
 
-	currentAmount = trx.Amount
+	var stats struct {
+		CurrentAmount int
+		BackersCount  int64
+	}
 
-	// fmt.Printf("Current amount: %d\nBacker count: %d\n", currentAmount, backerCount)
+	err = tx.Model(&Transaction{}).
+		Select("coalesce(sum(amount - refunded_amount), 0) as current_amount, count(distinct user_id) as backers_count").
+		Where("campaign_id = ? AND status IN ?", campaignID, settledStatuses()).
+		Scan(&stats).Error
 
-	return currentAmount, backerCount, nil
+	if err != nil {
+		return currentAmount, backerCount, err
+	}
+
+	// Updates with a map so zero values are written too
+	err = tx.Model(&campaign.Campaign{}).Where("id = ?", campaignID).Updates(map[string]interface{}{
+		"current_amount": stats.CurrentAmount,
+		"backers_count":  stats.BackersCount,
+		"updated_at":     time.Now(),
+	}).Error
+
+	if err != nil {
+		return currentAmount, backerCount, err
+	}
 
+	return stats.CurrentAmount, stats.BackersCount, nil
 }
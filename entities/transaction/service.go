@@ -1,6 +1,11 @@
 package transaction
 
 import (
+	"bwastartup/entities/payment"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/dchest/uniuri"
@@ -9,30 +14,42 @@ import (
 type Service interface {
 	CreateTransaction(transactionInput TransactionInput) (Transaction, error)
 	UpdateTransaction(transaction Transaction) (Transaction, error)
-	GetAllTransactions() ([]Transaction, error)
+	GetAllTransactions(input GetTransactionsInput) ([]Transaction, int64, error)
 	GetAllTransactionsByRef(id int, field string) ([]Transaction, error)
 	GetTransactionByID(id int) (Transaction, error)
+	GetTransactionByCode(code string) (Transaction, error)
+	TransitionStatus(transaction Transaction, status Status, actor Actor, reason string) (Transaction, error)
+	GetStatusHistories(transactionID int) ([]TransactionStatusHistory, error)
 	VerifyTransaction(transaction Transaction) (Transaction, error)
-	GetNewCampaignStats(campaignID int) (currentAmount int, backerCount int64, err error)
+	RefundTransaction(transaction Transaction, input RefundInput) (Transaction, Refund, error)
+	RefundRemaining(transaction Transaction, actor Actor, reason string) (Transaction, error)
+	RecordGatewayRefunds(transaction Transaction, refunds []payment.NotificationRefund, reason string) (Transaction, error)
+	CancelTransaction(transaction Transaction, actor Actor, reason string) (Transaction, error)
+	GetRefunds(transactionID int) ([]Refund, error)
+	RecalculateCampaignStats(campaignID int) (currentAmount int, backerCount int64, err error)
+	RecalculateAllCampaignStats() error
 }
 
 type service struct {
-	repository Repository
+	repository     Repository
+	paymentService payment.Service
 }
 
-func NewService(repository Repository) Service {
-	return &service{repository}
+func NewService(repository Repository, paymentService payment.Service) Service {
+	return &service{repository, paymentService}
 }
 
 func (s *service) CreateTransaction(transactionInput TransactionInput) (Transaction, error) {
 	transaction := Transaction{
-		CampaignID: transactionInput.CampaignID,
-		UserID:     transactionInput.UserID,
-		Amount:     transactionInput.Amount,
-		Status:     "pending",
-		Code:       uniuri.New(),
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+		CampaignID:      transactionInput.CampaignID,
+		UserID:          transactionInput.UserID,
+		RewardID:        transactionInput.RewardID,
+		Amount:          transactionInput.Amount,
+		Status:          StatusPending,
+		Code:            uniuri.New(),
+		ShippingAddress: transactionInput.ShippingAddress,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
 	}
 
 	createdTransaction, err := s.repository.Save(transaction)
@@ -54,14 +71,14 @@ func (s *service) UpdateTransaction(transaction Transaction) (Transaction, error
 	return updatedTransaction, nil
 }
 
-func (s *service) GetAllTransactions() ([]Transaction, error) {
-	transactions, err := s.repository.All()
+func (s *service) GetAllTransactions(input GetTransactionsInput) ([]Transaction, int64, error) {
+	transactions, total, err := s.repository.All(input)
 
 	if err != nil {
-		return transactions, err
+		return transactions, total, err
 	}
 
-	return transactions, nil
+	return transactions, total, nil
 }
 
 func (s *service) GetAllTransactionsByRef(id int, field string) ([]Transaction, error) {
@@ -84,21 +101,234 @@ func (s *service) GetTransactionByID(id int) (Transaction, error) {
 	return foundTransaction, nil
 }
 
+func (s *service) GetTransactionByCode(code string) (Transaction, error) {
+	foundTransaction, err := s.repository.GetByCode(code)
+
+	if err != nil {
+		return foundTransaction, err
+	}
+
+	return foundTransaction, nil
+}
+
+func (s *service) TransitionStatus(transaction Transaction, status Status, actor Actor, reason string) (Transaction, error) {
+	if err := checkTransition(transaction.Status, status); err != nil {
+		return transaction, err
+	}
+
+	history := TransactionStatusHistory{
+		TransactionID: transaction.ID,
+		OldStatus:     transaction.Status,
+		NewStatus:     status,
+		Actor:         actor,
+		Reason:        reason,
+		CreatedAt:     time.Now(),
+	}
+
+	transaction.Status = status
+	transaction.UpdatedAt = history.CreatedAt
+
+	updatedTransaction, err := s.repository.UpdateStatus(transaction, history)
+
+	if err != nil {
+		return updatedTransaction, err
+	}
+
+	return updatedTransaction, nil
+}
+
+func (s *service) GetStatusHistories(transactionID int) ([]TransactionStatusHistory, error) {
+	histories, err := s.repository.AllStatusHistories(transactionID)
+
+	if err != nil {
+		return histories, err
+	}
+
+	return histories, nil
+}
+
 func (s *service) VerifyTransaction(transaction Transaction) (Transaction, error) {
-	transaction.Status = "paid"
-	transaction.UpdatedAt = time.Now()
+	return s.TransitionStatus(transaction, StatusPaid, ActorAdmin, "Manually verified")
+}
+
+// RefundTransaction reserves the amount before asking the gateway for the money, so concurrent refunds can never
+// give back more than was paid, and completes the refund once the gateway agreed
+func (s *service) RefundTransaction(transaction Transaction, input RefundInput) (Transaction, Refund, error) {
+	refundedAmount := transaction.RefundedAmount + input.Amount
+
+	if refundedAmount > transaction.Amount {
+		return transaction, Refund{}, ErrRefundExceedsAmount
+	}
+
+	if err := checkTransition(transaction.Status, refundedStatus(transaction.Amount, refundedAmount)); err != nil {
+		return transaction, Refund{}, err
+	}
+
+	refund := Refund{
+		TransactionID: transaction.ID,
+		Amount:        input.Amount,
+		Reason:        input.Reason,
+		RefundKey:     fmt.Sprintf("%s-%s", transaction.Code, uniuri.NewLen(8)),
+		Status:        RefundStatusPending,
+		CreatedAt:     time.Now(),
+	}
+
+	// Refunds issued by scheduled jobs have no user behind them
+	if input.UserID > 0 {
+		refund.UserID = &input.UserID
+	}
+
+	reservedRefund, err := s.repository.ReserveRefund(refund)
+
+	if err != nil {
+		return transaction, reservedRefund, err
+	}
+
+	_, err = s.paymentService.Refund(transaction.Code, payment.RefundRequest{RefundKey: refund.RefundKey, Amount: int64(refund.Amount), Reason: refund.Reason})
+
+	if err != nil {
+		// A refund notification for this key still completes it, in case the gateway paid out after all
+		if releaseErr := s.repository.ReleaseRefund(reservedRefund); releaseErr != nil {
+			log.Printf("Unable to release refund %s: %v\n", reservedRefund.RefundKey, releaseErr)
+		}
+
+		return transaction, reservedRefund, err
+	}
+
+	// When this fails the refund stays pending and keeps holding its amount until a notification completes it
+	refundedTransaction, completedRefund, err := s.repository.CompleteRefund(reservedRefund, input.Actor, input.Reason)
+
+	if err != nil {
+		return transaction, completedRefund, err
+	}
+
+	transaction.Status = refundedTransaction.Status
+	transaction.RefundedAmount = refundedTransaction.RefundedAmount
+	transaction.UpdatedAt = refundedTransaction.UpdatedAt
+
+	return transaction, completedRefund, nil
+}
+
+// RefundRemaining gives back whatever of a settled transaction is neither refunded nor held by a pending refund yet
+func (s *service) RefundRemaining(transaction Transaction, actor Actor, reason string) (Transaction, error) {
+	refunds, err := s.repository.AllRefunds(transaction.ID)
+
+	if err != nil {
+		return transaction, err
+	}
+
+	remaining := transaction.Amount - transaction.RefundedAmount
+
+	for _, refund := range refunds {
+		if refund.Status == RefundStatusPending {
+			remaining -= refund.Amount
+		}
+	}
+
+	if remaining <= 0 {
+		return transaction, nil
+	}
+
+	refundedTransaction, _, err := s.RefundTransaction(transaction, RefundInput{Actor: actor, Amount: remaining, Reason: reason})
+
+	if err != nil {
+		return transaction, err
+	}
+
+	return refundedTransaction, nil
+}
+
+// RecordGatewayRefunds books the refunds of a refund notification, e.g. ones made on the Midtrans dashboard.
+// Every refund is checked before any is stored, the status of a transaction always follows its refunded amount
+func (s *service) RecordGatewayRefunds(transaction Transaction, notificationRefunds []payment.NotificationRefund, reason string) (Transaction, error) {
+	if len(notificationRefunds) == 0 {
+		return transaction, fmt.Errorf("%w, the notification lists no refunds", ErrInvalidGatewayRefund)
+	}
+
+	refunds := []Refund{}
+
+	for _, notificationRefund := range notificationRefunds {
+		amount, err := strconv.ParseFloat(notificationRefund.RefundAmount, 64)
+
+		if err != nil || amount <= 0 || amount != math.Trunc(amount) {
+			return transaction, fmt.Errorf("%w, unreadable refund amount %q", ErrInvalidGatewayRefund, notificationRefund.RefundAmount)
+		}
+
+		// Refunds made on the dashboard may come without the key we'd have given them
+		refundKey := notificationRefund.RefundKey
+
+		if refundKey == "" && notificationRefund.RefundChargebackID > 0 {
+			refundKey = fmt.Sprintf("midtrans-%d", notificationRefund.RefundChargebackID)
+		}
+
+		if refundKey == "" {
+			return transaction, fmt.Errorf("%w, refund without a key", ErrInvalidGatewayRefund)
+		}
+
+		refundReason := notificationRefund.Reason
+
+		if refundReason == "" {
+			refundReason = reason
+		}
+
+		refunds = append(refunds, Refund{
+			TransactionID: transaction.ID,
+			Amount:        int(amount),
+			Reason:        refundReason,
+			RefundKey:     refundKey,
+			Status:        RefundStatusPending,
+			CreatedAt:     time.Now(),
+		})
+	}
+
+	for _, refund := range refunds {
+		refundedTransaction, _, err := s.repository.CompleteRefund(refund, ActorWebhook, reason)
+
+		if err != nil {
+			return transaction, err
+		}
+
+		transaction.Status = refundedTransaction.Status
+		transaction.RefundedAmount = refundedTransaction.RefundedAmount
+		transaction.UpdatedAt = refundedTransaction.UpdatedAt
+	}
+
+	return transaction, nil
+}
 
-	verifiedTransaction, err := s.repository.Verify(transaction)
+func (s *service) CancelTransaction(transaction Transaction, actor Actor, reason string) (Transaction, error) {
+	if err := checkTransition(transaction.Status, StatusCancelled); err != nil {
+		return transaction, err
+	}
+
+	// Void the payment on the gateway first so the backer can no longer complete it
+	_, err := s.paymentService.Cancel(transaction.Code)
 
 	if err != nil {
-		return verifiedTransaction, err
+		return transaction, err
 	}
 
-	return verifiedTransaction, nil
+	cancelledTransaction, err := s.TransitionStatus(transaction, StatusCancelled, actor, reason)
+
+	if err != nil {
+		return cancelledTransaction, err
+	}
+
+	return cancelledTransaction, nil
 }
 
-func (s *service) GetNewCampaignStats(campaignID int) (currentAmount int, backerCount int64, err error) {
-	currentAmount, backerCount, err = s.repository.CalculateCampaignStats(campaignID)
+func (s *service) GetRefunds(transactionID int) ([]Refund, error) {
+	refunds, err := s.repository.AllRefunds(transactionID)
+
+	if err != nil {
+		return refunds, err
+	}
+
+	return refunds, nil
+}
+
+func (s *service) RecalculateCampaignStats(campaignID int) (currentAmount int, backerCount int64, err error) {
+	currentAmount, backerCount, err = s.repository.RecalculateCampaignStats(campaignID)
 
 	if err != nil {
 		return currentAmount, backerCount, err
@@ -106,3 +336,20 @@ func (s *service) GetNewCampaignStats(campaignID int) (currentAmount int, backer
 
 	return currentAmount, backerCount, nil
 }
+
+func (s *service) RecalculateAllCampaignStats() error {
+	campaignIDs, err := s.repository.AllCampaignIDs()
+
+	if err != nil {
+		return err
+	}
+
+	// One DB transaction per campaign, so a long run never holds every campaign lock at once
+	for _, campaignID := range campaignIDs {
+		if _, _, err := s.repository.RecalculateCampaignStats(campaignID); err != nil {
+			return fmt.Errorf("Unable to recalculate stats of campaign %d: %w", campaignID, err)
+		}
+	}
+
+	return nil
+}
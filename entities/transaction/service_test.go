@@ -0,0 +1,214 @@
+package transaction
+
+import (
+	"bwastartup/entities/payment"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// refundRepository books refunds in memory the way ReserveRefund and CompleteRefund do, without the locking
+type refundRepository struct {
+	Repository
+	transaction Transaction
+	refunds     []Refund
+	reserved    []Refund
+}
+
+func (r *refundRepository) ReserveRefund(refund Refund) (Refund, error) {
+	heldAmount := r.transaction.RefundedAmount + refund.Amount
+
+	for _, reserved := range r.reserved {
+		heldAmount += reserved.Amount
+	}
+
+	if heldAmount > r.transaction.Amount {
+		return refund, ErrRefundExceedsAmount
+	}
+
+	r.reserved = append(r.reserved, refund)
+
+	return refund, nil
+}
+
+func (r *refundRepository) AllRefunds(transactionID int) ([]Refund, error) {
+	return append(append([]Refund{}, r.refunds...), r.reserved...), nil
+}
+
+func (r *refundRepository) CompleteRefund(refund Refund, actor Actor, reason string) (Transaction, Refund, error) {
+	for _, completed := range r.refunds {
+		if completed.RefundKey == refund.RefundKey {
+			return r.transaction, completed, nil
+		}
+	}
+
+	refundedAmount := r.transaction.RefundedAmount + refund.Amount
+
+	if refundedAmount > r.transaction.Amount {
+		return r.transaction, refund, ErrRefundExceedsAmount
+	}
+
+	status := refundedStatus(r.transaction.Amount, refundedAmount)
+
+	if err := checkTransition(r.transaction.Status, status); err != nil {
+		return r.transaction, refund, err
+	}
+
+	for i, reserved := range r.reserved {
+		if reserved.RefundKey == refund.RefundKey {
+			r.reserved = append(r.reserved[:i], r.reserved[i+1:]...)
+
+			break
+		}
+	}
+
+	refund.Status = RefundStatusCompleted
+	r.refunds = append(r.refunds, refund)
+	r.transaction.Status = status
+	r.transaction.RefundedAmount = refundedAmount
+
+	return r.transaction, refund, nil
+}
+
+func TestRecordGatewayRefunds(t *testing.T) {
+	tests := []struct {
+		name               string
+		refunds            []payment.NotificationRefund
+		wantErr            error
+		wantStatus         Status
+		wantRefundedAmount int
+		wantKeys           []string
+	}{
+		{
+			"partial refund",
+			[]payment.NotificationRefund{{RefundKey: "refund-1", RefundAmount: "40000.00"}},
+			nil, StatusPartiallyRefunded, 40000, []string{"refund-1"},
+		},
+		{
+			"refunds adding up to the whole amount",
+			[]payment.NotificationRefund{{RefundKey: "refund-1", RefundAmount: "40000.00"}, {RefundChargebackID: 77, RefundAmount: "60000"}},
+			nil, StatusRefunded, 100000, []string{"refund-1", "midtrans-77"},
+		},
+		{
+			"refund repeated by a later notification",
+			[]payment.NotificationRefund{{RefundKey: "refund-1", RefundAmount: "40000"}, {RefundKey: "refund-1", RefundAmount: "40000"}},
+			nil, StatusPartiallyRefunded, 40000, []string{"refund-1"},
+		},
+		{
+			"more than was paid",
+			[]payment.NotificationRefund{{RefundKey: "refund-1", RefundAmount: "150000"}},
+			ErrRefundExceedsAmount, StatusPaid, 0, nil,
+		},
+		{"no refunds listed", nil, ErrInvalidGatewayRefund, StatusPaid, 0, nil},
+		{"fractional amount", []payment.NotificationRefund{{RefundKey: "refund-1", RefundAmount: "100.50"}}, ErrInvalidGatewayRefund, StatusPaid, 0, nil},
+		{"negative amount", []payment.NotificationRefund{{RefundKey: "refund-1", RefundAmount: "-100"}}, ErrInvalidGatewayRefund, StatusPaid, 0, nil},
+		{"unreadable amount", []payment.NotificationRefund{{RefundKey: "refund-1", RefundAmount: "lots"}}, ErrInvalidGatewayRefund, StatusPaid, 0, nil},
+		{"refund without a key", []payment.NotificationRefund{{RefundAmount: "100"}}, ErrInvalidGatewayRefund, StatusPaid, 0, nil},
+		{
+			// Nothing is booked when any refund of the notification is invalid
+			"invalid refund after a valid one",
+			[]payment.NotificationRefund{{RefundKey: "refund-1", RefundAmount: "40000"}, {RefundKey: "refund-2", RefundAmount: "lots"}},
+			ErrInvalidGatewayRefund, StatusPaid, 0, nil,
+		},
+	}
+
+	for _, tt := range tests {
+		transaction := Transaction{ID: 1, Amount: 100000, Status: StatusPaid}
+		repository := &refundRepository{transaction: transaction}
+		s := &service{repository: repository}
+
+		updatedTransaction, err := s.RecordGatewayRefunds(transaction, tt.refunds, "Refunded on the Midtrans dashboard")
+
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: RecordGatewayRefunds returned %v, want %v", tt.name, err, tt.wantErr)
+
+			continue
+		}
+
+		if tt.wantErr == nil && (updatedTransaction.Status != tt.wantStatus || updatedTransaction.RefundedAmount != tt.wantRefundedAmount) {
+			t.Errorf("%s: transaction is %s with %d refunded, want %s with %d", tt.name, updatedTransaction.Status, updatedTransaction.RefundedAmount, tt.wantStatus, tt.wantRefundedAmount)
+		}
+
+		if len(repository.refunds) != len(tt.wantKeys) {
+			t.Errorf("%s: booked %d refunds, want %d", tt.name, len(repository.refunds), len(tt.wantKeys))
+
+			continue
+		}
+
+		for i, refund := range repository.refunds {
+			if refund.RefundKey != tt.wantKeys[i] {
+				t.Errorf("%s: refund %d has key %q, want %q", tt.name, i, refund.RefundKey, tt.wantKeys[i])
+			}
+		}
+	}
+}
+
+// refundGateway accepts every refund and remembers the amounts it was asked for
+type refundGateway struct {
+	payment.Service
+	amounts []int64
+}
+
+func (g *refundGateway) Refund(orderID string, refund payment.RefundRequest) (payment.RefundResult, error) {
+	g.amounts = append(g.amounts, refund.Amount)
+
+	return payment.RefundResult{RefundKey: refund.RefundKey, Amount: refund.Amount}, nil
+}
+
+func TestRefundRemaining(t *testing.T) {
+	tests := []struct {
+		name           string
+		transaction    Transaction
+		pending        []int
+		wantAmounts    []int64
+		wantStatus     Status
+		wantRefundedTo int
+	}{
+		{"nothing refunded yet", Transaction{ID: 1, Amount: 100000, Status: StatusPaid}, nil, []int64{100000}, StatusRefunded, 100000},
+		{
+			"partially refunded",
+			Transaction{ID: 1, Amount: 100000, RefundedAmount: 40000, Status: StatusPartiallyRefunded},
+			nil, []int64{60000}, StatusRefunded, 100000,
+		},
+		{
+			// The pending refund keeps holding its amount until a notification completes it
+			"refund still pending",
+			Transaction{ID: 1, Amount: 100000, Status: StatusPaid},
+			[]int{30000}, []int64{70000}, StatusPartiallyRefunded, 70000,
+		},
+		{"whole amount pending", Transaction{ID: 1, Amount: 100000, Status: StatusPaid}, []int{100000}, nil, StatusPaid, 0},
+		{
+			"fully refunded",
+			Transaction{ID: 1, Amount: 100000, RefundedAmount: 100000, Status: StatusRefunded},
+			nil, nil, StatusRefunded, 100000,
+		},
+	}
+
+	for _, tt := range tests {
+		repository := &refundRepository{transaction: tt.transaction}
+
+		for i, amount := range tt.pending {
+			repository.reserved = append(repository.reserved, Refund{RefundKey: fmt.Sprintf("pending-%d", i), Amount: amount, Status: RefundStatusPending})
+		}
+
+		gateway := &refundGateway{}
+		s := &service{repository: repository, paymentService: gateway}
+
+		updatedTransaction, err := s.RefundRemaining(tt.transaction, ActorJob, "Campaign ended below its goal")
+
+		if err != nil {
+			t.Errorf("%s: RefundRemaining returned error: %v", tt.name, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(gateway.amounts, tt.wantAmounts) {
+			t.Errorf("%s: refunded %v on the gateway, want %v", tt.name, gateway.amounts, tt.wantAmounts)
+		}
+
+		if updatedTransaction.Status != tt.wantStatus || updatedTransaction.RefundedAmount != tt.wantRefundedTo {
+			t.Errorf("%s: transaction is %s with %d refunded, want %s with %d", tt.name, updatedTransaction.Status, updatedTransaction.RefundedAmount, tt.wantStatus, tt.wantRefundedTo)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Status string
+
+const (
+	StatusPending           Status = "pending"
+	StatusPaid              Status = "paid"
+	StatusFailed            Status = "failed"
+	StatusExpired           Status = "expired"
+	StatusCancelled         Status = "cancelled"
+	StatusRefunded          Status = "refunded"
+	StatusPartiallyRefunded Status = "partially_refunded"
+)
+
+// RefundStatus tracks a refund around the gateway call, a pending refund already holds its amount
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "pending"
+	RefundStatusCompleted RefundStatus = "completed"
+	RefundStatusFailed    RefundStatus = "failed"
+)
+
+type Actor string
+
+const (
+	ActorUser    Actor = "user"
+	ActorAdmin   Actor = "admin"
+	ActorWebhook Actor = "webhook"
+	ActorJob     Actor = "job"
+)
+
+var ErrInvalidStatusTransition = errors.New("Invalid transaction status transition")
+var ErrRefundExceedsAmount = errors.New("Refund amount exceeds the refundable amount of the transaction")
+var ErrInvalidGatewayRefund = errors.New("Invalid refund in the payment notification")
+var ErrRewardUnavailable = errors.New("The selected reward is no longer available")
+
+// Every status that is missing from this table is final
+var allowedTransitions = map[Status][]Status{
+	StatusPending:           {StatusPaid, StatusFailed, StatusExpired, StatusCancelled},
+	StatusPaid:              {StatusRefunded, StatusPartiallyRefunded},
+	StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded},
+}
+
+func (s Status) CanTransitionTo(to Status) bool {
+	for _, allowed := range allowedTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsSettled tells whether the money of a transaction in this status counts towards its campaign
+func (s Status) IsSettled() bool {
+	for _, settled := range settledStatuses() {
+		if s == settled {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HoldsReward tells whether a transaction in this status keeps its claim on a limited reward
+func (s Status) HoldsReward() bool {
+	return s == StatusPending || s.IsSettled()
+}
+
+// refundedStatus is the status of a settled transaction once refundedAmount of it went back
+func refundedStatus(amount int, refundedAmount int) Status {
+	if refundedAmount >= amount {
+		return StatusRefunded
+	}
+
+	return StatusPartiallyRefunded
+}
+
+func settledStatuses() []Status {
+	return []Status{StatusPaid, StatusPartiallyRefunded}
+}
+
+func checkTransition(from Status, to Status) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w from %s to %s", ErrInvalidStatusTransition, from, to)
+	}
+
+	return nil
+}
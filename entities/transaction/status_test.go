@@ -0,0 +1,88 @@
+package transaction
+
+import (
+	"errors"
+	"testing"
+)
+
+var allStatuses = []Status{StatusPending, StatusPaid, StatusFailed, StatusExpired, StatusCancelled, StatusRefunded, StatusPartiallyRefunded}
+
+func TestCanTransitionTo(t *testing.T) {
+	allowed := map[Status][]Status{
+		StatusPending:           {StatusPaid, StatusFailed, StatusExpired, StatusCancelled},
+		StatusPaid:              {StatusRefunded, StatusPartiallyRefunded},
+		StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded},
+	}
+
+	// Every pair is checked, so a new edge in allowedTransitions has to show up here as well
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			want := false
+
+			for _, status := range allowed[from] {
+				if status == to {
+					want = true
+				}
+			}
+
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", from, to, got, want)
+			}
+
+			err := checkTransition(from, to)
+
+			if want && err != nil {
+				t.Errorf("checkTransition(%s, %s) returned %v", from, to, err)
+			}
+
+			if !want && !errors.Is(err, ErrInvalidStatusTransition) {
+				t.Errorf("checkTransition(%s, %s) returned %v, want ErrInvalidStatusTransition", from, to, err)
+			}
+		}
+	}
+}
+
+func TestStatusPredicates(t *testing.T) {
+	tests := []struct {
+		status          Status
+		wantSettled     bool
+		wantHoldsReward bool
+	}{
+		{StatusPending, false, true},
+		{StatusPaid, true, true},
+		{StatusPartiallyRefunded, true, true},
+		{StatusRefunded, false, false},
+		{StatusFailed, false, false},
+		{StatusExpired, false, false},
+		{StatusCancelled, false, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.status.IsSettled(); got != tt.wantSettled {
+			t.Errorf("%s.IsSettled() = %v, want %v", tt.status, got, tt.wantSettled)
+		}
+
+		if got := tt.status.HoldsReward(); got != tt.wantHoldsReward {
+			t.Errorf("%s.HoldsReward() = %v, want %v", tt.status, got, tt.wantHoldsReward)
+		}
+	}
+}
+
+func TestRefundedStatus(t *testing.T) {
+	tests := []struct {
+		amount         int
+		refundedAmount int
+		want           Status
+	}{
+		{100000, 1, StatusPartiallyRefunded},
+		{100000, 99999, StatusPartiallyRefunded},
+		{100000, 100000, StatusRefunded},
+		{100000, 150000, StatusRefunded},
+	}
+
+	for _, tt := range tests {
+		if got := refundedStatus(tt.amount, tt.refundedAmount); got != tt.want {
+			t.Errorf("refundedStatus(%d, %d) = %s, want %s", tt.amount, tt.refundedAmount, got, tt.want)
+		}
+	}
+}
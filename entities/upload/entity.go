@@ -0,0 +1,41 @@
+package upload
+
+import "time"
+
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusPartial    = "partial"
+	StatusFailed     = "failed"
+)
+
+// UploadJob tracks a batch of campaign images, the files are staged on disk and processed by the upload worker
+type UploadJob struct {
+	ID          int
+	UserID      int
+	CampaignID  int
+	CoverIndex  int
+	Status      string
+	Files       []UploadFile
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt *time.Time
+}
+
+type UploadFile struct {
+	ID              int
+	UploadJobID     int
+	Position        int
+	Filename        string
+	StagingKey      string
+	Status          string
+	Error           string
+	CampaignImageID *int
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (j UploadJob) IsFinished() bool {
+	return j.Status == StatusCompleted || j.Status == StatusPartial || j.Status == StatusFailed
+}
@@ -0,0 +1,54 @@
+package upload
+
+import "time"
+
+type UploadJobFormat struct {
+	ID             int                `json:"id"`
+	CampaignID     int                `json:"campaign_id"`
+	Status         string             `json:"status"`
+	TotalFiles     int                `json:"total_files"`
+	CompletedFiles int                `json:"completed_files"`
+	FailedFiles    int                `json:"failed_files"`
+	Files          []UploadFileFormat `json:"files"`
+	CreatedAt      time.Time          `json:"created_at"`
+	CompletedAt    *time.Time         `json:"completed_at"`
+}
+
+type UploadFileFormat struct {
+	ID              int    `json:"id"`
+	Filename        string `json:"filename"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+	CampaignImageID *int   `json:"campaign_image_id"`
+}
+
+func FormatUploadJob(job UploadJob) UploadJobFormat {
+	jobFormat := UploadJobFormat{
+		ID:          job.ID,
+		CampaignID:  job.CampaignID,
+		Status:      job.Status,
+		TotalFiles:  len(job.Files),
+		Files:       []UploadFileFormat{},
+		CreatedAt:   job.CreatedAt,
+		CompletedAt: job.CompletedAt,
+	}
+
+	for _, file := range job.Files {
+		switch file.Status {
+		case StatusCompleted:
+			jobFormat.CompletedFiles++
+		case StatusFailed:
+			jobFormat.FailedFiles++
+		}
+
+		jobFormat.Files = append(jobFormat.Files, UploadFileFormat{
+			ID:              file.ID,
+			Filename:        file.Filename,
+			Status:          file.Status,
+			Error:           file.Error,
+			CampaignImageID: file.CampaignImageID,
+		})
+	}
+
+	return jobFormat
+}
@@ -0,0 +1,5 @@
+package upload
+
+type GetUploadJobInput struct {
+	ID int `uri:"job_id" binding:"required"`
+}
@@ -0,0 +1,135 @@
+package upload
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Save(job UploadJob) (UploadJob, error)
+	FindByID(ID int) (UploadJob, error)
+	FindIDsByStatus(status string) ([]int, error)
+	Claim(job UploadJob) (bool, error)
+	ResetProcessing() error
+	Release(job UploadJob) error
+	UpdateFile(file UploadFile) (UploadFile, error)
+	Finish(job UploadJob, status string) (UploadJob, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db}
+}
+
+// Save creates the job together with its files
+func (r *repository) Save(job UploadJob) (UploadJob, error) {
+	err := r.db.Create(&job).Error
+
+	if err != nil {
+		return job, err
+	}
+
+	return job, nil
+}
+
+func (r *repository) FindByID(ID int) (UploadJob, error) {
+	var job UploadJob
+
+	err := r.db.Where("id = ?", ID).Preload("Files", func(db *gorm.DB) *gorm.DB { return db.Order("position asc") }).Find(&job).Error
+
+	if err != nil {
+		return job, err
+	}
+
+	return job, nil
+}
+
+func (r *repository) FindIDsByStatus(status string) ([]int, error) {
+	var IDs []int
+
+	err := r.db.Model(&UploadJob{}).Where("status = ?", status).Order("id asc").Pluck("id", &IDs).Error
+
+	if err != nil {
+		return IDs, err
+	}
+
+	return IDs, nil
+}
+
+// Claim moves a pending job to processing, only one worker can win it even if the job was queued twice
+func (r *repository) Claim(job UploadJob) (bool, error) {
+	result := r.db.Model(&UploadJob{}).Where("id = ? AND status = ?", job.ID, StatusPending).Updates(map[string]interface{}{"status": StatusProcessing, "updated_at": time.Now()})
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// ResetProcessing hands jobs interrupted by a restart back to the queue, their unfinished files are processed again
+func (r *repository) ResetProcessing() error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		interruptedJobs := tx.Model(&UploadJob{}).Select("id").Where("status = ?", StatusProcessing)
+
+		if err := tx.Model(&UploadFile{}).Where("upload_job_id IN (?) AND status = ?", interruptedJobs, StatusProcessing).Update("status", StatusPending).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&UploadJob{}).Where("status = ?", StatusProcessing).Update("status", StatusPending).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Release hands a job that stopped on an error back to the queue, its unfinished files are processed again
+func (r *repository) Release(job UploadJob) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&UploadFile{}).Where("upload_job_id = ? AND status = ?", job.ID, StatusProcessing).Update("status", StatusPending).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&UploadJob{}).Where("id = ? AND status = ?", job.ID, StatusProcessing).Updates(map[string]interface{}{"status": StatusPending, "updated_at": time.Now()}).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) UpdateFile(file UploadFile) (UploadFile, error) {
+	file.UpdatedAt = time.Now()
+
+	err := r.db.Save(&file).Error
+
+	if err != nil {
+		return file, err
+	}
+
+	return file, nil
+}
+
+func (r *repository) Finish(job UploadJob, status string) (UploadJob, error) {
+	now := time.Now()
+
+	err := r.db.Model(&job).Updates(map[string]interface{}{"status": status, "completed_at": now, "updated_at": now}).Error
+
+	if err != nil {
+		return job, err
+	}
+
+	job.Status = status
+	job.CompletedAt = &now
+
+	return job, nil
+}
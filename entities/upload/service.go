@@ -0,0 +1,261 @@
+package upload
+
+import (
+	"bwastartup/imaging"
+	"bwastartup/storage"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dchest/uniuri"
+)
+
+type Service interface {
+	CreateCampaignImagesJob(userID int, campaignID int, coverIndex int, files []*multipart.FileHeader) (UploadJob, error)
+	GetJobByID(ID int) (UploadJob, error)
+	Queue() <-chan int
+	EnqueuePending() error
+	ResetInterruptedJobs() error
+	ClaimJob(ID int) (UploadJob, bool, error)
+	ReleaseJob(job UploadJob) error
+	OpenStagedFile(file UploadFile) (io.ReadCloser, error)
+	StartFile(file UploadFile) (UploadFile, error)
+	CompleteFile(file UploadFile, campaignImageID int) (UploadFile, error)
+	FailFile(file UploadFile, cause error) (UploadFile, error)
+	FinishJob(job UploadJob) (UploadJob, error)
+}
+
+var ErrInvalidUpload = errors.New("Invalid upload")
+
+// MaxFilesPerJob keeps a single request from queueing an unbounded amount of work
+const MaxFilesPerJob = 10
+
+type service struct {
+	repository Repository
+	staging    storage.Store
+	queue      chan int
+}
+
+// NewService stages uploads in the staging store, it should be on a local disk shared with the upload worker
+func NewService(repository Repository, staging storage.Store, queueSize int) Service {
+	return &service{repository, staging, make(chan int, queueSize)}
+}
+
+// CreateCampaignImagesJob stages the files and queues them, the images are validated and stored by the worker
+func (s *service) CreateCampaignImagesJob(userID int, campaignID int, coverIndex int, files []*multipart.FileHeader) (UploadJob, error) {
+	if len(files) > MaxFilesPerJob {
+		return UploadJob{}, fmt.Errorf("%w, at most %d files can be uploaded at once", ErrInvalidUpload, MaxFilesPerJob)
+	}
+
+	for _, file := range files {
+		if file.Size > imaging.DefaultLimits.MaxBytes {
+			return UploadJob{}, fmt.Errorf("%w, %s is larger than %d MB", ErrInvalidUpload, file.Filename, imaging.DefaultLimits.MaxBytes>>20)
+		}
+	}
+
+	now := time.Now()
+	stagingDir := fmt.Sprintf("%s-%s", now.Format("20060102"), uniuri.NewLen(16))
+
+	job := UploadJob{UserID: userID, CampaignID: campaignID, CoverIndex: coverIndex, Status: StatusPending, CreatedAt: now, UpdatedAt: now}
+
+	for i, file := range files {
+		stagingKey, err := storage.PutFile(s.staging, fmt.Sprintf("%s/%d%s", stagingDir, i, strings.ToLower(filepath.Ext(file.Filename))), file)
+
+		if err != nil {
+			s.discardStagedFiles(job.Files)
+
+			return UploadJob{}, err
+		}
+
+		job.Files = append(job.Files, UploadFile{
+			Position:   i,
+			Filename:   filepath.Base(file.Filename),
+			StagingKey: stagingKey,
+			Status:     StatusPending,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+	}
+
+	savedJob, err := s.repository.Save(job)
+
+	if err != nil {
+		s.discardStagedFiles(job.Files)
+
+		return savedJob, err
+	}
+
+	s.enqueue(savedJob.ID)
+
+	return savedJob, nil
+}
+
+func (s *service) GetJobByID(ID int) (UploadJob, error) {
+	job, err := s.repository.FindByID(ID)
+
+	if err != nil {
+		return job, err
+	}
+
+	return job, nil
+}
+
+func (s *service) Queue() <-chan int {
+	return s.queue
+}
+
+// enqueue never blocks the request, a job that doesn't fit in the queue is picked up by EnqueuePending later
+func (s *service) enqueue(ID int) {
+	select {
+	case s.queue <- ID:
+	default:
+		log.Printf("Upload queue is full, job %d waits for the next sweep\n", ID)
+	}
+}
+
+func (s *service) EnqueuePending() error {
+	IDs, err := s.repository.FindIDsByStatus(StatusPending)
+
+	if err != nil {
+		return err
+	}
+
+	for _, ID := range IDs {
+		s.enqueue(ID)
+	}
+
+	return nil
+}
+
+func (s *service) ResetInterruptedJobs() error {
+	err := s.repository.ResetProcessing()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClaimJob returns false when another worker already took the job
+func (s *service) ClaimJob(ID int) (UploadJob, bool, error) {
+	job, err := s.repository.FindByID(ID)
+
+	if err != nil || job.ID <= 0 {
+		return job, false, err
+	}
+
+	claimed, err := s.repository.Claim(job)
+
+	if err != nil || !claimed {
+		return job, false, err
+	}
+
+	job.Status = StatusProcessing
+
+	return job, true, nil
+}
+
+// ReleaseJob puts a claimed job back to pending, EnqueuePending queues it again on the next sweep
+func (s *service) ReleaseJob(job UploadJob) error {
+	err := s.repository.Release(job)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *service) OpenStagedFile(file UploadFile) (io.ReadCloser, error) {
+	return s.staging.Open(file.StagingKey)
+}
+
+func (s *service) StartFile(file UploadFile) (UploadFile, error) {
+	file.Status = StatusProcessing
+
+	return s.repository.UpdateFile(file)
+}
+
+func (s *service) CompleteFile(file UploadFile, campaignImageID int) (UploadFile, error) {
+	file.Status = StatusCompleted
+	file.CampaignImageID = &campaignImageID
+	file.Error = ""
+
+	updatedFile, err := s.repository.UpdateFile(file)
+
+	if err != nil {
+		return updatedFile, err
+	}
+
+	s.discardStagedFiles([]UploadFile{updatedFile})
+
+	return updatedFile, nil
+}
+
+// FailFile is meant for files that can never be processed, it only shows validation errors to the user and
+// logs anything else
+func (s *service) FailFile(file UploadFile, cause error) (UploadFile, error) {
+	file.Status = StatusFailed
+	file.Error = "Unable to process the image"
+
+	if errors.Is(cause, imaging.ErrInvalidImage) {
+		file.Error = cause.Error()
+	} else {
+		log.Printf("Upload file %d failed: %v\n", file.ID, cause)
+	}
+
+	updatedFile, err := s.repository.UpdateFile(file)
+
+	if err != nil {
+		return updatedFile, err
+	}
+
+	s.discardStagedFiles([]UploadFile{updatedFile})
+
+	return updatedFile, nil
+}
+
+// FinishJob settles the job status from the status of its files
+func (s *service) FinishJob(job UploadJob) (UploadJob, error) {
+	completed, failed := 0, 0
+
+	for _, file := range job.Files {
+		switch file.Status {
+		case StatusCompleted:
+			completed++
+		case StatusFailed:
+			failed++
+		}
+	}
+
+	status := StatusPartial
+
+	switch {
+	case failed == 0:
+		status = StatusCompleted
+	case completed == 0:
+		status = StatusFailed
+	}
+
+	finishedJob, err := s.repository.Finish(job, status)
+
+	if err != nil {
+		return finishedJob, err
+	}
+
+	return finishedJob, nil
+}
+
+func (s *service) discardStagedFiles(files []UploadFile) {
+	for _, file := range files {
+		if err := s.staging.Delete(file.StagingKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Unable to delete staged upload %s: %v\n", file.StagingKey, err)
+		}
+	}
+}
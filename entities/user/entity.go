@@ -1,18 +1,132 @@
 package user
 
 import (
+	"bwastartup/imaging"
 	"time"
 )
 
 type User struct {
-	ID         int
-	Name       string
-	Occupation string
-	Email      string
-	Password   string
-	Avatar     string
-	Role       string
-	Token      string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	ID                      int
+	Name                    string
+	Occupation              string
+	Email                   string
+	Password                string
+	Avatar                  string
+	AvatarCard              string
+	AvatarThumbnail         string
+	Role                    string
+	Token                   string
+	Roles                   []UserRole
+	EmailVerifiedAt         *time.Time
+	EmailVerificationSentAt *time.Time
+	AnonymizedAt            *time.Time
+	TwoFactorSecret         string
+	TwoFactorEnabledAt      *time.Time
+	TwoFactorLastStep       int64
+	CreatedAt               time.Time
+	UpdatedAt               time.Time
+}
+
+func (u User) AvatarKeys() imaging.Keys {
+	return imaging.Keys{Thumbnail: u.AvatarThumbnail, Card: u.AvatarCard, Full: u.Avatar}
+}
+
+// IsEmailVerified tells whether the user opened the link from the verification email
+func (u User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// UserRole grants a role on top of the one stored in User.Role
+type UserRole struct {
+	ID          int
+	UserID      int
+	Role        string
+	GrantedByID *int
+	CreatedAt   time.Time
+}
+
+// UserIdentity links the user to an account at an OAuth provider such as Google or GitHub
+type UserIdentity struct {
+	ID        int
+	UserID    int
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// BackupCode lets a user with two-factor authentication log in without their authenticator, once
+type BackupCode struct {
+	ID        int
+	UserID    int
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// PasswordResetToken is stored hashed and can be used once before it expires
+type PasswordResetToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// HasPassword is false for accounts created by social login until they set a password
+func (u User) HasPassword() bool {
+	return u.Password != ""
+}
+
+func (u User) IsTwoFactorEnabled() bool {
+	return u.TwoFactorEnabledAt != nil
+}
+
+// RoleNames returns every role of the user, starting with the one it registered with
+func (u User) RoleNames() []string {
+	roleNames := []string{}
+
+	if u.Role != "" {
+		roleNames = append(roleNames, u.Role)
+	}
+
+	for _, userRole := range u.Roles {
+		if userRole.Role != u.Role {
+			roleNames = append(roleNames, userRole.Role)
+		}
+	}
+
+	return roleNames
+}
+
+// HasRole tells whether the user has any of the given roles
+func (u User) HasRole(roles ...string) bool {
+	for _, roleName := range u.RoleNames() {
+		for _, role := range roles {
+			if roleName == role {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// HasPermission tells whether one of the user's roles grants the permission. Staff who have to use two-factor
+// authentication hold none of their permissions until they enable it, wherever the permission is checked
+func (u User) HasPermission(permission Permission) bool {
+	if u.MissingRequiredTwoFactor() {
+		return false
+	}
+
+	for _, roleName := range u.RoleNames() {
+		for _, rolePermission := range rolePermissions[roleName] {
+			if rolePermission == permission {
+				return true
+			}
+		}
+	}
+
+	return false
 }
@@ -1,29 +1,78 @@
 package user
 
-import "github.com/muktiwbw/gdstorage"
+import (
+	"bwastartup/imaging"
+	"bwastartup/storage"
+	"time"
+)
 
 type UserFormat struct {
-	ID         int    `json:"id"`
-	Name       string `json:"name"`
-	Occupation string `json:"occupation"`
-	Email      string `json:"email"`
-	Token      string `json:"token"`
-	Avatar     string `json:"avatar"`
+	ID            int                      `json:"id"`
+	Name          string                   `json:"name"`
+	Occupation    string                   `json:"occupation"`
+	Email         string                   `json:"email"`
+	Token         string                   `json:"token"`
+	RefreshToken  string                   `json:"refresh_token,omitempty"`
+	Avatar        string                   `json:"avatar"`
+	AvatarURLs    imaging.RenditionsFormat `json:"avatar_renditions"`
+	Roles         []string                 `json:"roles"`
+	EmailVerified bool                     `json:"email_verified"`
+	TwoFactor     bool                     `json:"two_factor_enabled"`
+	HasPassword   bool                     `json:"has_password"`
 }
 
-func FormatUser(user User, token string) UserFormat {
+func FormatUser(user User, token string, refreshToken string) UserFormat {
 	var avatar string
 
 	if user.Avatar != "" {
-		avatar = gdstorage.GetURL(avatar)
+		avatar = storage.URL(user.Avatar)
 	}
 
 	return UserFormat{
-		ID:         user.ID,
-		Name:       user.Name,
-		Occupation: user.Occupation,
-		Email:      user.Email,
-		Avatar:     avatar,
-		Token:      token,
+		ID:            user.ID,
+		Name:          user.Name,
+		Occupation:    user.Occupation,
+		Email:         user.Email,
+		Avatar:        avatar,
+		AvatarURLs:    imaging.FormatRenditions(user.AvatarKeys()),
+		Token:         token,
+		RefreshToken:  refreshToken,
+		Roles:         user.RoleNames(),
+		EmailVerified: user.IsEmailVerified(),
+		TwoFactor:     user.IsTwoFactorEnabled(),
+		HasPassword:   user.HasPassword(),
+	}
+}
+
+// UserExportFormat is everything stored about the user, except the password hash
+type UserExportFormat struct {
+	ID              int        `json:"id"`
+	Name            string     `json:"name"`
+	Occupation      string     `json:"occupation"`
+	Email           string     `json:"email"`
+	Avatar          string     `json:"avatar"`
+	Roles           []string   `json:"roles"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func FormatUserExport(user User) UserExportFormat {
+	var avatar string
+
+	if user.Avatar != "" {
+		avatar = storage.URL(user.Avatar)
+	}
+
+	return UserExportFormat{
+		ID:              user.ID,
+		Name:            user.Name,
+		Occupation:      user.Occupation,
+		Email:           user.Email,
+		Avatar:          avatar,
+		Roles:           user.RoleNames(),
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
 	}
 }
@@ -0,0 +1,167 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// identityRepository keeps users and identities in memory, emails are matched exactly as in the database
+type identityRepository struct {
+	Repository
+	users       map[int]User
+	identities  []UserIdentity
+	backupCodes map[int]int
+}
+
+func newIdentityRepository(users ...User) *identityRepository {
+	r := &identityRepository{users: map[int]User{}, backupCodes: map[int]int{}}
+
+	for _, user := range users {
+		r.users[user.ID] = user
+		r.backupCodes[user.ID] = backupCodeCount
+	}
+
+	return r
+}
+
+func (r *identityRepository) FindIdentity(provider string, subject string) (UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+
+	return UserIdentity{}, nil
+}
+
+func (r *identityRepository) FindByEmail(email string) (User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return User{}, nil
+}
+
+func (r *identityRepository) FindByID(id int) (User, error) {
+	return r.users[id], nil
+}
+
+func (r *identityRepository) Update(user User) (User, error) {
+	r.users[user.ID] = user
+
+	return user, nil
+}
+
+func (r *identityRepository) SaveIdentity(identity UserIdentity) (UserIdentity, error) {
+	r.identities = append(r.identities, identity)
+
+	return identity, nil
+}
+
+func (r *identityRepository) SaveWithIdentity(user User, identity UserIdentity) (User, error) {
+	user.ID = len(r.users) + 1
+	r.users[user.ID] = user
+	identity.UserID = user.ID
+	r.identities = append(r.identities, identity)
+
+	return user, nil
+}
+
+func (r *identityRepository) ReplaceBackupCodes(userID int, backupCodes []BackupCode) error {
+	r.backupCodes[userID] = len(backupCodes)
+
+	return nil
+}
+
+func TestLoginWithIdentity(t *testing.T) {
+	verifiedAt := time.Now()
+	verified := User{ID: 1, Email: "ava@example.com", Password: "hash", EmailVerifiedAt: &verifiedAt}
+	unverified := User{ID: 2, Email: "eve@example.com", Password: "hash"}
+
+	tests := []struct {
+		name         string
+		input        IdentityInput
+		wantErr      error
+		wantUserID   int
+		wantLinked   bool
+		wantNewEmail string
+	}{
+		{"links a verified account", IdentityInput{Provider: "google", Subject: "g-1", Email: "ava@example.com", EmailVerified: true}, nil, 1, true, ""},
+		{"matches the email in any case", IdentityInput{Provider: "google", Subject: "g-1", Email: " Ava@Example.COM ", EmailVerified: true}, nil, 1, true, ""},
+		{"unverified account has to be claimed", IdentityInput{Provider: "google", Subject: "g-2", Email: "Eve@example.com", EmailVerified: true}, ErrIdentityClaimsAccount, 2, false, ""},
+		{"email the provider didn't verify", IdentityInput{Provider: "github", Subject: "h-1", Email: "ava@example.com"}, ErrUnverifiedIdentityEmail, 0, false, ""},
+		{"new account with a lower case email", IdentityInput{Provider: "github", Subject: "h-2", Email: "New@Example.com", EmailVerified: true}, nil, 3, true, "new@example.com"},
+	}
+
+	for _, tt := range tests {
+		repository := newIdentityRepository(verified, unverified)
+		s := &service{repository: repository}
+
+		got, err := s.LoginWithIdentity(tt.input)
+
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: LoginWithIdentity returned %v, want %v", tt.name, err, tt.wantErr)
+
+			continue
+		}
+
+		if got.ID != tt.wantUserID {
+			t.Errorf("%s: LoginWithIdentity returned user %d, want %d", tt.name, got.ID, tt.wantUserID)
+		}
+
+		if linked := len(repository.identities) == 1; linked != tt.wantLinked {
+			t.Errorf("%s: identity linked = %v, want %v", tt.name, linked, tt.wantLinked)
+		}
+
+		if tt.wantNewEmail != "" && (got.Email != tt.wantNewEmail || !got.IsEmailVerified() || got.HasPassword()) {
+			t.Errorf("%s: new account is %+v", tt.name, got)
+		}
+	}
+}
+
+func TestClaimAccountWithIdentity(t *testing.T) {
+	enabledAt := time.Now()
+	unverified := User{ID: 2, Email: "eve@example.com", Password: "hash", TwoFactorSecret: "secret", TwoFactorEnabledAt: &enabledAt}
+	input := IdentityInput{Provider: "google", Subject: "g-2", Email: "EVE@example.com", EmailVerified: true}
+
+	repository := newIdentityRepository(unverified)
+	s := &service{repository: repository}
+
+	claimed, err := s.ClaimAccountWithIdentity(unverified, input)
+
+	if err != nil {
+		t.Fatalf("ClaimAccountWithIdentity returned error: %v", err)
+	}
+
+	// Nothing the previous holder of the account set up may still let them in
+	if claimed.HasPassword() || claimed.IsTwoFactorEnabled() || claimed.TwoFactorSecret != "" || repository.backupCodes[2] != 0 {
+		t.Errorf("claimed account still has a way in: %+v, %d backup codes", claimed, repository.backupCodes[2])
+	}
+
+	if !repository.users[2].IsEmailVerified() || len(repository.identities) != 1 || repository.identities[0].UserID != 2 {
+		t.Errorf("claimed account isn't verified and linked: %+v, %+v", repository.users[2], repository.identities)
+	}
+
+	if _, err := s.LoginWithIdentity(input); err != nil {
+		t.Errorf("LoginWithIdentity after the claim returned %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		user  User
+		input IdentityInput
+	}{
+		{"verified account", repository.users[2], input},
+		{"another email", User{ID: 3, Email: "ava@example.com"}, input},
+		{"email the provider didn't verify", User{ID: 3, Email: "eve@example.com"}, IdentityInput{Provider: "google", Subject: "g-3", Email: "eve@example.com"}},
+	}
+
+	for _, tt := range tests {
+		if _, err := s.ClaimAccountWithIdentity(tt.user, tt.input); !errors.Is(err, ErrUnverifiedIdentityEmail) {
+			t.Errorf("%s: ClaimAccountWithIdentity returned %v, want ErrUnverifiedIdentityEmail", tt.name, err)
+		}
+	}
+}
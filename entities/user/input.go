@@ -15,3 +15,86 @@ type LoginUserInput struct {
 type CheckEmailAvailabilityInput struct {
 	Email string `json:"email" binding:"required,email"`
 }
+
+type GetUserByIDInput struct {
+	ID int `uri:"user_id" binding:"required"`
+}
+
+type GrantRoleInput struct {
+	Role string `json:"role" binding:"required,oneof=creator moderator admin finance"`
+}
+
+type RevokeRoleInput struct {
+	UserID int    `uri:"user_id" binding:"required"`
+	Role   string `uri:"role" binding:"required"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+type VerifyEmailInput struct {
+	UserID    int    `form:"user_id" binding:"required"`
+	Expires   int64  `form:"expires" binding:"required"`
+	Signature string `form:"signature" binding:"required"`
+}
+
+type UpdateProfileInput struct {
+	Name       string `json:"name" binding:"omitempty,max=100"`
+	Occupation string `json:"occupation" binding:"omitempty,max=100"`
+}
+
+type ChangeEmailInput struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,nefield=CurrentPassword"`
+}
+
+type DeleteAccountInput struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type ExportAccountInput struct {
+	Format string `form:"format" binding:"omitempty,oneof=zip json"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorInput struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type LoginTwoFactorInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// IdentityInput is what an OAuth provider tells us about the user logging in
+type IdentityInput struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type OAuthProviderInput struct {
+	Provider string `uri:"provider" binding:"required"`
+}
+
+type OAuthCallbackInput struct {
+	Code  string `form:"code" binding:"required"`
+	State string `form:"state" binding:"required"`
+}
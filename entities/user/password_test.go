@@ -0,0 +1,86 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordRepository keeps the last saved user
+type passwordRepository struct {
+	Repository
+	saved User
+}
+
+func (r *passwordRepository) Update(user User) (User, error) {
+	r.saved = user
+
+	return user, nil
+}
+
+func TestCheckPassword(t *testing.T) {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+
+	tests := []struct {
+		name     string
+		user     User
+		password string
+		wantErr  error
+	}{
+		{"correct password", User{Password: string(hashedPassword)}, "old-password", nil},
+		{"wrong password", User{Password: string(hashedPassword)}, "guess", ErrIncorrectPassword},
+		{"social login account", User{}, "", ErrPasswordNotSet},
+		{"social login account with a guess", User{}, "guess", ErrPasswordNotSet},
+	}
+
+	for _, tt := range tests {
+		if err := checkPassword(tt.user, tt.password); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: checkPassword returned %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	anonymizedAt := time.Now()
+
+	tests := []struct {
+		name    string
+		user    User
+		current string
+		wantErr error
+	}{
+		{"with the current password", User{ID: 1, Password: string(hashedPassword)}, "old-password", nil},
+		{"with a wrong current password", User{ID: 1, Password: string(hashedPassword)}, "guess", ErrIncorrectPassword},
+		{"without the current password", User{ID: 1, Password: string(hashedPassword)}, "", ErrIncorrectPassword},
+		{"first password of a social login account", User{ID: 1}, "", nil},
+		{"deleted account", User{ID: 1, AnonymizedAt: &anonymizedAt}, "", ErrIncorrectPassword},
+	}
+
+	for _, tt := range tests {
+		repository := &passwordRepository{}
+		s := &service{repository: repository}
+
+		_, err := s.ChangePassword(tt.user, ChangePasswordInput{CurrentPassword: tt.current, NewPassword: "new-password"})
+
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: ChangePassword returned %v, want %v", tt.name, err, tt.wantErr)
+
+			continue
+		}
+
+		if tt.wantErr != nil {
+			if repository.saved.ID != 0 {
+				t.Errorf("%s: ChangePassword saved the user", tt.name)
+			}
+
+			continue
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(repository.saved.Password), []byte("new-password")); err != nil {
+			t.Errorf("%s: the new password doesn't match the saved hash", tt.name)
+		}
+	}
+}
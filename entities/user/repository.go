@@ -2,8 +2,10 @@ package user
 
 import (
 	"errors"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
@@ -11,6 +13,18 @@ type Repository interface {
 	FindByEmail(email string) (User, error)
 	FindByID(id int) (User, error)
 	Update(user User) (User, error)
+	AddRole(userRole UserRole) error
+	RemoveRole(userID int, role string) error
+	SavePasswordResetToken(token PasswordResetToken) (PasswordResetToken, error)
+	FindPasswordResetTokenByHash(tokenHash string) (PasswordResetToken, error)
+	ResetPassword(token PasswordResetToken, hashedPassword string) error
+	Anonymize(user User) (User, error)
+	UseTwoFactorStep(userID int, step int64) (bool, error)
+	ReplaceBackupCodes(userID int, backupCodes []BackupCode) error
+	UseBackupCode(userID int, codeHash string) (bool, error)
+	FindIdentity(provider string, subject string) (UserIdentity, error)
+	SaveIdentity(identity UserIdentity) (UserIdentity, error)
+	SaveWithIdentity(user User, identity UserIdentity) (User, error)
 }
 
 type repository struct {
@@ -34,7 +48,7 @@ func (r *repository) Save(user User) (User, error) {
 func (r *repository) FindByEmail(email string) (User, error) {
 	var foundUser User
 
-	err := r.db.Where("email = ?", email).Find(&foundUser).Error
+	err := r.db.Where("email = ?", email).Preload("Roles").Find(&foundUser).Error
 
 	if err != nil {
 		return foundUser, err
@@ -51,7 +65,7 @@ func (r *repository) FindByEmail(email string) (User, error) {
 func (r *repository) FindByID(id int) (User, error) {
 	var foundUser User
 
-	err := r.db.Where("id = ?", id).Find(&foundUser).Error
+	err := r.db.Where("id = ?", id).Preload("Roles").Find(&foundUser).Error
 
 	if err != nil {
 		return foundUser, err
@@ -67,7 +81,193 @@ func (r *repository) FindByID(id int) (User, error) {
 
 func (r *repository) Update(user User) (User, error) {
 	// Segala sesuatu dari db hanya menerima pointer sebagai argumen
-	err := r.db.Save(&user).Error
+	// Roles are granted and revoked on their own, never through a user update
+	err := r.db.Omit(clause.Associations).Save(&user).Error
+
+	if err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+func (r *repository) AddRole(userRole UserRole) error {
+	// Granting a role the user already has is a no-op
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&userRole).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) RemoveRole(userID int, role string) error {
+	err := r.db.Where("user_id = ? AND role = ?", userID, role).Delete(&UserRole{}).Error
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) SavePasswordResetToken(token PasswordResetToken) (PasswordResetToken, error) {
+	err := r.db.Create(&token).Error
+
+	if err != nil {
+		return token, err
+	}
+
+	return token, nil
+}
+
+func (r *repository) FindPasswordResetTokenByHash(tokenHash string) (PasswordResetToken, error) {
+	var token PasswordResetToken
+
+	err := r.db.Where("token_hash = ?", tokenHash).Find(&token).Error
+
+	if err != nil {
+		return token, err
+	}
+
+	return token, nil
+}
+
+func (r *repository) ResetPassword(token PasswordResetToken, hashedPassword string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Consuming the token is conditional so two requests with the same token can't both succeed
+		result := tx.Model(&PasswordResetToken{}).Where("id = ? AND used_at IS NULL AND expires_at > ?", token.ID, now).Update("used_at", now)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		if err := tx.Model(&User{}).Where("id = ?", token.UserID).Updates(map[string]interface{}{"password": hashedPassword, "updated_at": now}).Error; err != nil {
+			return err
+		}
+
+		// Any other link sent before is no longer needed
+		return tx.Model(&PasswordResetToken{}).Where("user_id = ? AND used_at IS NULL", token.UserID).Update("used_at", now).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) Anonymize(user User) (User, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(&user).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&BackupCode{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&UserIdentity{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&PasswordResetToken{}).Error
+	})
+
+	if err != nil {
+		return user, err
+	}
+
+	user.Roles = []UserRole{}
+
+	return user, nil
+}
+
+// UseTwoFactorStep records the time step of an accepted code, it fails for a step that was already used
+func (r *repository) UseTwoFactorStep(userID int, step int64) (bool, error) {
+	result := r.db.Model(&User{}).Where("id = ? AND two_factor_last_step < ?", userID, step).Update("two_factor_last_step", step)
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (r *repository) ReplaceBackupCodes(userID int, backupCodes []BackupCode) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&BackupCode{}).Error; err != nil {
+			return err
+		}
+
+		if len(backupCodes) == 0 {
+			return nil
+		}
+
+		return tx.Create(&backupCodes).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) UseBackupCode(userID int, codeHash string) (bool, error) {
+	result := r.db.Model(&BackupCode{}).Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).Update("used_at", time.Now())
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (r *repository) FindIdentity(provider string, subject string) (UserIdentity, error) {
+	var identity UserIdentity
+
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).Find(&identity).Error
+
+	if err != nil {
+		return identity, err
+	}
+
+	return identity, nil
+}
+
+func (r *repository) SaveIdentity(identity UserIdentity) (UserIdentity, error) {
+	err := r.db.Create(&identity).Error
+
+	if err != nil {
+		return identity, err
+	}
+
+	return identity, nil
+}
+
+// SaveWithIdentity creates an account from its first social login
+func (r *repository) SaveWithIdentity(user User, identity UserIdentity) (User, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&user).Error; err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+
+		return tx.Create(&identity).Error
+	})
 
 	if err != nil {
 		return user, err
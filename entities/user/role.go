@@ -0,0 +1,47 @@
+package user
+
+import "errors"
+
+const (
+	RoleUser      = "user"
+	RoleCreator   = "creator"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+	RoleFinance   = "finance"
+)
+
+type Permission string
+
+const (
+	PermissionViewAllTransactions Permission = "transactions.view_all"
+	PermissionVerifyTransactions  Permission = "transactions.verify"
+	PermissionRefundTransactions  Permission = "transactions.refund"
+	PermissionModerateCampaigns   Permission = "campaigns.moderate"
+	PermissionManageCampaigns     Permission = "campaigns.manage"
+	PermissionManageRoles         Permission = "users.manage_roles"
+)
+
+// rolePermissions lists what each role may do on top of what every logged in user can do,
+// users and creators only ever act on their own data
+var rolePermissions = map[string][]Permission{
+	RoleUser:      {},
+	RoleCreator:   {},
+	RoleModerator: {PermissionModerateCampaigns, PermissionViewAllTransactions},
+	RoleFinance:   {PermissionViewAllTransactions, PermissionVerifyTransactions, PermissionRefundTransactions},
+	RoleAdmin: {
+		PermissionViewAllTransactions,
+		PermissionVerifyTransactions,
+		PermissionRefundTransactions,
+		PermissionModerateCampaigns,
+		PermissionManageCampaigns,
+		PermissionManageRoles,
+	},
+}
+
+var ErrInvalidRole = errors.New("Invalid role")
+
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+
+	return ok
+}
@@ -0,0 +1,100 @@
+package user
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// verificationRepository holds a single user in memory
+type verificationRepository struct {
+	Repository
+	user User
+}
+
+func (r *verificationRepository) FindByID(id int) (User, error) {
+	if id != r.user.ID {
+		return User{}, errors.New("record not found")
+	}
+
+	return r.user, nil
+}
+
+func (r *verificationRepository) Update(user User) (User, error) {
+	r.user = user
+
+	return user, nil
+}
+
+func TestSignEmailVerification(t *testing.T) {
+	defer os.Setenv("EMAIL_VERIFICATION_SECRET", os.Getenv("EMAIL_VERIFICATION_SECRET"))
+	os.Setenv("EMAIL_VERIFICATION_SECRET", "verification-secret")
+
+	signature := signEmailVerification(1, "ava@example.com", 1600000000)
+
+	if signature != signEmailVerification(1, "AVA@Example.com", 1600000000) {
+		t.Error("signature depends on the case of the email")
+	}
+
+	tests := []struct {
+		name    string
+		userID  int
+		email   string
+		expires int64
+	}{
+		{"another user", 2, "ava@example.com", 1600000000},
+		{"another email", 1, "eve@example.com", 1600000000},
+		{"another expiry", 1, "ava@example.com", 1600000001},
+	}
+
+	for _, tt := range tests {
+		if signEmailVerification(tt.userID, tt.email, tt.expires) == signature {
+			t.Errorf("%s: signature didn't change", tt.name)
+		}
+	}
+
+	os.Setenv("EMAIL_VERIFICATION_SECRET", "another-secret")
+
+	if signEmailVerification(1, "ava@example.com", 1600000000) == signature {
+		t.Error("signature didn't change with the secret")
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	defer os.Setenv("EMAIL_VERIFICATION_SECRET", os.Getenv("EMAIL_VERIFICATION_SECRET"))
+	os.Setenv("EMAIL_VERIFICATION_SECRET", "verification-secret")
+
+	expires := time.Now().Add(time.Hour).Unix()
+	expired := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name         string
+		input        VerifyEmailInput
+		wantErr      error
+		wantVerified bool
+	}{
+		{"valid link", VerifyEmailInput{UserID: 1, Expires: expires, Signature: signEmailVerification(1, "ava@example.com", expires)}, nil, true},
+		{"expired link", VerifyEmailInput{UserID: 1, Expires: expired, Signature: signEmailVerification(1, "ava@example.com", expired)}, ErrInvalidVerificationLink, false},
+		{"extended expiry", VerifyEmailInput{UserID: 1, Expires: expires + 3600, Signature: signEmailVerification(1, "ava@example.com", expires)}, ErrInvalidVerificationLink, false},
+		{"link for a previous email", VerifyEmailInput{UserID: 1, Expires: expires, Signature: signEmailVerification(1, "old@example.com", expires)}, ErrInvalidVerificationLink, false},
+		{"link of another user", VerifyEmailInput{UserID: 1, Expires: expires, Signature: signEmailVerification(2, "ava@example.com", expires)}, ErrInvalidVerificationLink, false},
+		{"unknown user", VerifyEmailInput{UserID: 2, Expires: expires, Signature: signEmailVerification(2, "ava@example.com", expires)}, ErrInvalidVerificationLink, false},
+		{"tampered signature", VerifyEmailInput{UserID: 1, Expires: expires, Signature: "00"}, ErrInvalidVerificationLink, false},
+	}
+
+	for _, tt := range tests {
+		repository := &verificationRepository{user: User{ID: 1, Email: "ava@example.com"}}
+		s := &service{repository: repository}
+
+		_, err := s.VerifyEmail(tt.input)
+
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: VerifyEmail returned %v, want %v", tt.name, err, tt.wantErr)
+		}
+
+		if repository.user.IsEmailVerified() != tt.wantVerified {
+			t.Errorf("%s: email verified = %v, want %v", tt.name, repository.user.IsEmailVerified(), tt.wantVerified)
+		}
+	}
+}
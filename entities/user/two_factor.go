@@ -0,0 +1,264 @@
+package user
+
+import (
+	"bwastartup/totp"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dchest/uniuri"
+)
+
+var ErrInvalidTwoFactorCode = errors.New("Invalid two-factor authentication code")
+var ErrTwoFactorAlreadyEnabled = errors.New("Two-factor authentication is already enabled")
+var ErrTwoFactorNotEnabled = errors.New("Two-factor authentication is not enabled")
+var ErrTwoFactorNotSetUp = errors.New("Two-factor authentication has not been set up")
+
+const backupCodeCount = 10
+
+// Characters that are easy to tell apart when copied from paper
+var backupCodeChars = []byte("abcdefghjkmnpqrstuvwxyz23456789")
+
+type TwoFactorSetup struct {
+	Secret string
+	URL    string
+}
+
+// SetupTwoFactor creates a new secret, it's only enforced once confirmed with a code from the authenticator
+func (s *service) SetupTwoFactor(user User) (TwoFactorSetup, error) {
+	if user.IsTwoFactorEnabled() {
+		return TwoFactorSetup{}, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+
+	encryptedSecret, err := encryptTwoFactorSecret(secret)
+
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+
+	user.TwoFactorSecret = encryptedSecret
+	user.UpdatedAt = time.Now()
+
+	if _, err := s.repository.Update(user); err != nil {
+		return TwoFactorSetup{}, err
+	}
+
+	return TwoFactorSetup{Secret: secret, URL: totp.URL(twoFactorIssuer(), user.Email, secret)}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication and returns the backup codes, they are never shown again
+func (s *service) ConfirmTwoFactor(user User, input TwoFactorCodeInput) ([]string, error) {
+	if user.IsTwoFactorEnabled() {
+		return []string{}, ErrTwoFactorAlreadyEnabled
+	}
+
+	if user.TwoFactorSecret == "" {
+		return []string{}, ErrTwoFactorNotSetUp
+	}
+
+	if err := s.verifyTOTP(user, input.Code); err != nil {
+		return []string{}, err
+	}
+
+	backupCodes := []string{}
+	storedBackupCodes := []BackupCode{}
+
+	for i := 0; i < backupCodeCount; i++ {
+		code := uniuri.NewLenChars(5, backupCodeChars) + "-" + uniuri.NewLenChars(5, backupCodeChars)
+
+		backupCodes = append(backupCodes, code)
+		storedBackupCodes = append(storedBackupCodes, BackupCode{UserID: user.ID, CodeHash: hashBackupCode(code), CreatedAt: time.Now()})
+	}
+
+	if err := s.repository.ReplaceBackupCodes(user.ID, storedBackupCodes); err != nil {
+		return []string{}, err
+	}
+
+	now := time.Now()
+	user.TwoFactorEnabledAt = &now
+	user.UpdatedAt = now
+
+	if _, err := s.repository.Update(user); err != nil {
+		return []string{}, err
+	}
+
+	return backupCodes, nil
+}
+
+func (s *service) DisableTwoFactor(user User, input DisableTwoFactorInput) (User, error) {
+	if !user.IsTwoFactorEnabled() {
+		return user, ErrTwoFactorNotEnabled
+	}
+
+	if err := checkPassword(user, input.Password); err != nil {
+		return user, err
+	}
+
+	if err := s.VerifyTwoFactor(user, input.Code); err != nil {
+		return user, err
+	}
+
+	if err := s.repository.ReplaceBackupCodes(user.ID, nil); err != nil {
+		return user, err
+	}
+
+	user.TwoFactorSecret = ""
+	user.TwoFactorEnabledAt = nil
+	user.UpdatedAt = time.Now()
+
+	updatedUser, err := s.repository.Update(user)
+
+	if err != nil {
+		return user, err
+	}
+
+	return updatedUser, nil
+}
+
+// VerifyTwoFactor accepts a code from the authenticator or an unused backup code
+func (s *service) VerifyTwoFactor(user User, code string) error {
+	if !user.IsTwoFactorEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	// Backup codes are the only codes with a dash
+	if strings.Contains(code, "-") {
+		used, err := s.repository.UseBackupCode(user.ID, hashBackupCode(code))
+
+		if err != nil {
+			return err
+		}
+
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+
+		return nil
+	}
+
+	return s.verifyTOTP(user, code)
+}
+
+func (s *service) verifyTOTP(user User, code string) error {
+	secret, err := decryptTwoFactorSecret(user.TwoFactorSecret)
+
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	// A code stays valid for its whole time step, it must not be accepted a second time
+	used, err := s.repository.UseTwoFactorStep(user.ID, step)
+
+	if err != nil {
+		return err
+	}
+
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// MissingRequiredTwoFactor tells whether the user holds one of the roles listed in TWO_FACTOR_REQUIRED_ROLES
+// (comma separated, e.g. "admin,finance") without having two-factor authentication enabled
+func (u User) MissingRequiredTwoFactor() bool {
+	if u.IsTwoFactorEnabled() {
+		return false
+	}
+
+	for _, role := range strings.Split(os.Getenv("TWO_FACTOR_REQUIRED_ROLES"), ",") {
+		if role = strings.TrimSpace(role); role != "" && u.HasRole(role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hashBackupCode(code string) string {
+	return hashToken(strings.ToLower(strings.TrimSpace(code)))
+}
+
+func twoFactorIssuer() string {
+	if issuer := os.Getenv("TWO_FACTOR_ISSUER"); issuer != "" {
+		return issuer
+	}
+
+	return "BWA Startup"
+}
+
+// twoFactorCipher encrypts secrets at rest with AES-GCM, a leaked database alone doesn't give away the codes
+func twoFactorCipher() (cipher.AEAD, error) {
+	key := os.Getenv("TWO_FACTOR_ENCRYPTION_KEY")
+
+	if key == "" {
+		key = os.Getenv("JWT_SECRET_KEY")
+	}
+
+	hashedKey := sha256.Sum256([]byte(key))
+
+	block, err := aes.NewCipher(hashedKey[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func encryptTwoFactorSecret(secret string) (string, error) {
+	gcm, err := twoFactorCipher()
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func decryptTwoFactorSecret(encryptedSecret string) (string, error) {
+	gcm, err := twoFactorCipher()
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encryptedSecret)
+
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("Unable to read two-factor secret")
+	}
+
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+
+	if err != nil {
+		return "", errors.New("Unable to read two-factor secret")
+	}
+
+	return string(secret), nil
+}
@@ -0,0 +1,98 @@
+package user
+
+import (
+	"bwastartup/totp"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stepRepository keeps the last used time step in memory the way UseTwoFactorStep does in the database
+type stepRepository struct {
+	Repository
+	lastStep int64
+}
+
+func (r *stepRepository) UseTwoFactorStep(userID int, step int64) (bool, error) {
+	if step <= r.lastStep {
+		return false, nil
+	}
+
+	r.lastStep = step
+
+	return true, nil
+}
+
+func TestVerifyTwoFactorRejectsReplayedCodes(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		t.Fatalf("GenerateSecret returned error: %v", err)
+	}
+
+	encryptedSecret, err := encryptTwoFactorSecret(secret)
+
+	if err != nil {
+		t.Fatalf("encryptTwoFactorSecret returned error: %v", err)
+	}
+
+	enabledAt := time.Now()
+	user := User{ID: 1, TwoFactorSecret: encryptedSecret, TwoFactorEnabledAt: &enabledAt}
+	current := totp.Step(time.Now())
+
+	codeAt := func(step int64) string {
+		code, err := totp.Code(secret, step)
+
+		if err != nil {
+			t.Fatalf("Code(%d) returned error: %v", step, err)
+		}
+
+		return code
+	}
+
+	s := &service{repository: &stepRepository{}}
+
+	tests := []struct {
+		name    string
+		code    string
+		wantErr error
+	}{
+		{"previous step", codeAt(current - 1), nil},
+		{"same code again", codeAt(current - 1), ErrInvalidTwoFactorCode},
+		{"current step", codeAt(current), nil},
+		{"earlier step after a later one", codeAt(current - 1), ErrInvalidTwoFactorCode},
+		{"current step again", codeAt(current), ErrInvalidTwoFactorCode},
+		{"next step", codeAt(current + 1), nil},
+	}
+
+	// The cases share the repository, each one depends on the steps used before it
+	for _, tt := range tests {
+		if err := s.VerifyTwoFactor(user, tt.code); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: VerifyTwoFactor = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTwoFactorSecretEncryption(t *testing.T) {
+	encryptedSecret, err := encryptTwoFactorSecret("JBSWY3DPEHPK3PXP")
+
+	if err != nil {
+		t.Fatalf("encryptTwoFactorSecret returned error: %v", err)
+	}
+
+	if encryptedSecret == "JBSWY3DPEHPK3PXP" {
+		t.Error("encryptTwoFactorSecret returned the secret in plain text")
+	}
+
+	secret, err := decryptTwoFactorSecret(encryptedSecret)
+
+	if err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("decryptTwoFactorSecret = (%q, %v), want JBSWY3DPEHPK3PXP", secret, err)
+	}
+
+	for _, invalid := range []string{"", "not base64", encryptedSecret[:len(encryptedSecret)-4] + "AAAA"} {
+		if _, err := decryptTwoFactorSecret(invalid); err == nil {
+			t.Errorf("decryptTwoFactorSecret(%q) returned no error", invalid)
+		}
+	}
+}
@@ -19,6 +19,7 @@ require (
 	github.com/muktiwbw/gdstorage v0.0.0-20210422221917-170a48025437 // indirect
 	github.com/veritrans/go-midtrans v0.0.0-20210226064730-b0852df0572b
 	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b
+	golang.org/x/image v0.0.0-20220302094943-723b81ca9867
 	golang.org/x/net v0.0.0-20210421230115-4e50805a0758 // indirect
 	golang.org/x/sys v0.0.0-20210421221651-33663a62ff08 // indirect
 	google.golang.org/genproto v0.0.0-20210422153429-2279cbceda62 // indirect
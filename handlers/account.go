@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bwastartup/auth"
+	"bwastartup/entities/campaign"
+	"bwastartup/entities/transaction"
+	"bwastartup/entities/user"
+	"bwastartup/helpers"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type accountHandler struct {
+	userService        user.Service
+	authService        auth.Service
+	campaignService    campaign.Service
+	transactionService transaction.Service
+}
+
+func NewAccountHandler(userService user.Service, authService auth.Service, campaignService campaign.Service, transactionService transaction.Service) *accountHandler {
+	return &accountHandler{userService, authService, campaignService, transactionService}
+}
+
+// ExportAccount returns the user's personal data, as a ZIP of JSON files by default or as a single JSON response with ?format=json
+func (h *accountHandler) ExportAccount(c *gin.Context) {
+	var input user.ExportAccountInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input query", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	campaigns, err := h.campaignService.GetCampaignsByUserID(authUser.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	transactions, err := h.transactionService.GetAllTransactionsByRef(authUser.ID, "user_id")
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	formattedCampaigns := []campaign.CampaignFormat{}
+
+	for _, cmp := range campaigns {
+		formattedCampaigns = append(formattedCampaigns, campaign.FormatCampaign(cmp))
+	}
+
+	formattedTransactions := []transaction.TransactionFormat{}
+
+	for _, trx := range transactions {
+		formattedTransactions = append(formattedTransactions, transaction.FormatTransaction(trx))
+	}
+
+	// Each entry becomes a file in the archive
+	export := map[string]interface{}{
+		"user":         user.FormatUserExport(authUser),
+		"campaigns":    formattedCampaigns,
+		"transactions": formattedTransactions,
+	}
+
+	if input.Format == "json" {
+		c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", export))
+
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"bwastartup-export-%d-%s.zip\"", authUser.ID, time.Now().Format("20060102")))
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+
+	for _, name := range []string{"user", "campaigns", "transactions"} {
+		file, err := archive.Create(name + ".json")
+
+		if err == nil {
+			encoder := json.NewEncoder(file)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(export[name])
+		}
+
+		// Headers are already sent at this point, the truncated archive will fail to open on the client
+		if err != nil {
+			log.Printf("Account export: unable to write %s.json for user %d: %v\n", name, authUser.ID, err)
+
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Printf("Account export: unable to finish archive for user %d: %v\n", authUser.ID, err)
+	}
+}
+
+func (h *accountHandler) DeleteAccount(c *gin.Context) {
+	var input user.DeleteAccountInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	campaigns, err := h.campaignService.GetCampaignsByUserID(authUser.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	activeCampaigns := []campaign.Campaign{}
+
+	for _, cmp := range campaigns {
+		if cmp.FundingStatus != campaign.FundingStatusActive {
+			continue
+		}
+
+		hasMoneyInFlight, err := h.hasMoneyInFlight(cmp)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+			return
+		}
+
+		// Backers' money has to be settled or refunded before the owner can go
+		if hasMoneyInFlight {
+			c.JSON(http.StatusConflict, helpers.APIResponse("Akun tidak dapat dihapus selama masih memiliki campaign aktif dengan dana masuk", http.StatusConflict, "error", gin.H{"campaign_id": cmp.ID}))
+
+			return
+		}
+
+		activeCampaigns = append(activeCampaigns, cmp)
+	}
+
+	err = h.userService.CheckPassword(authUser, input.Password)
+
+	if errors.Is(err, user.ErrPasswordNotSet) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Atur password terlebih dahulu melalui POST /me/password", http.StatusUnprocessableEntity, "password-not-set", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, user.ErrIncorrectPassword) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Password salah", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	// Campaigns without any backing are taken down first so nobody pledges to an account that no longer exists
+	for _, cmp := range activeCampaigns {
+		if _, err := h.campaignService.TakeDown(cmp, "Creator deleted their account"); err != nil {
+			c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+			return
+		}
+	}
+
+	// Sessions and API keys go next, nothing may keep acting as the account while it is being anonymised
+	if err := h.authService.LogoutAll(authUser.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err := h.authService.RevokeAllAPIKeys(authUser.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	_, err = h.userService.DeleteAccount(authUser, input)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Akun berhasil dihapus", http.StatusOK, "deleted", nil))
+}
+
+// hasMoneyInFlight tells whether the campaign has payments that are pending or collected and not fully refunded.
+// A pending refund doesn't change the status of its transaction, so the transaction counts until the refund completes
+func (h *accountHandler) hasMoneyInFlight(cmp campaign.Campaign) (bool, error) {
+	if cmp.CurrentAmount > 0 {
+		return true, nil
+	}
+
+	transactions, err := h.transactionService.GetAllTransactionsByRef(cmp.ID, "campaign_id")
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, trx := range transactions {
+		if trx.Status == transaction.StatusPending || trx.Status.IsSettled() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
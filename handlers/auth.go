@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bwastartup/auth"
+	"bwastartup/entities/user"
+	"bwastartup/helpers"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type authHandler struct {
+	authService auth.Service
+	userService user.Service
+}
+
+func NewAuthHandler(authService auth.Service, userService user.Service) *authHandler {
+	return &authHandler{authService, userService}
+}
+
+func (h *authHandler) RefreshToken(c *gin.Context) {
+	var input auth.RefreshTokenInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	tokenPair, userID, err := h.authService.RefreshToken(input.RefreshToken)
+
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
+		c.JSON(http.StatusUnauthorized, helpers.APIResponse("Refresh token tidak valid", http.StatusUnauthorized, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	refreshedUser, err := h.userService.GetUserByID(userID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Token berhasil diperbarui", http.StatusOK, "success", user.FormatUser(refreshedUser, tokenPair.AccessToken, tokenPair.RefreshToken)))
+}
+
+func (h *authHandler) Logout(c *gin.Context) {
+	authClaims := c.MustGet("authClaims").(auth.AccessClaims)
+
+	if err := h.authService.Logout(authClaims); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Berhasil logout", http.StatusOK, "success", nil))
+}
+
+func (h *authHandler) LogoutAll(c *gin.Context) {
+	authClaims := c.MustGet("authClaims").(auth.AccessClaims)
+
+	// Revoke the current access token too, in case it was issued before a refresh token got rotated
+	if err := h.authService.Logout(authClaims); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err := h.authService.LogoutAll(authClaims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Berhasil logout dari semua perangkat", http.StatusOK, "success", nil))
+}
+
+func (h *authHandler) GetAPIKeys(c *gin.Context) {
+	authUser := c.MustGet("authUser").(user.User)
+
+	apiKeys, err := h.authService.GetAPIKeys(authUser.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Berhasil mengambil data API key", http.StatusOK, "success", auth.FormatAPIKeys(apiKeys)))
+}
+
+func (h *authHandler) CreateAPIKey(c *gin.Context) {
+	var input auth.CreateAPIKeyInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	apiKey, key, err := h.authService.CreateAPIKey(authUser.ID, input)
+
+	if errors.Is(err, auth.ErrInvalidScope) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Scope tidak valid", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, helpers.APIResponse("API key berhasil dibuat, simpan key ini karena tidak akan ditampilkan lagi", http.StatusCreated, "created", auth.FormatAPIKey(apiKey, key)))
+}
+
+func (h *authHandler) RevokeAPIKey(c *gin.Context) {
+	var input auth.APIKeyInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input API key ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	apiKey, err := h.authService.GetAPIKeyByID(input.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	// Someone else's key is reported as missing so key IDs can't be probed
+	if apiKey.ID <= 0 || apiKey.UserID != authUser.ID {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("API key tidak ditemukan", http.StatusNotFound, "not-found", nil))
+
+		return
+	}
+
+	revokedAPIKey, err := h.authService.RevokeAPIKey(apiKey)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("API key berhasil dicabut", http.StatusOK, "success", auth.FormatAPIKey(revokedAPIKey, "")))
+}
+
+// isAPIKeyRequest tells whether the request is authenticated by a personal API key, those only act on the user's own
+// resources and never with the staff permissions of the user
+func isAPIKeyRequest(c *gin.Context) bool {
+	_, ok := c.Get("authAPIKey")
+
+	return ok
+}
@@ -2,24 +2,42 @@ package handlers
 
 import (
 	"bwastartup/entities/campaign"
+	"bwastartup/entities/upload"
 	"bwastartup/entities/user"
 	"bwastartup/helpers"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type campaignHandler struct {
 	campaignService campaign.Service
+	uploadService   upload.Service
 }
 
-func NewCampaignHandler(campaignService campaign.Service) *campaignHandler {
-	return &campaignHandler{campaignService}
+func NewCampaignHandler(campaignService campaign.Service, uploadService upload.Service) *campaignHandler {
+	return &campaignHandler{campaignService, uploadService}
 }
 
 func (h campaignHandler) GetAllCampaigns(c *gin.Context) {
-	campaigns, err := h.campaignService.GetAllCampaigns()
+	var input campaign.GetCampaignsInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input query", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	// Drafts and campaigns under review or suspended are only listed to their creator and to staff
+	input.CampaignStatuses = campaign.VisibleStatuses(input.CampaignStatuses)
+
+	campaigns, total, err := h.campaignService.GetAllCampaigns(input)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
@@ -35,14 +53,25 @@ func (h campaignHandler) GetAllCampaigns(c *gin.Context) {
 		formattedCampaigns = append(formattedCampaigns, campaign.FormatCampaignThumbnail(cmp))
 	}
 
-	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", formattedCampaigns))
+	c.JSON(http.StatusOK, helpers.APIResponseWithPagination("Ok", http.StatusOK, "success", formattedCampaigns, helpers.NewPagination(input.PaginationInput, total)))
 }
 
 func (h campaignHandler) GetOwnCampaigns(c *gin.Context) {
+	var input campaign.GetCampaignsInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input query", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
 	// Make sure that the type is User
 	authUser := c.MustGet("authUser").(user.User)
+	input.UserID = authUser.ID
 
-	campaigns, err := h.campaignService.GetCampaigsByUserID(authUser.ID)
+	campaigns, total, err := h.campaignService.GetAllCampaigns(input)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
@@ -56,7 +85,29 @@ func (h campaignHandler) GetOwnCampaigns(c *gin.Context) {
 		formattedCampaigns = append(formattedCampaigns, campaign.FormatCampaignThumbnail(cmp))
 	}
 
-	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", formattedCampaigns))
+	c.JSON(http.StatusOK, helpers.APIResponseWithPagination("Ok", http.StatusOK, "success", formattedCampaigns, helpers.NewPagination(input.PaginationInput, total)))
+}
+
+func (h campaignHandler) SearchCampaigns(c *gin.Context) {
+	var input campaign.SearchCampaignsInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input query", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	results, total, err := h.campaignService.SearchCampaigns(input)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponseWithPagination("Ok", http.StatusOK, "success", campaign.FormatCampaignSearchResults(results), helpers.NewPagination(input.PaginationInput, total)))
 }
 
 func (h campaignHandler) GetCampaignByID(c *gin.Context) {
@@ -78,7 +129,7 @@ func (h campaignHandler) GetCampaignByID(c *gin.Context) {
 		return
 	}
 
-	if foundCampaign.ID <= 0 {
+	if foundCampaign.ID <= 0 || !foundCampaign.IsVisible() {
 		c.JSON(http.StatusNotFound, helpers.APIResponse("Not found", http.StatusNotFound, "success", nil))
 
 		return
@@ -87,6 +138,62 @@ func (h campaignHandler) GetCampaignByID(c *gin.Context) {
 	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", campaign.FormatCampaign(foundCampaign)))
 }
 
+func (h campaignHandler) GetCampaignBySlug(c *gin.Context) {
+	var input campaign.GetCampaignBySlugInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input slug", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundCampaign, err := h.campaignService.GetCampaignBySlug(input.Slug)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if foundCampaign.ID > 0 && foundCampaign.IsVisible() {
+		c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", campaign.FormatCampaign(foundCampaign)))
+
+		return
+	}
+
+	// The slug may be from before the campaign was renamed, send the client to the current one
+	redirect, err := h.campaignService.GetCampaignSlugRedirect(input.Slug)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if redirect.ID > 0 {
+		redirectedCampaign, err := h.campaignService.GetCampaignByID(redirect.CampaignID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+			return
+		}
+
+		if redirectedCampaign.ID > 0 && redirectedCampaign.IsVisible() {
+			location := *c.Request.URL
+			location.Path = strings.TrimSuffix(location.Path, input.Slug) + redirectedCampaign.Slug
+
+			c.Redirect(http.StatusMovedPermanently, location.String())
+
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, helpers.APIResponse("Data campaign tidak ditemukan", http.StatusNotFound, "not-found", nil))
+}
+
 func (h campaignHandler) CreateCampaign(c *gin.Context) {
 	var input campaign.CreateCampaignInput
 
@@ -103,6 +210,12 @@ func (h campaignHandler) CreateCampaign(c *gin.Context) {
 
 	createdCampaign, err := h.campaignService.CreateCampaign(input)
 
+	if errors.Is(err, campaign.ErrInvalidSchedule) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Invalid campaign schedule", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("There's an error from the server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
 
@@ -209,6 +322,156 @@ func (h campaignHandler) DeleteCampaign(c *gin.Context) {
 	c.JSON(http.StatusNoContent, helpers.APIResponse("Successfully deleted a campaign", http.StatusNoContent, "deleted", nil))
 }
 
+// GetCampaignsForModeration lists campaigns in every status, e.g. ?campaign_status=in_review for the review queue
+func (h campaignHandler) GetCampaignsForModeration(c *gin.Context) {
+	var input campaign.GetCampaignsInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input query", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	campaigns, total, err := h.campaignService.GetAllCampaigns(input)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	formattedCampaigns := []campaign.CampaignThumbnailFormat{}
+
+	for _, cmp := range campaigns {
+		formattedCampaigns = append(formattedCampaigns, campaign.FormatCampaignThumbnail(cmp))
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponseWithPagination("Ok", http.StatusOK, "success", formattedCampaigns, helpers.NewPagination(input.PaginationInput, total)))
+}
+
+// GetCampaignPreview shows a campaign in any status to its creator and to moderators
+func (h campaignHandler) GetCampaignPreview(c *gin.Context) {
+	var uri campaign.GetCampaignByIDInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input campaign ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundCampaign, ok := h.findReviewableCampaign(c, uri.ID)
+
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", campaign.FormatCampaign(foundCampaign)))
+}
+
+func (h campaignHandler) UpdateCampaignStatus(c *gin.Context) {
+	var uri campaign.GetCampaignByIDInput
+	var input campaign.UpdateCampaignStatusInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input campaign ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	err = c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input field", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundCampaign, err := h.campaignService.GetCampaignByID(uri.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if foundCampaign.ID <= 0 {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Data campaign tidak ditemukan", http.StatusNotFound, "not-found", nil))
+
+		return
+	}
+
+	// Who may take which step is decided by the lifecycle rules, not here
+	authUser := c.MustGet("authUser").(user.User)
+
+	if authUser.ID != foundCampaign.UserID && isAPIKeyRequest(c) {
+		c.JSON(http.StatusForbidden, helpers.APIResponse("API key hanya dapat mengubah status campaign milik sendiri", http.StatusForbidden, "forbidden", nil))
+
+		return
+	}
+
+	updatedCampaign, err := h.campaignService.TransitionStatus(foundCampaign, input.Status, authUser, input.Notes)
+
+	if errors.Is(err, campaign.ErrForbiddenStatusTransition) && authUser.MissingRequiredTwoFactor() {
+		c.JSON(http.StatusForbidden, helpers.APIResponse("Aktifkan autentikasi dua langkah untuk mengubah status campaign ini", http.StatusForbidden, "two-factor-required", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, campaign.ErrForbiddenStatusTransition) {
+		c.JSON(http.StatusForbidden, helpers.APIResponse("Anda tidak punya wewenang untuk mengubah status campaign ini", http.StatusForbidden, "forbidden", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, campaign.ErrInvalidStatusTransition) || errors.Is(err, campaign.ErrInvalidSchedule) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Invalid campaign status", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Successfully updated the campaign status", http.StatusOK, "updated", campaign.FormatCampaign(updatedCampaign)))
+}
+
+func (h campaignHandler) GetCampaignStatusHistory(c *gin.Context) {
+	var uri campaign.GetCampaignByIDInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input campaign ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundCampaign, ok := h.findReviewableCampaign(c, uri.ID)
+
+	if !ok {
+		return
+	}
+
+	histories, err := h.campaignService.GetStatusHistories(foundCampaign.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", campaign.FormatCampaignStatusHistories(histories)))
+}
+
 func (h campaignHandler) CreateCampaignImages(c *gin.Context) {
 	form, err := c.MultipartForm()
 	if err != nil {
@@ -219,7 +482,7 @@ func (h campaignHandler) CreateCampaignImages(c *gin.Context) {
 
 	images := form.File["images"]
 	if len(images) <= 0 {
-		c.JSON(http.StatusBadRequest, helpers.APIResponse("File not found", http.StatusBadRequest, "error", gin.H{"error": err.Error()}))
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("File not found", http.StatusBadRequest, "error", nil))
 
 		return
 	}
@@ -231,32 +494,392 @@ func (h campaignHandler) CreateCampaignImages(c *gin.Context) {
 		return
 	}
 
+	foundCampaign, ok := h.findOwnedCampaign(c, uri.ID)
+
+	if !ok {
+		return
+	}
+
+	coverIndex, err := strconv.Atoi(c.PostForm("cover_index"))
+	if err != nil || coverIndex < 0 || coverIndex >= len(images) {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Invalid cover index", http.StatusBadRequest, "error", gin.H{"error": fmt.Sprintf("cover_index must be a number from 0 to %d", len(images)-1)}))
+
+		return
+	}
+
+	// The images are processed in the background, clients poll GET /uploads/:job_id for the result
+	uploadJob, err := h.uploadService.CreateCampaignImagesJob(c.MustGet("authUser").(user.User).ID, foundCampaign.ID, coverIndex, images)
+	if errors.Is(err, upload.ErrInvalidUpload) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Invalid campaign images", http.StatusUnprocessableEntity, "error", gin.H{"are_uploaded": false, "error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("There's an error from the server", http.StatusInternalServerError, "error", gin.H{"are_uploaded": false}))
+
+		return
+	}
+
+	c.JSON(http.StatusAccepted, helpers.APIResponse("Campaign images are being processed", http.StatusAccepted, "accepted", gin.H{"are_uploaded": true, "upload": upload.FormatUploadJob(uploadJob)}))
+}
+
+func (h campaignHandler) UpdateCampaignImage(c *gin.Context) {
+	var uri campaign.GetCampaignImageInput
+	var input campaign.UpdateCampaignImageInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input image ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundImage, ok := h.findOwnedCampaignImage(c, uri)
+
+	if !ok {
+		return
+	}
+
+	err = c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input field", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	updatedImage, err := h.campaignService.UpdateCampaignImage(foundImage, input)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Successfully updated a campaign image", http.StatusOK, "updated", campaign.FormatCampaignImages([]campaign.CampaignImage{updatedImage})[0]))
+}
+
+func (h campaignHandler) ReorderCampaignImages(c *gin.Context) {
+	var uri campaign.GetCampaignByIDInput
+	var input campaign.ReorderCampaignImagesInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input campaign ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundCampaign, ok := h.findOwnedCampaign(c, uri.ID)
+
+	if !ok {
+		return
+	}
+
+	err = c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input field", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	reorderedImages, err := h.campaignService.ReorderCampaignImages(foundCampaign, input)
+
+	if errors.Is(err, campaign.ErrInvalidImageOrder) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Urutan gambar tidak valid", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Successfully reordered campaign images", http.StatusOK, "updated", campaign.FormatCampaignImages(reorderedImages)))
+}
+
+func (h campaignHandler) DeleteCampaignImage(c *gin.Context) {
+	var uri campaign.GetCampaignImageInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input image ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundImage, ok := h.findOwnedCampaignImage(c, uri)
+
+	if !ok {
+		return
+	}
+
+	err = h.campaignService.DeleteCampaignImage(foundImage)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusNoContent, helpers.APIResponse("Successfully deleted a campaign image", http.StatusNoContent, "deleted", nil))
+}
+
+func (h campaignHandler) GetCampaignRewards(c *gin.Context) {
+	var uri campaign.GetCampaignByIDInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input campaign ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
 	foundCampaign, err := h.campaignService.GetCampaignByID(uri.ID)
+
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.APIResponse("There's an error from the server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
 
 		return
 	}
 
-	if foundCampaign.ID <= 0 {
-		c.JSON(http.StatusNotFound, helpers.APIResponse("Campaign not found", http.StatusNotFound, "not-found", nil))
+	if foundCampaign.ID <= 0 || !foundCampaign.IsVisible() {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Data campaign tidak ditemukan", http.StatusNotFound, "not-found", nil))
 
 		return
 	}
 
-	coverIndex, err := strconv.Atoi(form.Value["cover_index"][0])
+	rewards, err := h.campaignService.GetCampaignRewards(foundCampaign.ID)
+
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.APIResponse("There's an error from the server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", campaign.FormatCampaignRewards(rewards)))
+}
+
+func (h campaignHandler) CreateCampaignReward(c *gin.Context) {
+	var uri campaign.GetCampaignByIDInput
+	var input campaign.CampaignRewardInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input campaign ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
 
 		return
 	}
 
-	createdImages, err := h.campaignService.CreateCampaignImages(foundCampaign.ID, coverIndex, images)
+	foundCampaign, ok := h.findOwnedCampaign(c, uri.ID)
+
+	if !ok {
+		return
+	}
+
+	err = c.ShouldBindJSON(&input)
+
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, helpers.APIResponse("There's an error from the server", http.StatusInternalServerError, "error", gin.H{"are_uploaded": false}))
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input field", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
 
 		return
 	}
 
-	c.JSON(http.StatusCreated, helpers.APIResponse("Successfully uploaded campaign images", http.StatusCreated, "created", gin.H{"are_uploaded": true, "images": campaign.FormatCampaignImages(createdImages)}))
+	createdReward, err := h.campaignService.CreateCampaignReward(foundCampaign.ID, input)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, helpers.APIResponse("Successfully created a campaign reward", http.StatusCreated, "created", campaign.FormatCampaignReward(createdReward)))
+}
+
+func (h campaignHandler) UpdateCampaignReward(c *gin.Context) {
+	var uri campaign.GetCampaignRewardInput
+	var input campaign.CampaignRewardInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input reward ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundReward, ok := h.findOwnedCampaignReward(c, uri)
+
+	if !ok {
+		return
+	}
+
+	err = c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input field", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	updatedReward, err := h.campaignService.UpdateCampaignReward(foundReward, input)
+
+	if errors.Is(err, campaign.ErrInvalidReward) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Reward tidak dapat diubah", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Successfully updated a campaign reward", http.StatusOK, "updated", campaign.FormatCampaignReward(updatedReward)))
+}
+
+func (h campaignHandler) DeleteCampaignReward(c *gin.Context) {
+	var uri campaign.GetCampaignRewardInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input reward ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundReward, ok := h.findOwnedCampaignReward(c, uri)
+
+	if !ok {
+		return
+	}
+
+	err = h.campaignService.DeleteCampaignReward(foundReward)
+
+	if errors.Is(err, campaign.ErrInvalidReward) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Reward tidak dapat dihapus", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusNoContent, helpers.APIResponse("Successfully deleted a campaign reward", http.StatusNoContent, "deleted", nil))
+}
+
+// findOwnedCampaign writes the error response itself and returns false when the campaign can't be managed by the current user
+func (h campaignHandler) findOwnedCampaign(c *gin.Context, campaignID int) (campaign.Campaign, bool) {
+	foundCampaign, err := h.campaignService.GetCampaignByID(campaignID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return foundCampaign, false
+	}
+
+	if foundCampaign.ID <= 0 {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Data campaign tidak ditemukan", http.StatusNotFound, "not-found", nil))
+
+		return foundCampaign, false
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	if authUser.ID != foundCampaign.UserID {
+		c.JSON(http.StatusUnauthorized, helpers.APIResponse("Anda tidak punya wewenang untuk mengubah data campaign ini", http.StatusUnauthorized, "unauthorized", nil))
+
+		return foundCampaign, false
+	}
+
+	return foundCampaign, true
+}
+
+// findReviewableCampaign looks the campaign up for its creator or a moderator, whatever its status
+func (h campaignHandler) findReviewableCampaign(c *gin.Context, campaignID int) (campaign.Campaign, bool) {
+	foundCampaign, err := h.campaignService.GetCampaignByID(campaignID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return foundCampaign, false
+	}
+
+	if foundCampaign.ID <= 0 {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Data campaign tidak ditemukan", http.StatusNotFound, "not-found", nil))
+
+		return foundCampaign, false
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	if authUser.ID != foundCampaign.UserID && (isAPIKeyRequest(c) || !authUser.HasPermission(user.PermissionModerateCampaigns)) {
+		c.JSON(http.StatusUnauthorized, helpers.APIResponse("Anda tidak punya wewenang untuk melihat data campaign ini", http.StatusUnauthorized, "unauthorized", nil))
+
+		return foundCampaign, false
+	}
+
+	return foundCampaign, true
+}
+
+func (h campaignHandler) findOwnedCampaignReward(c *gin.Context, uri campaign.GetCampaignRewardInput) (campaign.CampaignReward, bool) {
+	foundCampaign, ok := h.findOwnedCampaign(c, uri.CampaignID)
+
+	if !ok {
+		return campaign.CampaignReward{}, false
+	}
+
+	foundReward, err := h.campaignService.GetCampaignRewardByID(uri.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return foundReward, false
+	}
+
+	if foundReward.ID <= 0 || foundReward.CampaignID != foundCampaign.ID {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Reward tidak ditemukan", http.StatusNotFound, "not-found", nil))
+
+		return foundReward, false
+	}
+
+	return foundReward, true
+}
+
+func (h campaignHandler) findOwnedCampaignImage(c *gin.Context, uri campaign.GetCampaignImageInput) (campaign.CampaignImage, bool) {
+	foundCampaign, ok := h.findOwnedCampaign(c, uri.CampaignID)
+
+	if !ok {
+		return campaign.CampaignImage{}, false
+	}
+
+	foundImage, err := h.campaignService.GetCampaignImageByID(uri.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return foundImage, false
+	}
+
+	if foundImage.ID <= 0 || foundImage.CampaignID != foundCampaign.ID {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Gambar tidak ditemukan", http.StatusNotFound, "not-found", nil))
+
+		return foundImage, false
+	}
+
+	return foundImage, true
 }
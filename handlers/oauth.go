@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bwastartup/auth"
+	"bwastartup/entities/user"
+	"bwastartup/helpers"
+	"bwastartup/oauth"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+const oauthStateCookie = "oauth_state"
+
+type oauthHandler struct {
+	providers   map[string]oauth.Provider
+	userService user.Service
+	authService auth.Service
+}
+
+func NewOAuthHandler(providers []oauth.Provider, userService user.Service, authService auth.Service) *oauthHandler {
+	providersByName := map[string]oauth.Provider{}
+
+	for _, provider := range providers {
+		providersByName[provider.Name()] = provider
+	}
+
+	return &oauthHandler{providersByName, userService, authService}
+}
+
+func oauthStateSecret() []byte {
+	if secret := os.Getenv("OAUTH_STATE_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	return []byte(os.Getenv("JWT_SECRET_KEY"))
+}
+
+// Redirect sends the browser to the provider's consent screen
+func (h *oauthHandler) Redirect(c *gin.Context) {
+	var input user.OAuthProviderInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input provider", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	provider, ok := h.providers[input.Provider]
+
+	if !ok {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Provider tidak tersedia", http.StatusNotFound, "not-found", nil))
+
+		return
+	}
+
+	state, nonce := oauth.NewState(provider.Name(), oauthStateSecret())
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, nonce, 600, "/", "", c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https", true)
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state))
+}
+
+func (h *oauthHandler) Callback(c *gin.Context) {
+	var providerInput user.OAuthProviderInput
+	var input user.OAuthCallbackInput
+
+	err := c.ShouldBindUri(&providerInput)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input provider", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	provider, ok := h.providers[providerInput.Provider]
+
+	if !ok {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Provider tidak tersedia", http.StatusNotFound, "not-found", nil))
+
+		return
+	}
+
+	err = c.ShouldBindQuery(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Login dibatalkan atau tidak valid", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	nonce, _ := c.Cookie(oauthStateCookie)
+	c.SetCookie(oauthStateCookie, "", -1, "/", "", false, true)
+
+	if err := oauth.VerifyState(input.State, provider.Name(), nonce, oauthStateSecret()); err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Sesi login tidak valid, silakan coba lagi", http.StatusBadRequest, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	identity, err := provider.Exchange(input.Code)
+
+	if err != nil {
+		c.JSON(http.StatusBadGateway, helpers.APIResponse("Gagal login melalui "+provider.Name(), http.StatusBadGateway, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	identityInput := user.IdentityInput{
+		Provider:      identity.Provider,
+		Subject:       identity.Subject,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Name:          identity.Name,
+	}
+
+	authenticatedUser, err := h.userService.LoginWithIdentity(identityInput)
+
+	if errors.Is(err, user.ErrIdentityClaimsAccount) {
+		authenticatedUser, err = h.claimAccount(authenticatedUser, identityInput)
+	}
+
+	if errors.Is(err, user.ErrUnverifiedIdentityEmail) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Email pada akun "+provider.Name()+" belum diverifikasi", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	// A social login replaces the password, not the second factor
+	if authenticatedUser.IsTwoFactorEnabled() {
+		challengeToken, err := h.authService.GenerateChallengeToken(authenticatedUser.ID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+			return
+		}
+
+		c.JSON(http.StatusOK, helpers.APIResponse("Masukkan kode autentikasi dua langkah", http.StatusOK, "two-factor-required", gin.H{"two_factor_required": true, "challenge_token": challengeToken}))
+
+		return
+	}
+
+	tokenPair, err := h.authService.GenerateToken(authenticatedUser.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terdapat kesalahan membuat token", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Berhasil login", http.StatusOK, "success", user.FormatUser(authenticatedUser, tokenPair.AccessToken, tokenPair.RefreshToken)))
+}
+
+// claimAccount ends every session and API key of an account whose email was never verified before the identity takes
+// it over, whoever registered it may have been someone else waiting for the owner of the address to show up
+func (h *oauthHandler) claimAccount(claimedUser user.User, input user.IdentityInput) (user.User, error) {
+	if err := h.authService.LogoutAll(claimedUser.ID); err != nil {
+		return claimedUser, err
+	}
+
+	if err := h.authService.RevokeAllAPIKeys(claimedUser.ID); err != nil {
+		return claimedUser, err
+	}
+
+	return h.userService.ClaimAccountWithIdentity(claimedUser, input)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bwastartup/entities/campaign"
+	"bwastartup/entities/payment"
+	"bwastartup/entities/transaction"
+	"bwastartup/helpers"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type paymentHandler struct {
+	paymentService     payment.Service
+	transactionService transaction.Service
+	campaignService    campaign.Service
+}
+
+func NewPaymentHandler(paymentService payment.Service, transactionService transaction.Service, campaignService campaign.Service) *paymentHandler {
+	return &paymentHandler{paymentService, transactionService, campaignService}
+}
+
+func (h paymentHandler) HandleNotification(c *gin.Context) {
+	var input payment.NotificationInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Invalid notification payload", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	h.processNotification(c, input)
+}
+
+// SimulateNotification lets the fake payment gateway settle, deny or expire a payment as if Midtrans had called us
+func (h paymentHandler) SimulateNotification(c *gin.Context) {
+	var input payment.SimulateNotificationInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input field", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	notification, err := h.paymentService.SimulateNotification(input.OrderID, input.TransactionStatus)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Unable to simulate notification", http.StatusBadRequest, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	h.processNotification(c, notification)
+}
+
+func (h paymentHandler) processNotification(c *gin.Context, input payment.NotificationInput) {
+	if err := h.paymentService.VerifyNotification(input); err != nil {
+		c.JSON(http.StatusForbidden, helpers.APIResponse("Invalid notification signature", http.StatusForbidden, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	foundTransaction, err := h.transactionService.GetTransactionByCode(input.OrderID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if foundTransaction.ID <= 0 {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Transaksi tidak ditemukan", http.StatusNotFound, "not-found", nil))
+
+		return
+	}
+
+	// A valid signature only proves the payload came from Midtrans, make sure it is about the amount we charged
+	grossAmount, err := strconv.ParseFloat(input.GrossAmount, 64)
+
+	if err != nil || int(grossAmount) != foundTransaction.Amount {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Gross amount does not match the transaction", http.StatusBadRequest, "error", nil))
+
+		return
+	}
+
+	newStatus := transaction.Status(h.paymentService.GetTransactionStatus(input))
+
+	// Refunds are booked from the amounts in the notification, the status follows from what was given back
+	if newStatus == transaction.StatusRefunded || newStatus == transaction.StatusPartiallyRefunded {
+		h.processRefundNotification(c, foundTransaction, input)
+
+		return
+	}
+
+	// Unknown statuses (e.g. authorize) don't affect our transaction, acknowledge them so Midtrans stops retrying.
+	// A repeated settlement goes on, giving the money back to a failed campaign's backer may have failed the first time
+	if newStatus == "" || (newStatus == foundTransaction.Status && newStatus != transaction.StatusPaid) {
+		c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", transaction.FormatTransaction(foundTransaction)))
+
+		return
+	}
+
+	updatedTransaction := foundTransaction
+
+	if newStatus != foundTransaction.Status {
+		updatedTransaction, err = h.transactionService.TransitionStatus(foundTransaction, newStatus, transaction.ActorWebhook, "Midtrans notification: "+input.TransactionStatus)
+
+		if errors.Is(err, transaction.ErrInvalidStatusTransition) {
+			// Notifications can arrive late or out of order, they must never move a transaction backwards
+			c.JSON(http.StatusOK, helpers.APIResponse("Notification ignored", http.StatusOK, "ignored", gin.H{"error": err.Error()}))
+
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+			return
+		}
+	}
+
+	// Payments that settle after an all-or-nothing campaign failed are given back right away
+	if updatedTransaction.Status == transaction.StatusPaid {
+		updatedTransaction, err = h.refundIfCampaignFailed(updatedTransaction)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Successfully processed payment notification", http.StatusOK, "updated", transaction.FormatTransaction(updatedTransaction)))
+}
+
+func (h paymentHandler) processRefundNotification(c *gin.Context, foundTransaction transaction.Transaction, input payment.NotificationInput) {
+	updatedTransaction, err := h.transactionService.RecordGatewayRefunds(foundTransaction, input.Refunds, "Midtrans notification: "+input.TransactionStatus)
+
+	if errors.Is(err, transaction.ErrInvalidGatewayRefund) || errors.Is(err, transaction.ErrRefundExceedsAmount) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Unable to record the refund", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, transaction.ErrInvalidStatusTransition) {
+		c.JSON(http.StatusOK, helpers.APIResponse("Notification ignored", http.StatusOK, "ignored", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Successfully processed payment notification", http.StatusOK, "updated", transaction.FormatTransaction(updatedTransaction)))
+}
+
+// refundIfCampaignFailed reads the campaign again, it may have failed after the transaction was loaded
+func (h paymentHandler) refundIfCampaignFailed(paidTransaction transaction.Transaction) (transaction.Transaction, error) {
+	foundCampaign, err := h.campaignService.GetCampaignByID(paidTransaction.CampaignID)
+
+	if err != nil {
+		return paidTransaction, err
+	}
+
+	if foundCampaign.FundingStatus != campaign.FundingStatusFailed {
+		return paidTransaction, nil
+	}
+
+	return h.transactionService.RefundRemaining(paidTransaction, transaction.ActorWebhook, "Campaign ended below its goal")
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"bwastartup/entities/campaign"
+	"bwastartup/entities/payment"
+	"bwastartup/entities/transaction"
+	"bwastartup/helpers"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notificationTransactionService holds a single transaction and logs what the handler does to it
+type notificationTransactionService struct {
+	transaction.Service
+	transaction   transaction.Transaction
+	transitionErr error
+	calls         []string
+}
+
+func (s *notificationTransactionService) GetTransactionByCode(code string) (transaction.Transaction, error) {
+	if code != s.transaction.Code {
+		return transaction.Transaction{}, nil
+	}
+
+	return s.transaction, nil
+}
+
+func (s *notificationTransactionService) TransitionStatus(trx transaction.Transaction, status transaction.Status, actor transaction.Actor, reason string) (transaction.Transaction, error) {
+	s.calls = append(s.calls, fmt.Sprintf("transition %s", status))
+
+	if s.transitionErr != nil {
+		return trx, s.transitionErr
+	}
+
+	trx.Status = status
+
+	return trx, nil
+}
+
+func (s *notificationTransactionService) RefundRemaining(trx transaction.Transaction, actor transaction.Actor, reason string) (transaction.Transaction, error) {
+	s.calls = append(s.calls, "refund remaining")
+
+	return trx, nil
+}
+
+func (s *notificationTransactionService) RecordGatewayRefunds(trx transaction.Transaction, refunds []payment.NotificationRefund, reason string) (transaction.Transaction, error) {
+	s.calls = append(s.calls, fmt.Sprintf("record %d refunds", len(refunds)))
+
+	return trx, nil
+}
+
+type notificationCampaignService struct {
+	campaign.Service
+	fundingStatus string
+}
+
+func (s *notificationCampaignService) GetCampaignByID(id int) (campaign.Campaign, error) {
+	return campaign.Campaign{ID: id, FundingStatus: s.fundingStatus}, nil
+}
+
+func TestHandleNotification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name              string
+		status            transaction.Status
+		fundingStatus     string
+		chargedAmount     int64
+		transactionStatus string
+		refunds           []payment.NotificationRefund
+		forged            bool
+		transitionErr     error
+		wantCode          int
+		wantStatus        string
+		wantCalls         []string
+	}{
+		{
+			"settlement of a pending payment", transaction.StatusPending, campaign.FundingStatusActive, 100000, "settlement", nil, false, nil,
+			http.StatusOK, "updated", []string{"transition paid"},
+		},
+		{
+			"denied payment", transaction.StatusPending, campaign.FundingStatusActive, 100000, "deny", nil, false, nil,
+			http.StatusOK, "updated", []string{"transition failed"},
+		},
+		{
+			"repeated pending notification", transaction.StatusPending, campaign.FundingStatusActive, 100000, "pending", nil, false, nil,
+			http.StatusOK, "success", nil,
+		},
+		{
+			"unknown transaction status", transaction.StatusPending, campaign.FundingStatusActive, 100000, "authorize", nil, false, nil,
+			http.StatusOK, "success", nil,
+		},
+		{
+			"late notification", transaction.StatusPaid, campaign.FundingStatusActive, 100000, "expire", nil, false,
+			fmt.Errorf("%w from paid to expired", transaction.ErrInvalidStatusTransition),
+			http.StatusOK, "ignored", []string{"transition expired"},
+		},
+		{
+			"settlement after the campaign failed", transaction.StatusPending, campaign.FundingStatusFailed, 100000, "settlement", nil, false, nil,
+			http.StatusOK, "updated", []string{"transition paid", "refund remaining"},
+		},
+		{
+			// The refund may have failed the first time, a repeated settlement tries again
+			"repeated settlement after the campaign failed", transaction.StatusPaid, campaign.FundingStatusFailed, 100000, "settlement", nil, false, nil,
+			http.StatusOK, "updated", []string{"refund remaining"},
+		},
+		{
+			"repeated settlement of an active campaign", transaction.StatusPaid, campaign.FundingStatusActive, 100000, "settlement", nil, false, nil,
+			http.StatusOK, "updated", nil,
+		},
+		{
+			"refund notification", transaction.StatusPaid, campaign.FundingStatusActive, 100000, "partial_refund",
+			[]payment.NotificationRefund{{RefundKey: "refund-1", RefundAmount: "40000.00"}}, false, nil,
+			http.StatusOK, "updated", []string{"record 1 refunds"},
+		},
+		{
+			"forged signature", transaction.StatusPending, campaign.FundingStatusActive, 100000, "settlement", nil, true, nil,
+			http.StatusForbidden, "error", nil,
+		},
+		{
+			"amount other than the transaction's", transaction.StatusPending, campaign.FundingStatusActive, 1000, "settlement", nil, false, nil,
+			http.StatusBadRequest, "error", nil,
+		},
+	}
+
+	for _, tt := range tests {
+		paymentService := payment.NewService(payment.NewFakeGateway("server-key", "http://localhost/pay"), "server-key")
+
+		if _, err := paymentService.CreateCharge(payment.Charge{OrderID: "order-1", Amount: tt.chargedAmount}); err != nil {
+			t.Fatalf("%s: CreateCharge returned error: %v", tt.name, err)
+		}
+
+		notification, err := paymentService.SimulateNotification("order-1", tt.transactionStatus)
+
+		if err != nil {
+			t.Fatalf("%s: SimulateNotification returned error: %v", tt.name, err)
+		}
+
+		notification.Refunds = tt.refunds
+
+		if tt.forged {
+			notification.SignatureKey = "forged"
+		}
+
+		transactionService := &notificationTransactionService{
+			transaction:   transaction.Transaction{ID: 1, CampaignID: 1, Code: "order-1", Amount: 100000, Status: tt.status},
+			transitionErr: tt.transitionErr,
+		}
+		handler := NewPaymentHandler(paymentService, transactionService, &notificationCampaignService{fundingStatus: tt.fundingStatus})
+
+		router := gin.New()
+		router.POST("/notifications", handler.HandleNotification)
+
+		body, _ := json.Marshal(notification)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/notifications", bytes.NewReader(body)))
+
+		var response helpers.Response
+
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: response isn't JSON: %v", tt.name, err)
+		}
+
+		if recorder.Code != tt.wantCode || response.Meta.Status != tt.wantStatus {
+			t.Errorf("%s: responded %d %s, want %d %s", tt.name, recorder.Code, response.Meta.Status, tt.wantCode, tt.wantStatus)
+		}
+
+		if !reflect.DeepEqual(transactionService.calls, tt.wantCalls) {
+			t.Errorf("%s: handler made calls %v, want %v", tt.name, transactionService.calls, tt.wantCalls)
+		}
+	}
+}
+
+func TestHandleNotificationUnknownOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	paymentService := payment.NewService(payment.NewFakeGateway("server-key", "http://localhost/pay"), "server-key")
+
+	if _, err := paymentService.CreateCharge(payment.Charge{OrderID: "order-2", Amount: 100000}); err != nil {
+		t.Fatalf("CreateCharge returned error: %v", err)
+	}
+
+	notification, err := paymentService.SimulateNotification("order-2", "settlement")
+
+	if err != nil {
+		t.Fatalf("SimulateNotification returned error: %v", err)
+	}
+
+	transactionService := &notificationTransactionService{transaction: transaction.Transaction{ID: 1, Code: "order-1", Amount: 100000}}
+	handler := NewPaymentHandler(paymentService, transactionService, &notificationCampaignService{})
+
+	router := gin.New()
+	router.POST("/notifications", handler.HandleNotification)
+
+	body, _ := json.Marshal(notification)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/notifications", bytes.NewReader(body)))
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("notification for an unknown order responded %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
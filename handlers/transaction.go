@@ -6,10 +6,12 @@ import (
 	"bwastartup/entities/transaction"
 	"bwastartup/entities/user"
 	"bwastartup/helpers"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -44,12 +46,18 @@ func (h transactionHandler) CreateTransaction(c *gin.Context) {
 		return
 	}
 
-	if foundCampaign.ID <= 0 {
+	if foundCampaign.ID <= 0 || !foundCampaign.IsVisible() {
 		c.JSON(http.StatusNotFound, helpers.APIResponse("Not found", http.StatusNotFound, "success", nil))
 
 		return
 	}
 
+	if !foundCampaign.IsOpenForPledges(time.Now()) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Campaign tidak menerima dukungan saat ini", http.StatusUnprocessableEntity, "closed", nil))
+
+		return
+	}
+
 	err = c.ShouldBindJSON(&input)
 
 	if err != nil {
@@ -58,6 +66,34 @@ func (h transactionHandler) CreateTransaction(c *gin.Context) {
 		return
 	}
 
+	if input.RewardID != nil {
+		var selectedReward *campaign.CampaignReward
+
+		for i := range foundCampaign.CampaignRewards {
+			if foundCampaign.CampaignRewards[i].ID == *input.RewardID {
+				selectedReward = &foundCampaign.CampaignRewards[i]
+			}
+		}
+
+		if selectedReward == nil {
+			c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Reward tidak ditemukan pada campaign ini", http.StatusUnprocessableEntity, "error", nil))
+
+			return
+		}
+
+		if input.Amount < selectedReward.MinimumAmount {
+			c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Jumlah dukungan kurang dari minimum reward", http.StatusUnprocessableEntity, "error", gin.H{"minimum_amount": selectedReward.MinimumAmount}))
+
+			return
+		}
+
+		if selectedReward.RequiresShipping && strings.TrimSpace(input.ShippingAddress) == "" {
+			c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Reward ini membutuhkan alamat pengiriman", http.StatusUnprocessableEntity, "error", nil))
+
+			return
+		}
+	}
+
 	authUser := c.MustGet("authUser").(user.User)
 
 	input.CampaignID = foundCampaign.ID
@@ -65,6 +101,12 @@ func (h transactionHandler) CreateTransaction(c *gin.Context) {
 
 	createdTransaction, err := h.transactionService.CreateTransaction(input)
 
+	if errors.Is(err, transaction.ErrRewardUnavailable) {
+		c.JSON(http.StatusConflict, helpers.APIResponse("Reward sudah habis", http.StatusConflict, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
 
@@ -80,31 +122,32 @@ func (h transactionHandler) CreateTransaction(c *gin.Context) {
 		lName = nameSplits[1]
 	}
 
-	snapReqData := map[string]interface{}{
-		"transaction": map[string]interface{}{
-			"orderID":  createdTransaction.Code,
-			"grossAmt": int64(createdTransaction.Amount),
-		},
-		"customer": map[string]interface{}{
-			"fName": fName,
-			"lName": lName,
-			"email": authUser.Email,
-		},
-		"project": map[string]interface{}{
-			"id":   fmt.Sprint(foundCampaign.ID),
-			"name": foundCampaign.Name,
+	charge := payment.Charge{
+		OrderID: createdTransaction.Code,
+		Amount:  int64(createdTransaction.Amount),
+		Customer: payment.Customer{
+			FirstName: fName,
+			LastName:  lName,
+			Email:     authUser.Email,
 		},
+		ItemID:   fmt.Sprint(foundCampaign.ID),
+		ItemName: foundCampaign.Name,
 	}
 
-	snapResponse, err := h.paymentService.GenerateSnapLink(snapReqData)
+	chargeResult, err := h.paymentService.CreateCharge(charge)
 
 	if err != nil {
+		// Nothing can be paid without a charge, fail the transaction so its reward is released
+		if _, failErr := h.transactionService.TransitionStatus(createdTransaction, transaction.StatusFailed, transaction.ActorUser, "Unable to create payment charge"); failErr != nil {
+			log.Printf("Transaction %d: unable to fail after the payment charge failed: %v\n", createdTransaction.ID, failErr)
+		}
+
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
 
 		return
 	}
 
-	createdTransaction.PaymentURL = fmt.Sprintf("%s/%s", os.Getenv("MIDTRANS_SNAP_URL"), snapResponse.Token)
+	createdTransaction.PaymentURL = chargeResult.PaymentURL
 
 	updatedTransaction, err := h.transactionService.UpdateTransaction(createdTransaction)
 
@@ -114,10 +157,62 @@ func (h transactionHandler) CreateTransaction(c *gin.Context) {
 		return
 	}
 
-	// Calculate and update campaign stats
-	currentAmount, backerCount, err := h.transactionService.GetNewCampaignStats(foundCampaign.ID)
+	c.JSON(http.StatusCreated, helpers.APIResponse("Successfully created a transaction", http.StatusCreated, "created", transaction.FormatTransaction(updatedTransaction)))
+
+}
 
-	_, err = h.campaignService.UpdateCampaign(foundCampaign, campaign.UpdateCampaignInput{CurrentAmount: currentAmount, BackersCount: backerCount})
+func (h transactionHandler) GetAllTransactions(c *gin.Context) {
+	var input transaction.GetTransactionsInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input query", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	h.respondWithTransactions(c, input)
+}
+
+func (h transactionHandler) GetOwnTransactions(c *gin.Context) {
+	var input transaction.GetTransactionsInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input query", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+	input.UserID = authUser.ID
+
+	h.respondWithTransactions(c, input)
+}
+
+func (h transactionHandler) GetTransactionByCampaignID(c *gin.Context) {
+	var campaignUri campaign.GetCampaignByIDInput
+	var input transaction.GetTransactionsInput
+
+	err := c.ShouldBindUri(&campaignUri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input campaign ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	err = c.ShouldBindQuery(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input query", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundCampaign, err := h.campaignService.GetCampaignByID(campaignUri.ID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
@@ -125,12 +220,27 @@ func (h transactionHandler) CreateTransaction(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, helpers.APIResponse("Successfully created a transaction", http.StatusCreated, "created", transaction.FormatTransaction(updatedTransaction)))
+	if foundCampaign.ID <= 0 {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Data campaign tidak ditemukan", http.StatusNotFound, "not-found", nil))
 
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	if authUser.ID != foundCampaign.UserID && (isAPIKeyRequest(c) || !authUser.HasPermission(user.PermissionViewAllTransactions)) {
+		c.JSON(http.StatusForbidden, helpers.APIResponse("Anda tidak punya wewenang untuk melihat transaksi campaign ini", http.StatusForbidden, "forbidden", nil))
+
+		return
+	}
+
+	input.CampaignID = campaignUri.ID
+
+	h.respondWithTransactions(c, input)
 }
 
-func (h transactionHandler) GetAllTransactions(c *gin.Context) {
-	transactions, err := h.transactionService.GetAllTransactions()
+func (h transactionHandler) respondWithTransactions(c *gin.Context, input transaction.GetTransactionsInput) {
+	transactions, total, err := h.transactionService.GetAllTransactions(input)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
@@ -144,13 +254,57 @@ func (h transactionHandler) GetAllTransactions(c *gin.Context) {
 		formattedTransactions = append(formattedTransactions, transaction.FormatTransaction(trx))
 	}
 
-	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", formattedTransactions))
+	c.JSON(http.StatusOK, helpers.APIResponseWithPagination("Ok", http.StatusOK, "success", formattedTransactions, helpers.NewPagination(input.PaginationInput, total)))
 }
 
-func (h transactionHandler) GetOwnTransactions(c *gin.Context) {
+func (h transactionHandler) GetTransactionByID(c *gin.Context) {
+	var transactionUri transaction.GetTransactionByIDInput
+
+	err := c.ShouldBindUri(&transactionUri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input transaction ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundTransaction, err := h.transactionService.GetTransactionByID(transactionUri.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if foundTransaction.ID <= 0 {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Transaksi tidak ditemukan", http.StatusNotFound, "not-found", nil))
+
+		return
+	}
+
 	authUser := c.MustGet("authUser").(user.User)
 
-	transactions, err := h.transactionService.GetAllTransactionsByRef(authUser.ID, "user_id")
+	if !canViewTransaction(c, authUser, foundTransaction) {
+		c.JSON(http.StatusForbidden, helpers.APIResponse("Anda tidak punya wewenang untuk melihat transaksi ini", http.StatusForbidden, "forbidden", nil))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", transaction.FormatTransaction(foundTransaction)))
+}
+
+func (h transactionHandler) VerifyTransaction(c *gin.Context) {
+	var transactionUri transaction.GetTransactionByIDInput
+
+	err := c.ShouldBindUri(&transactionUri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input transaction ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundTransaction, err := h.transactionService.GetTransactionByID(transactionUri.ID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
@@ -158,27 +312,41 @@ func (h transactionHandler) GetOwnTransactions(c *gin.Context) {
 		return
 	}
 
-	formattedTransactions := []transaction.TransactionFormat{}
+	if foundTransaction.ID <= 0 {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Transaksi tidak ditemukan", http.StatusNotFound, "not-found", nil))
 
-	for _, trx := range transactions {
-		formattedTransactions = append(formattedTransactions, transaction.FormatTransaction(trx))
+		return
+	}
+
+	verifiedTransaction, err := h.transactionService.VerifyTransaction(foundTransaction)
+
+	if errors.Is(err, transaction.ErrInvalidStatusTransition) {
+		c.JSON(http.StatusConflict, helpers.APIResponse("Transaksi tidak dapat diverifikasi", http.StatusConflict, "error", gin.H{"error": err.Error()}))
+
+		return
 	}
 
-	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", formattedTransactions))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, helpers.APIResponse("Successfully verified transaction", http.StatusCreated, "updated", transaction.FormatTransaction(verifiedTransaction)))
 }
 
-func (h transactionHandler) GetTransactionByCampaignID(c *gin.Context) {
-	var campaignUri campaign.GetCampaignByIDInput
+func (h transactionHandler) GetTransactionHistory(c *gin.Context) {
+	var transactionUri transaction.GetTransactionByIDInput
 
-	err := c.ShouldBindUri(&campaignUri)
+	err := c.ShouldBindUri(&transactionUri)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input campaign ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input transaction ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
 
 		return
 	}
 
-	transactions, err := h.transactionService.GetAllTransactionsByRef(campaignUri.ID, "campaign_id")
+	foundTransaction, err := h.transactionService.GetTransactionByID(transactionUri.ID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
@@ -186,17 +354,34 @@ func (h transactionHandler) GetTransactionByCampaignID(c *gin.Context) {
 		return
 	}
 
-	formattedTransactions := []transaction.TransactionFormat{}
+	if foundTransaction.ID <= 0 {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Transaksi tidak ditemukan", http.StatusNotFound, "not-found", nil))
 
-	for _, trx := range transactions {
-		formattedTransactions = append(formattedTransactions, transaction.FormatTransaction(trx))
+		return
 	}
 
-	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", formattedTransactions))
+	authUser := c.MustGet("authUser").(user.User)
+
+	if !canViewTransaction(c, authUser, foundTransaction) {
+		c.JSON(http.StatusForbidden, helpers.APIResponse("Anda tidak punya wewenang untuk melihat transaksi ini", http.StatusForbidden, "forbidden", nil))
+
+		return
+	}
+
+	histories, err := h.transactionService.GetStatusHistories(foundTransaction.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", transaction.FormatTransactionStatusHistories(histories)))
 }
 
-func (h transactionHandler) GetTransactionByID(c *gin.Context) {
+func (h transactionHandler) CreateRefund(c *gin.Context) {
 	var transactionUri transaction.GetTransactionByIDInput
+	var input transaction.RefundInput
 
 	err := c.ShouldBindUri(&transactionUri)
 
@@ -220,10 +405,58 @@ func (h transactionHandler) GetTransactionByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", transaction.FormatTransaction(foundTransaction)))
+	authUser := c.MustGet("authUser").(user.User)
+
+	// Refunds can be issued by finance staff and admins or by the owner of the backed campaign
+	switch {
+	case authUser.HasPermission(user.PermissionRefundTransactions):
+		input.Actor = transaction.ActorAdmin
+	case authUser.ID == foundTransaction.Campaign.UserID:
+		input.Actor = transaction.ActorUser
+	case authUser.MissingRequiredTwoFactor():
+		c.JSON(http.StatusForbidden, helpers.APIResponse("Aktifkan autentikasi dua langkah untuk melakukan refund transaksi ini", http.StatusForbidden, "two-factor-required", nil))
+
+		return
+	default:
+		c.JSON(http.StatusForbidden, helpers.APIResponse("Anda tidak punya wewenang untuk melakukan refund transaksi ini", http.StatusForbidden, "forbidden", nil))
+
+		return
+	}
+
+	err = c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input field", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	input.UserID = authUser.ID
+
+	refundedTransaction, refund, err := h.transactionService.RefundTransaction(foundTransaction, input)
+
+	if errors.Is(err, transaction.ErrInvalidStatusTransition) {
+		c.JSON(http.StatusConflict, helpers.APIResponse("Transaksi tidak dapat direfund", http.StatusConflict, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, transaction.ErrRefundExceedsAmount) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Jumlah refund melebihi sisa transaksi", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, helpers.APIResponse("Successfully refunded transaction", http.StatusCreated, "created", gin.H{"transaction": transaction.FormatTransaction(refundedTransaction), "refund": transaction.FormatRefund(refund)}))
 }
 
-func (h transactionHandler) VerifyTransaction(c *gin.Context) {
+func (h transactionHandler) GetRefunds(c *gin.Context) {
 	var transactionUri transaction.GetTransactionByIDInput
 
 	err := c.ShouldBindUri(&transactionUri)
@@ -248,7 +481,15 @@ func (h transactionHandler) VerifyTransaction(c *gin.Context) {
 		return
 	}
 
-	verifiedTransaction, err := h.transactionService.VerifyTransaction(foundTransaction)
+	authUser := c.MustGet("authUser").(user.User)
+
+	if !canViewTransaction(c, authUser, foundTransaction) {
+		c.JSON(http.StatusForbidden, helpers.APIResponse("Anda tidak punya wewenang untuk melihat transaksi ini", http.StatusForbidden, "forbidden", nil))
+
+		return
+	}
+
+	refunds, err := h.transactionService.GetRefunds(foundTransaction.ID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
@@ -256,7 +497,16 @@ func (h transactionHandler) VerifyTransaction(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, helpers.APIResponse("Successfully verified transaction", http.StatusCreated, "updated", transaction.FormatTransaction(verifiedTransaction)))
+	c.JSON(http.StatusOK, helpers.APIResponse("Ok", http.StatusOK, "success", transaction.FormatRefunds(refunds)))
+}
+
+// canViewTransaction lets backers see their own transactions and campaign owners the ones made to their campaigns
+func canViewTransaction(c *gin.Context, authUser user.User, trx transaction.Transaction) bool {
+	if authUser.ID == trx.UserID || authUser.ID == trx.Campaign.UserID {
+		return true
+	}
+
+	return !isAPIKeyRequest(c) && authUser.HasPermission(user.PermissionViewAllTransactions)
 }
 
 func (h *transactionHandler) GetNewCampaignStats(c *gin.Context) {
@@ -270,11 +520,13 @@ func (h *transactionHandler) GetNewCampaignStats(c *gin.Context) {
 		return
 	}
 
-	_, _, err = h.transactionService.GetNewCampaignStats(campaignInput.ID)
+	currentAmount, backerCount, err := h.transactionService.RecalculateCampaignStats(campaignInput.ID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
 
 		return
 	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Successfully recalculated campaign stats", http.StatusOK, "updated", gin.H{"current_amount": currentAmount, "backers_count": backerCount}))
 }
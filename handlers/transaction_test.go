@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"bwastartup/auth"
+	"bwastartup/entities/campaign"
+	"bwastartup/entities/transaction"
+	"bwastartup/entities/user"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCanViewTransaction(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	trx := transaction.Transaction{ID: 1, UserID: 2, Campaign: campaign.Campaign{UserID: 3}}
+
+	tests := []struct {
+		name     string
+		authUser user.User
+		apiKey   bool
+		want     bool
+	}{
+		{"backer", user.User{ID: 2, Role: user.RoleUser}, false, true},
+		{"backer with an API key", user.User{ID: 2, Role: user.RoleUser}, true, true},
+		{"campaign owner", user.User{ID: 3, Role: user.RoleUser}, false, true},
+		{"someone else", user.User{ID: 4, Role: user.RoleUser}, false, false},
+		{"finance staff", user.User{ID: 4, Role: user.RoleFinance}, false, true},
+		{"finance staff with an API key", user.User{ID: 4, Role: user.RoleFinance}, true, false},
+	}
+
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+		if tt.apiKey {
+			c.Set("authAPIKey", auth.APIKey{ID: 1, UserID: tt.authUser.ID})
+		}
+
+		if got := canViewTransaction(c, tt.authUser, trx); got != tt.want {
+			t.Errorf("%s: canViewTransaction = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"bwastartup/entities/upload"
+	"bwastartup/entities/user"
+	"bwastartup/helpers"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type uploadHandler struct {
+	uploadService upload.Service
+}
+
+func NewUploadHandler(uploadService upload.Service) *uploadHandler {
+	return &uploadHandler{uploadService}
+}
+
+func (h uploadHandler) GetUploadJob(c *gin.Context) {
+	var uri upload.GetUploadJobInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input job ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundJob, err := h.uploadService.GetJobByID(uri.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	// Other users' jobs are reported as missing so job IDs can't be probed
+	if foundJob.ID <= 0 || foundJob.UserID != authUser.ID {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("Upload tidak ditemukan", http.StatusNotFound, "not-found", nil))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Berhasil mengambil status upload", http.StatusOK, "success", upload.FormatUploadJob(foundJob)))
+}
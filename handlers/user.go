@@ -4,20 +4,28 @@ import (
 	"bwastartup/auth"
 	"bwastartup/entities/user"
 	"bwastartup/helpers"
+	"bwastartup/imaging"
+	"bwastartup/ratelimit"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type userHandler struct {
-	userService user.Service
-	authService auth.Service
+	userService  user.Service
+	authService  auth.Service
+	loginLockout *ratelimit.Lockout
 }
 
 // New UserHandler => Instanciate new UserHandler object
-func NewUserHandler(userService user.Service, authService auth.Service) *userHandler {
-	return &userHandler{userService, authService}
+func NewUserHandler(userService user.Service, authService auth.Service, loginLockout *ratelimit.Lockout) *userHandler {
+	return &userHandler{userService, authService, loginLockout}
 }
 
 func (h *userHandler) RegisterUser(c *gin.Context) {
@@ -44,7 +52,7 @@ func (h *userHandler) RegisterUser(c *gin.Context) {
 	}
 
 	// Generate access token
-	accessToken, err := h.authService.GenerateToken(newUser.ID)
+	tokenPair, err := h.authService.GenerateToken(newUser.ID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
@@ -52,7 +60,7 @@ func (h *userHandler) RegisterUser(c *gin.Context) {
 		return
 	}
 
-	data := helpers.APIResponse("User telah didaftarkan", 201, "created", user.FormatUser(newUser, accessToken))
+	data := helpers.APIResponse("User telah didaftarkan", 201, "created", user.FormatUser(newUser, tokenPair.AccessToken, tokenPair.RefreshToken))
 
 	c.JSON(http.StatusOK, data)
 }
@@ -70,6 +78,24 @@ func (h *userHandler) LoginUser(c *gin.Context) {
 		return
 	}
 
+	// The lock covers the account from one address only, a stranger guessing can't lock its owner out
+	lockoutKey := strings.ToLower(strings.TrimSpace(input.Email)) + "|" + helpers.ClientIP(c)
+
+	// A locked attempt is rejected before the password is checked, so guessing stops while it lasts
+	lockedFor, err := h.loginLockout.Attempt(lockoutKey)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if lockedFor > 0 {
+		respondLoginLocked(c, lockedFor)
+
+		return
+	}
+
 	// call LoginUser service
 	authenticatedUser, err := h.userService.LoginUser(input)
 
@@ -80,7 +106,28 @@ func (h *userHandler) LoginUser(c *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.GenerateToken(authenticatedUser.ID)
+	if err := h.loginLockout.Succeed(lockoutKey); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	// The password was right, the session is only started once the second factor checks out too
+	if authenticatedUser.IsTwoFactorEnabled() {
+		challengeToken, err := h.authService.GenerateChallengeToken(authenticatedUser.ID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+			return
+		}
+
+		c.JSON(http.StatusOK, helpers.APIResponse("Masukkan kode autentikasi dua langkah", http.StatusOK, "two-factor-required", gin.H{"two_factor_required": true, "challenge_token": challengeToken}))
+
+		return
+	}
+
+	tokenPair, err := h.authService.GenerateToken(authenticatedUser.ID)
 
 	if err != nil {
 		data := helpers.APIResponse("Terdapat kesalahan membuat token", http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
@@ -89,7 +136,14 @@ func (h *userHandler) LoginUser(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, helpers.APIResponse("Berhasil login", http.StatusOK, "success", user.FormatUser(authenticatedUser, token)))
+	c.JSON(http.StatusOK, helpers.APIResponse("Berhasil login", http.StatusOK, "success", user.FormatUser(authenticatedUser, tokenPair.AccessToken, tokenPair.RefreshToken)))
+}
+
+func respondLoginLocked(c *gin.Context, lockedFor time.Duration) {
+	retryAfter := int(math.Ceil(lockedFor.Seconds()))
+
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, helpers.APIResponse("Terlalu banyak percobaan login, coba lagi nanti", http.StatusTooManyRequests, "error", gin.H{"retry_after": retryAfter}))
 }
 
 func (h *userHandler) CheckEmailAvailability(c *gin.Context) {
@@ -130,7 +184,13 @@ func (h *userHandler) UpdateAvatar(c *gin.Context) {
 
 	authUser := c.MustGet("authUser").(user.User)
 
-	driveFileID, err := h.userService.UpdateAvatar(authUser, file)
+	updatedUser, err := h.userService.UpdateAvatar(authUser, file)
+	if errors.Is(err, imaging.ErrInvalidImage) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("File avatar tidak valid", http.StatusUnprocessableEntity, "fail", gin.H{"is_uploaded": false, "error": err.Error()}))
+
+		return
+	}
+
 	if err != nil {
 		fmt.Println(err)
 		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Failed to save file", http.StatusInternalServerError, "fail", gin.H{"is_uploaded": false}))
@@ -138,12 +198,494 @@ func (h *userHandler) UpdateAvatar(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, helpers.APIResponse("Sukses menyimpan file", http.StatusOK, "ok", gin.H{"is_uploaded": true, "filename": driveFileID}))
+	avatar := imaging.FormatRenditions(updatedUser.AvatarKeys())
 
+	c.JSON(http.StatusOK, helpers.APIResponse("Sukses menyimpan file", http.StatusOK, "ok", gin.H{"is_uploaded": true, "filename": avatar.Full, "avatar_renditions": avatar}))
 }
 
 func (h *userHandler) FetchCurrentUser(c *gin.Context) {
 	authUser := c.MustGet("authUser").(user.User)
 
-	c.JSON(http.StatusOK, helpers.APIResponse("Successfully fetch user data", http.StatusOK, "success", user.FormatUser(authUser, "")))
+	c.JSON(http.StatusOK, helpers.APIResponse("Successfully fetch user data", http.StatusOK, "success", user.FormatUser(authUser, "", "")))
+}
+
+func (h *userHandler) GrantRole(c *gin.Context) {
+	var uri user.GetUserByIDInput
+	var input user.GrantRoleInput
+
+	err := c.ShouldBindUri(&uri)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input user ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	err = c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundUser, err := h.userService.GetUserByID(uri.ID)
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("User tidak ditemukan", http.StatusNotFound, "not-found", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	updatedUser, err := h.userService.GrantRole(foundUser, input.Role, authUser)
+
+	if errors.Is(err, user.ErrInvalidRole) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Role tidak valid", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Role berhasil diberikan", http.StatusOK, "success", user.FormatUser(updatedUser, "", "")))
+}
+
+func (h *userHandler) RevokeRole(c *gin.Context) {
+	var input user.RevokeRoleInput
+
+	err := c.ShouldBindUri(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Kesalahan pada input user ID", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	foundUser, err := h.userService.GetUserByID(input.UserID)
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, helpers.APIResponse("User tidak ditemukan", http.StatusNotFound, "not-found", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	updatedUser, err := h.userService.RevokeRole(foundUser, input.Role, authUser)
+
+	if errors.Is(err, user.ErrInvalidRole) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Role tidak dapat dicabut", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Role berhasil dicabut", http.StatusOK, "success", user.FormatUser(updatedUser, "", "")))
+}
+
+func (h *userHandler) ForgotPassword(c *gin.Context) {
+	var input user.ForgotPasswordInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	if err := h.userService.RequestPasswordReset(input); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Jika email terdaftar, link reset password telah dikirim", http.StatusOK, "success", nil))
+}
+
+func (h *userHandler) ResetPassword(c *gin.Context) {
+	var input user.ResetPasswordInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	updatedUser, err := h.userService.ResetPassword(input)
+
+	if errors.Is(err, user.ErrInvalidResetToken) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Token reset password tidak valid atau sudah kedaluwarsa", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	// Whoever knew the old password may still be logged in somewhere
+	if err := h.authService.LogoutAll(updatedUser.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Password berhasil diubah, silakan login kembali", http.StatusOK, "success", nil))
+}
+
+func (h *userHandler) VerifyEmail(c *gin.Context) {
+	var input user.VerifyEmailInput
+
+	err := c.ShouldBindQuery(&input)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, helpers.APIResponse("Link verifikasi tidak valid", http.StatusBadRequest, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	verifiedUser, err := h.userService.VerifyEmail(input)
+
+	if errors.Is(err, user.ErrInvalidVerificationLink) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Link verifikasi tidak valid atau sudah kedaluwarsa", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Email berhasil diverifikasi", http.StatusOK, "success", user.FormatUser(verifiedUser, "", "")))
+}
+
+func (h *userHandler) ResendEmailVerification(c *gin.Context) {
+	authUser := c.MustGet("authUser").(user.User)
+
+	wait, err := h.userService.ResendEmailVerification(authUser)
+
+	if errors.Is(err, user.ErrEmailAlreadyVerified) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Email sudah diverifikasi", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, user.ErrVerificationThrottled) {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, helpers.APIResponse("Email verifikasi baru saja dikirim, coba lagi nanti", http.StatusTooManyRequests, "error", gin.H{"retry_after": retryAfter}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Email verifikasi telah dikirim", http.StatusOK, "success", nil))
+}
+
+func (h *userHandler) UpdateProfile(c *gin.Context) {
+	var input user.UpdateProfileInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	updatedUser, err := h.userService.UpdateProfile(authUser, input)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Profil berhasil diubah", http.StatusOK, "updated", user.FormatUser(updatedUser, "", "")))
+}
+
+func (h *userHandler) ChangeEmail(c *gin.Context) {
+	var input user.ChangeEmailInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	updatedUser, err := h.userService.ChangeEmail(authUser, input)
+
+	if errors.Is(err, user.ErrPasswordNotSet) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Atur password terlebih dahulu melalui POST /me/password", http.StatusUnprocessableEntity, "password-not-set", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, user.ErrIncorrectPassword) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Password salah", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, user.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, helpers.APIResponse("Email telah digunakan.", http.StatusConflict, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Email berhasil diubah, silakan verifikasi email baru anda", http.StatusOK, "updated", user.FormatUser(updatedUser, "", "")))
+}
+
+func (h *userHandler) ChangePassword(c *gin.Context) {
+	var input user.ChangePasswordInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	updatedUser, err := h.userService.ChangePassword(authUser, input)
+
+	if errors.Is(err, user.ErrIncorrectPassword) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Password lama salah", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	// Other sessions are ended, the current client gets a fresh session so it stays logged in
+	if err := h.authService.LogoutAll(updatedUser.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	tokenPair, err := h.authService.GenerateToken(updatedUser.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Password berhasil diubah", http.StatusOK, "updated", user.FormatUser(updatedUser, tokenPair.AccessToken, tokenPair.RefreshToken)))
+}
+
+func (h *userHandler) LoginTwoFactor(c *gin.Context) {
+	var input user.LoginTwoFactorInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	userID, err := h.authService.ValidateChallengeToken(input.ChallengeToken)
+
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, helpers.APIResponse("Sesi login tidak valid, silakan login kembali", http.StatusUnauthorized, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	// Codes only have a million combinations, guesses are locked out the same way passwords are
+	lockoutKey := "2fa:" + strconv.Itoa(userID)
+
+	lockedFor, err := h.loginLockout.Attempt(lockoutKey)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if lockedFor > 0 {
+		respondLoginLocked(c, lockedFor)
+
+		return
+	}
+
+	authenticatedUser, err := h.userService.GetUserByID(userID)
+
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, helpers.APIResponse("Sesi login tidak valid, silakan login kembali", http.StatusUnauthorized, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	err = h.userService.VerifyTwoFactor(authenticatedUser, input.Code)
+
+	if errors.Is(err, user.ErrInvalidTwoFactorCode) {
+		c.JSON(http.StatusUnauthorized, helpers.APIResponse("Kode autentikasi salah", http.StatusUnauthorized, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err := h.loginLockout.Succeed(lockoutKey); err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	tokenPair, err := h.authService.GenerateToken(authenticatedUser.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terdapat kesalahan membuat token", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Berhasil login", http.StatusOK, "success", user.FormatUser(authenticatedUser, tokenPair.AccessToken, tokenPair.RefreshToken)))
+}
+
+func (h *userHandler) SetupTwoFactor(c *gin.Context) {
+	authUser := c.MustGet("authUser").(user.User)
+
+	setup, err := h.userService.SetupTwoFactor(authUser)
+
+	if errors.Is(err, user.ErrTwoFactorAlreadyEnabled) {
+		c.JSON(http.StatusConflict, helpers.APIResponse("Autentikasi dua langkah sudah aktif", http.StatusConflict, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Pindai kode QR lalu konfirmasi dengan kode dari aplikasi autentikator", http.StatusOK, "success", gin.H{"secret": setup.Secret, "otpauth_url": setup.URL}))
+}
+
+func (h *userHandler) ConfirmTwoFactor(c *gin.Context) {
+	var input user.TwoFactorCodeInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	backupCodes, err := h.userService.ConfirmTwoFactor(authUser, input)
+
+	if errors.Is(err, user.ErrTwoFactorAlreadyEnabled) || errors.Is(err, user.ErrTwoFactorNotSetUp) {
+		c.JSON(http.StatusConflict, helpers.APIResponse("Autentikasi dua langkah tidak dapat dikonfirmasi", http.StatusConflict, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, user.ErrInvalidTwoFactorCode) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Kode autentikasi salah", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Autentikasi dua langkah aktif, simpan kode cadangan berikut", http.StatusOK, "success", gin.H{"backup_codes": backupCodes}))
+}
+
+func (h *userHandler) DisableTwoFactor(c *gin.Context) {
+	var input user.DisableTwoFactorInput
+
+	err := c.ShouldBindJSON(&input)
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Terdapat kesalahan input data", http.StatusUnprocessableEntity, "error", helpers.GetValidationErrors(err)))
+
+		return
+	}
+
+	authUser := c.MustGet("authUser").(user.User)
+
+	updatedUser, err := h.userService.DisableTwoFactor(authUser, input)
+
+	if errors.Is(err, user.ErrPasswordNotSet) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Atur password terlebih dahulu melalui POST /me/password", http.StatusUnprocessableEntity, "password-not-set", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, user.ErrTwoFactorNotEnabled) {
+		c.JSON(http.StatusConflict, helpers.APIResponse("Autentikasi dua langkah belum aktif", http.StatusConflict, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if errors.Is(err, user.ErrIncorrectPassword) || errors.Is(err, user.ErrInvalidTwoFactorCode) {
+		c.JSON(http.StatusUnprocessableEntity, helpers.APIResponse("Password atau kode autentikasi salah", http.StatusUnprocessableEntity, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, helpers.APIResponse("Terjadi kesalahan pada server", http.StatusInternalServerError, "error", gin.H{"error": err.Error()}))
+
+		return
+	}
+
+	c.JSON(http.StatusOK, helpers.APIResponse("Autentikasi dua langkah dinonaktifkan", http.StatusOK, "success", user.FormatUser(updatedUser, "", "")))
 }
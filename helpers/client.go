@@ -0,0 +1,30 @@
+package helpers
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIP returns the client address. Clients can send any X-Forwarded-For they like, so a header is only used when
+// CLIENT_IP_HEADER names one our own proxy sets, e.g. X-Forwarded-For on Heroku. The proxy appends the address it
+// saw to the end of the header, so that last entry is the one taken
+func ClientIP(c *gin.Context) string {
+	if header := os.Getenv("CLIENT_IP_HEADER"); header != "" {
+		values := strings.Split(c.GetHeader(header), ",")
+
+		if clientIP := strings.TrimSpace(values[len(values)-1]); clientIP != "" {
+			return clientIP
+		}
+	}
+
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+
+	if err != nil {
+		return c.Request.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,53 @@
+package helpers
+
+import "math"
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type PaginationInput struct {
+	Page  int `form:"page" binding:"omitempty,min=1"`
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type Pagination struct {
+	Page       int   `json:"page"`
+	Limit      int   `json:"limit"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+func (p PaginationInput) GetPage() int {
+	if p.Page < 1 {
+		return 1
+	}
+
+	return p.Page
+}
+
+func (p PaginationInput) GetLimit() int {
+	if p.Limit < 1 {
+		return defaultPageLimit
+	}
+
+	if p.Limit > maxPageLimit {
+		return maxPageLimit
+	}
+
+	return p.Limit
+}
+
+func (p PaginationInput) GetOffset() int {
+	return (p.GetPage() - 1) * p.GetLimit()
+}
+
+func NewPagination(input PaginationInput, total int64) Pagination {
+	return Pagination{
+		Page:       input.GetPage(),
+		Limit:      input.GetLimit(),
+		Total:      total,
+		TotalPages: int(math.Ceil(float64(total) / float64(input.GetLimit()))),
+	}
+}
@@ -12,8 +12,9 @@ type Meta struct {
 }
 
 type Response struct {
-	Meta Meta        `json:"meta"`
-	Data interface{} `json:"data"`
+	Meta       Meta        `json:"meta"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+	Data       interface{} `json:"data"`
 }
 
 func APIResponse(message string, code int, status string, data interface{}) Response {
@@ -27,10 +28,24 @@ func APIResponse(message string, code int, status string, data interface{}) Resp
 	}
 }
 
+func APIResponseWithPagination(message string, code int, status string, data interface{}, pagination Pagination) Response {
+	response := APIResponse(message, code, status, data)
+	response.Pagination = &pagination
+
+	return response
+}
+
 func GetValidationErrors(e error) interface{} {
 	var errors []string
 
-	for _, err := range e.(validator.ValidationErrors) {
+	validationErrors, ok := e.(validator.ValidationErrors)
+
+	// Malformed input (e.g. a non numeric query param) fails before validation even starts
+	if !ok {
+		return gin.H{"errors": []string{e.Error()}}
+	}
+
+	for _, err := range validationErrors {
 		errors = append(errors, err.Error())
 	}
 
@@ -0,0 +1,90 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// jpegOrientation reads the EXIF orientation tag (1-8) of a JPEG, 1 means the pixels are already upright
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	offset := 2
+
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return 1
+		}
+
+		marker := data[offset+1]
+
+		// Start of scan, the metadata segments all come before it
+		if marker == 0xDA {
+			return 1
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+
+		if length < 2 || offset+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[offset+4 : offset+2+length]
+
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		offset += 2 + length
+	}
+
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifdOffset := int(order.Uint32(tiff[4:8]))
+
+	if ifdOffset+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifdOffset : ifdOffset+2]))
+
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		// 0x0112 is Orientation, a SHORT stored inline in the value field
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+
+			return orientation
+		}
+	}
+
+	return 1
+}
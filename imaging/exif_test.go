@@ -0,0 +1,89 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// exifSegment builds an APP1 segment whose first IFD holds only the orientation tag
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+
+	order.PutUint16(tiff[2:4], 42)
+	order.PutUint32(tiff[4:8], 8)
+	order.PutUint16(tiff[8:10], 1)
+	order.PutUint16(tiff[10:12], 0x0112)
+	order.PutUint16(tiff[12:14], 3)
+	order.PutUint32(tiff[14:18], 1)
+	order.PutUint16(tiff[18:20], orientation)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:4], uint16(len(payload)+2))
+
+	return append(segment, payload...)
+}
+
+// jpegWith puts the segments between the start of image marker and the rest of a minimal JPEG
+func jpegWith(segments ...[]byte) []byte {
+	data := []byte{0xFF, 0xD8}
+
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+
+	return append(data, 0xFF, 0xDA, 0, 2, 0xFF, 0xD9)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	comment := []byte{0xFF, 0xFE, 0, 7, 'h', 'e', 'l', 'l', 'o'}
+	truncated := exifSegment(binary.BigEndian, 6)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"little endian", jpegWith(exifSegment(binary.LittleEndian, 6)), 6},
+		{"big endian", jpegWith(exifSegment(binary.BigEndian, 8)), 8},
+		{"upright", jpegWith(exifSegment(binary.BigEndian, 1)), 1},
+		{"after another segment", jpegWith(comment, exifSegment(binary.LittleEndian, 3)), 3},
+		{"out of range", jpegWith(exifSegment(binary.LittleEndian, 9)), 1},
+		{"zero", jpegWith(exifSegment(binary.LittleEndian, 0)), 1},
+		{"no exif", jpegWith(comment), 1},
+		{"exif after start of scan", append(jpegWith(), exifSegment(binary.LittleEndian, 6)...), 1},
+		{"truncated segment", append([]byte{0xFF, 0xD8}, truncated[:len(truncated)-4]...), 1},
+		{"not a jpeg", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+
+	for _, tt := range tests {
+		if got := jpegOrientation(tt.data); got != tt.want {
+			t.Errorf("%s: jpegOrientation = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTIFFOrientationRejectsBadOffsets(t *testing.T) {
+	tests := []struct {
+		name string
+		tiff []byte
+	}{
+		{"too short", []byte("II*\x00")},
+		{"unknown byte order", []byte("XX*\x00\x08\x00\x00\x00\x00\x00")},
+		{"ifd past the end", []byte("II*\x00\xff\x00\x00\x00")},
+		{"entries past the end", []byte("II*\x00\x08\x00\x00\x00\x05\x00")},
+	}
+
+	for _, tt := range tests {
+		if got := tiffOrientation(tt.tiff); got != 1 {
+			t.Errorf("%s: tiffOrientation = %d, want 1", tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package imaging
+
+import "bwastartup/storage"
+
+type RenditionsFormat struct {
+	Thumbnail string `json:"thumbnail"`
+	Card      string `json:"card"`
+	Full      string `json:"full"`
+}
+
+// FormatRenditions falls back to the full image for renditions that were never generated
+func FormatRenditions(keys Keys) RenditionsFormat {
+	if keys.Full == "" {
+		return RenditionsFormat{}
+	}
+
+	thumbnail, card := keys.Thumbnail, keys.Card
+
+	if thumbnail == "" {
+		thumbnail = keys.Full
+	}
+
+	if card == "" {
+		card = keys.Full
+	}
+
+	return RenditionsFormat{
+		Thumbnail: storage.URL(thumbnail),
+		Card:      storage.URL(card),
+		Full:      storage.URL(keys.Full),
+	}
+}
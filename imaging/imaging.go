@@ -0,0 +1,250 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var ErrInvalidImage = errors.New("Invalid image")
+
+// Limits are checked before the image is decoded, so a small file can't claim huge dimensions and exhaust memory
+type Limits struct {
+	MaxBytes  int64
+	MaxWidth  int
+	MaxHeight int
+}
+
+var DefaultLimits = Limits{MaxBytes: 10 << 20, MaxWidth: 8000, MaxHeight: 8000}
+
+// Rendition is scaled down to fit within Width x Height, or cropped to exactly that size when Crop is set
+type Rendition struct {
+	Width  int
+	Height int
+	Crop   bool
+}
+
+// Sizes are the renditions every uploaded image is turned into
+type Sizes struct {
+	Thumbnail Rendition
+	Card      Rendition
+	Full      Rendition
+}
+
+var AvatarSizes = Sizes{
+	Thumbnail: Rendition{Width: 64, Height: 64, Crop: true},
+	Card:      Rendition{Width: 256, Height: 256, Crop: true},
+	Full:      Rendition{Width: 1024, Height: 1024},
+}
+
+var CampaignImageSizes = Sizes{
+	Thumbnail: Rendition{Width: 320, Height: 240, Crop: true},
+	Card:      Rendition{Width: 800, Height: 600, Crop: true},
+	Full:      Rendition{Width: 1920, Height: 1920},
+}
+
+// Encoded is one rendition ready to be stored
+type Encoded struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+}
+
+type Processed struct {
+	Thumbnail Encoded
+	Card      Encoded
+	Full      Encoded
+}
+
+// Process validates the upload by its content rather than its name, accepting JPEG, PNG and WebP. The renditions
+// are re-encoded from the pixels so EXIF and other metadata are dropped, after the EXIF orientation is applied
+func Process(r io.Reader, limits Limits, sizes Sizes) (Processed, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+
+	if err != nil {
+		return Processed{}, err
+	}
+
+	if int64(len(data)) > limits.MaxBytes {
+		return Processed{}, fmt.Errorf("%w, file is larger than %d MB", ErrInvalidImage, limits.MaxBytes>>20)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil || (format != "jpeg" && format != "png" && format != "webp") {
+		return Processed{}, fmt.Errorf("%w, only JPEG, PNG and WebP images are accepted", ErrInvalidImage)
+	}
+
+	if config.Width > limits.MaxWidth || config.Height > limits.MaxHeight {
+		return Processed{}, fmt.Errorf("%w, image is larger than %dx%d pixels", ErrInvalidImage, limits.MaxWidth, limits.MaxHeight)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return Processed{}, fmt.Errorf("%w, %v", ErrInvalidImage, err)
+	}
+
+	orientation := 1
+
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	// PNGs keep their transparency, everything else becomes a JPEG
+	keepAlpha := format == "png"
+
+	full := resize(orient(toRGBA(decoded, keepAlpha), orientation), sizes.Full)
+
+	var processed Processed
+
+	if processed.Full, err = encode(full, keepAlpha); err != nil {
+		return Processed{}, err
+	}
+
+	// The smaller renditions are made from the full one, which is a lot cheaper than from the original
+	if processed.Card, err = encode(resize(full, sizes.Card), keepAlpha); err != nil {
+		return Processed{}, err
+	}
+
+	if processed.Thumbnail, err = encode(resize(full, sizes.Thumbnail), keepAlpha); err != nil {
+		return Processed{}, err
+	}
+
+	return processed, nil
+}
+
+// toRGBA copies the image into an RGBA buffer, transparent areas are flattened onto white unless the alpha is kept
+func toRGBA(src image.Image, keepAlpha bool) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	if !keepAlpha {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	}
+
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Over)
+
+	return dst
+}
+
+// orient turns the pixels upright according to the EXIF orientation
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Orientations 5 to 8 are rotated by 90 degrees, width and height swap
+	dstWidth, dstHeight := width, height
+
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+
+	return dst
+}
+
+// resize never scales up, an image smaller than the rendition is only cropped when needed
+func resize(src *image.RGBA, rendition Rendition) *image.RGBA {
+	srcBounds := src.Bounds()
+	width, height := srcBounds.Dx(), srcBounds.Dy()
+
+	if rendition.Crop {
+		// Cut the largest centred area with the rendition's aspect ratio, then scale it down
+		cropWidth, cropHeight := width, width*rendition.Height/rendition.Width
+
+		if cropHeight > height {
+			cropWidth, cropHeight = height*rendition.Width/rendition.Height, height
+		}
+
+		srcBounds = image.Rect((width-cropWidth)/2, (height-cropHeight)/2, (width-cropWidth)/2+cropWidth, (height-cropHeight)/2+cropHeight)
+		width, height = cropWidth, cropHeight
+	}
+
+	dstWidth, dstHeight := width, height
+
+	if dstWidth > rendition.Width {
+		dstWidth, dstHeight = rendition.Width, dstHeight*rendition.Width/dstWidth
+	}
+
+	if dstHeight > rendition.Height {
+		dstWidth, dstHeight = dstWidth*rendition.Height/dstHeight, rendition.Height
+	}
+
+	if dstWidth < 1 {
+		dstWidth = 1
+	}
+
+	if dstHeight < 1 {
+		dstHeight = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, srcBounds, draw.Src, nil)
+
+	return dst
+}
+
+func encode(img *image.RGBA, asPNG bool) (Encoded, error) {
+	var buffer bytes.Buffer
+
+	encoded := Encoded{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+
+	if asPNG {
+		if err := png.Encode(&buffer, img); err != nil {
+			return encoded, err
+		}
+
+		encoded.ContentType, encoded.Extension = "image/png", ".png"
+	} else {
+		if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 85}); err != nil {
+			return encoded, err
+		}
+
+		encoded.ContentType, encoded.Extension = "image/jpeg", ".jpg"
+	}
+
+	encoded.Data = buffer.Bytes()
+
+	return encoded, nil
+}
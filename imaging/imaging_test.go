@@ -0,0 +1,157 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var red = color.RGBA{255, 0, 0, 255}
+
+// marked is a width x height image with a single red pixel in its top left corner
+func marked(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, red)
+
+	return img
+}
+
+func TestOrient(t *testing.T) {
+	tests := []struct {
+		orientation int
+		wantWidth   int
+		wantHeight  int
+		wantRedAt   image.Point
+	}{
+		{1, 3, 2, image.Pt(0, 0)},
+		{2, 3, 2, image.Pt(2, 0)},
+		{3, 3, 2, image.Pt(2, 1)},
+		{4, 3, 2, image.Pt(0, 1)},
+		{5, 2, 3, image.Pt(0, 0)},
+		{6, 2, 3, image.Pt(1, 0)},
+		{7, 2, 3, image.Pt(1, 2)},
+		{8, 2, 3, image.Pt(0, 2)},
+		{9, 3, 2, image.Pt(0, 0)},
+	}
+
+	for _, tt := range tests {
+		got := orient(marked(3, 2), tt.orientation)
+
+		if got.Bounds().Dx() != tt.wantWidth || got.Bounds().Dy() != tt.wantHeight {
+			t.Errorf("orient(%d) is %dx%d, want %dx%d", tt.orientation, got.Bounds().Dx(), got.Bounds().Dy(), tt.wantWidth, tt.wantHeight)
+
+			continue
+		}
+
+		if got.RGBAAt(tt.wantRedAt.X, tt.wantRedAt.Y) != red {
+			t.Errorf("orient(%d) moved the top left pixel somewhere else than %v", tt.orientation, tt.wantRedAt)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		rendition  Rendition
+		wantWidth  int
+		wantHeight int
+	}{
+		{"fits within the box", 2000, 1000, Rendition{Width: 1000, Height: 1000}, 1000, 500},
+		{"portrait fits within the box", 1000, 2000, Rendition{Width: 1000, Height: 1000}, 500, 1000},
+		{"never scaled up", 300, 200, Rendition{Width: 1000, Height: 1000}, 300, 200},
+		{"cropped to the ratio", 2000, 1000, Rendition{Width: 64, Height: 64, Crop: true}, 64, 64},
+		{"small image only cropped", 100, 50, Rendition{Width: 320, Height: 240, Crop: true}, 66, 50},
+		{"sliver keeps a pixel", 4000, 1, Rendition{Width: 100, Height: 100}, 100, 1},
+	}
+
+	for _, tt := range tests {
+		got := resize(image.NewRGBA(image.Rect(0, 0, tt.width, tt.height)), tt.rendition)
+
+		if got.Bounds().Dx() != tt.wantWidth || got.Bounds().Dy() != tt.wantHeight {
+			t.Errorf("%s: resize is %dx%d, want %dx%d", tt.name, got.Bounds().Dx(), got.Bounds().Dy(), tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
+
+func encoded(t *testing.T, encode func(*bytes.Buffer, image.Image) error, img image.Image) []byte {
+	var buffer bytes.Buffer
+
+	if err := encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestProcessSniffsContent(t *testing.T) {
+	img := marked(40, 20)
+
+	pngData := encoded(t, func(b *bytes.Buffer, i image.Image) error { return png.Encode(b, i) }, img)
+	jpegData := encoded(t, func(b *bytes.Buffer, i image.Image) error { return jpeg.Encode(b, i, nil) }, img)
+	gifData := encoded(t, func(b *bytes.Buffer, i image.Image) error { return gif.Encode(b, i, nil) }, img)
+
+	// The orientation tag goes right after the start of image marker
+	rotatedJPEG := append(append([]byte{0xFF, 0xD8}, exifSegment(binary.BigEndian, 6)...), jpegData[2:]...)
+
+	tests := []struct {
+		name            string
+		data            []byte
+		limits          Limits
+		wantErr         bool
+		wantContentType string
+		wantWidth       int
+		wantHeight      int
+	}{
+		{"png keeps png", pngData, DefaultLimits, false, "image/png", 40, 20},
+		{"jpeg stays jpeg", jpegData, DefaultLimits, false, "image/jpeg", 40, 20},
+		{"exif orientation applied", rotatedJPEG, DefaultLimits, false, "image/jpeg", 20, 40},
+		{"gif rejected", gifData, DefaultLimits, true, "", 0, 0},
+		{"html with an image name rejected", []byte("<html><script>alert(1)</script></html>"), DefaultLimits, true, "", 0, 0},
+		{"truncated png rejected", pngData[:len(pngData)/2], DefaultLimits, true, "", 0, 0},
+		{"too many bytes", pngData, Limits{MaxBytes: int64(len(pngData) - 1), MaxWidth: 8000, MaxHeight: 8000}, true, "", 0, 0},
+		{"too many pixels", pngData, Limits{MaxBytes: 10 << 20, MaxWidth: 39, MaxHeight: 8000}, true, "", 0, 0},
+	}
+
+	sizes := Sizes{Thumbnail: Rendition{Width: 8, Height: 8, Crop: true}, Card: Rendition{Width: 16, Height: 16, Crop: true}, Full: Rendition{Width: 100, Height: 100}}
+
+	for _, tt := range tests {
+		processed, err := Process(bytes.NewReader(tt.data), tt.limits, sizes)
+
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidImage) {
+				t.Errorf("%s: Process returned %v, want ErrInvalidImage", tt.name, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: Process returned error: %v", tt.name, err)
+
+			continue
+		}
+
+		full := processed.Full
+
+		if full.ContentType != tt.wantContentType || full.Width != tt.wantWidth || full.Height != tt.wantHeight {
+			t.Errorf("%s: full rendition is %s %dx%d, want %s %dx%d", tt.name, full.ContentType, full.Width, full.Height, tt.wantContentType, tt.wantWidth, tt.wantHeight)
+		}
+
+		if processed.Thumbnail.Width != 8 || processed.Thumbnail.Height != 8 {
+			t.Errorf("%s: thumbnail is %dx%d, want 8x8", tt.name, processed.Thumbnail.Width, processed.Thumbnail.Height)
+		}
+
+		// Renditions are re-encoded, nothing of the original metadata survives
+		if bytes.Contains(full.Data, []byte("Exif")) {
+			t.Errorf("%s: full rendition still has EXIF data", tt.name)
+		}
+	}
+}
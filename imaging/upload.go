@@ -0,0 +1,80 @@
+package imaging
+
+import (
+	"bwastartup/storage"
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+)
+
+// Keys are the storage keys of an image's renditions, images uploaded before renditions existed only have Full
+type Keys struct {
+	Thumbnail string
+	Card      string
+	Full      string
+}
+
+// Upload processes the file and stores its renditions as <keyPrefix>-thumbnail, -card and -full, e.g. -card.jpg
+func Upload(store storage.Store, keyPrefix string, file *multipart.FileHeader, sizes Sizes) (Keys, error) {
+	body, err := file.Open()
+
+	if err != nil {
+		return Keys{}, err
+	}
+
+	defer body.Close()
+
+	return UploadReader(store, keyPrefix, body, sizes)
+}
+
+// UploadReader is Upload for files that don't come straight from a request, e.g. staged uploads
+func UploadReader(store storage.Store, keyPrefix string, body io.Reader, sizes Sizes) (Keys, error) {
+	processed, err := Process(body, DefaultLimits, sizes)
+
+	if err != nil {
+		return Keys{}, err
+	}
+
+	var keys Keys
+
+	renditions := []struct {
+		name    string
+		encoded Encoded
+		key     *string
+	}{
+		{"thumbnail", processed.Thumbnail, &keys.Thumbnail},
+		{"card", processed.Card, &keys.Card},
+		{"full", processed.Full, &keys.Full},
+	}
+
+	for _, rendition := range renditions {
+		storedKey, err := store.Put(keyPrefix+"-"+rendition.name+rendition.encoded.Extension, bytes.NewReader(rendition.encoded.Data), rendition.encoded.ContentType)
+
+		if err != nil {
+			// Don't leave some of the renditions behind without a row pointing at them
+			Delete(store, keys)
+
+			return Keys{}, err
+		}
+
+		*rendition.key = storedKey
+	}
+
+	return keys, nil
+}
+
+// Delete removes every rendition, renditions that are already gone are skipped
+func Delete(store storage.Store, keys Keys) error {
+	for _, key := range []string{keys.Thumbnail, keys.Card, keys.Full} {
+		if key == "" {
+			continue
+		}
+
+		if err := store.Delete(key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"bwastartup/entities/campaign"
+	"bwastartup/entities/transaction"
+	"fmt"
+	"log"
+	"time"
+)
+
+// failedCampaignReason is recorded on the refunds and cancellations of all-or-nothing campaigns that missed their goal
+const failedCampaignReason = "Campaign ended below its goal"
+
+type campaignDeadlineJob struct {
+	campaignService    campaign.Service
+	transactionService transaction.Service
+}
+
+// NewCampaignDeadlineJob settles the funding of campaigns whose end date has passed
+func NewCampaignDeadlineJob(campaignService campaign.Service, transactionService transaction.Service) *campaignDeadlineJob {
+	return &campaignDeadlineJob{campaignService, transactionService}
+}
+
+// Schedule runs the job every interval until the process exits
+func (j *campaignDeadlineJob) Schedule(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := j.Run(); err != nil {
+			log.Printf("Campaign deadline job: %v\n", err)
+		}
+	}
+}
+
+func (j *campaignDeadlineJob) Run() error {
+	endedCampaigns, err := j.campaignService.GetEndedCampaigns(time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	for _, endedCampaign := range endedCampaigns {
+		if err := j.settle(endedCampaign); err != nil {
+			// Keep going, the campaign stays active and is picked up again on the next run
+			log.Printf("Campaign deadline job: unable to settle campaign %d: %v\n", endedCampaign.ID, err)
+		}
+	}
+
+	// Failed campaigns are swept on every run, refunds that failed before and payments that settled late go back here
+	failedCampaigns, err := j.campaignService.GetFailedCampaignsWithFunds()
+
+	if err != nil {
+		return err
+	}
+
+	for _, failedCampaign := range failedCampaigns {
+		if err := j.refund(failedCampaign); err != nil {
+			log.Printf("Campaign deadline job: unable to refund campaign %d: %v\n", failedCampaign.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (j *campaignDeadlineJob) settle(endedCampaign campaign.Campaign) error {
+	if endedCampaign.FundingModel != campaign.FundingModelAllOrNothing || endedCampaign.CurrentAmount >= endedCampaign.GoalAmount {
+		_, err := j.campaignService.UpdateFundingStatus(endedCampaign, campaign.FundingStatusFunded)
+
+		return err
+	}
+
+	// The campaign fails before any money goes back, a payment that settles in the meantime is then refunded as a late one
+	failedCampaign, err := j.campaignService.UpdateFundingStatus(endedCampaign, campaign.FundingStatusFailed)
+
+	if err != nil {
+		return err
+	}
+
+	transactions, err := j.transactionService.GetAllTransactionsByRef(failedCampaign.ID, "campaign_id")
+
+	if err != nil {
+		return err
+	}
+
+	for _, trx := range transactions {
+		if trx.Status != transaction.StatusPending {
+			continue
+		}
+
+		// Unpaid pledges hold no money, a failed void is logged and late payments are refunded by the sweep
+		if _, err := j.transactionService.CancelTransaction(trx, transaction.ActorJob, failedCampaignReason); err != nil {
+			log.Printf("Campaign deadline job: unable to cancel transaction %d: %v\n", trx.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// refund gives back the settled pledges of a failed campaign, minus what is already refunded or being refunded
+func (j *campaignDeadlineJob) refund(failedCampaign campaign.Campaign) error {
+	transactions, err := j.transactionService.GetAllTransactionsByRef(failedCampaign.ID, "campaign_id")
+
+	if err != nil {
+		return err
+	}
+
+	failedRefunds := 0
+
+	for _, trx := range transactions {
+		if !trx.Status.IsSettled() {
+			continue
+		}
+
+		if _, err := j.transactionService.RefundRemaining(trx, transaction.ActorJob, failedCampaignReason); err != nil {
+			log.Printf("Campaign deadline job: unable to refund transaction %d: %v\n", trx.ID, err)
+			failedRefunds++
+		}
+	}
+
+	if failedRefunds > 0 {
+		return fmt.Errorf("%d transactions could not be refunded", failedRefunds)
+	}
+
+	return nil
+}
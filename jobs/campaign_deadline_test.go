@@ -0,0 +1,182 @@
+package jobs
+
+import (
+	"bwastartup/entities/campaign"
+	"bwastartup/entities/transaction"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// deadlineCampaignService keeps campaigns in memory and writes every funding status change to a shared log
+type deadlineCampaignService struct {
+	campaign.Service
+	campaigns map[int]*campaign.Campaign
+	calls     *[]string
+}
+
+func (s *deadlineCampaignService) GetEndedCampaigns(now time.Time) ([]campaign.Campaign, error) {
+	var endedCampaigns []campaign.Campaign
+
+	for id := 1; id <= len(s.campaigns); id++ {
+		if s.campaigns[id].FundingStatus == campaign.FundingStatusActive {
+			endedCampaigns = append(endedCampaigns, *s.campaigns[id])
+		}
+	}
+
+	return endedCampaigns, nil
+}
+
+func (s *deadlineCampaignService) GetFailedCampaignsWithFunds() ([]campaign.Campaign, error) {
+	var failedCampaigns []campaign.Campaign
+
+	for id := 1; id <= len(s.campaigns); id++ {
+		if s.campaigns[id].FundingStatus == campaign.FundingStatusFailed && s.campaigns[id].CurrentAmount > 0 {
+			failedCampaigns = append(failedCampaigns, *s.campaigns[id])
+		}
+	}
+
+	return failedCampaigns, nil
+}
+
+func (s *deadlineCampaignService) UpdateFundingStatus(cmp campaign.Campaign, status string) (campaign.Campaign, error) {
+	*s.calls = append(*s.calls, fmt.Sprintf("campaign %d %s", cmp.ID, status))
+	s.campaigns[cmp.ID].FundingStatus = status
+
+	return *s.campaigns[cmp.ID], nil
+}
+
+// deadlineTransactionService writes every cancellation and refund to the shared log, refunds of failingRefunds fail
+type deadlineTransactionService struct {
+	transaction.Service
+	transactions   []transaction.Transaction
+	failingRefunds map[int]bool
+	calls          *[]string
+}
+
+func (s *deadlineTransactionService) GetAllTransactionsByRef(id int, field string) ([]transaction.Transaction, error) {
+	var transactions []transaction.Transaction
+
+	for _, trx := range s.transactions {
+		if trx.CampaignID == id {
+			transactions = append(transactions, trx)
+		}
+	}
+
+	return transactions, nil
+}
+
+func (s *deadlineTransactionService) CancelTransaction(trx transaction.Transaction, actor transaction.Actor, reason string) (transaction.Transaction, error) {
+	*s.calls = append(*s.calls, fmt.Sprintf("cancel %d", trx.ID))
+
+	return trx, nil
+}
+
+func (s *deadlineTransactionService) RefundRemaining(trx transaction.Transaction, actor transaction.Actor, reason string) (transaction.Transaction, error) {
+	*s.calls = append(*s.calls, fmt.Sprintf("refund %d", trx.ID))
+
+	if s.failingRefunds[trx.ID] {
+		return trx, errors.New("gateway unavailable")
+	}
+
+	return trx, nil
+}
+
+func TestCampaignDeadlineJob(t *testing.T) {
+	tests := []struct {
+		name           string
+		campaign       campaign.Campaign
+		failingRefunds map[int]bool
+		want           []string
+	}{
+		{
+			"goal reached",
+			campaign.Campaign{ID: 1, FundingModel: campaign.FundingModelAllOrNothing, FundingStatus: campaign.FundingStatusActive, GoalAmount: 100000, CurrentAmount: 100000},
+			nil,
+			[]string{"campaign 1 funded"},
+		},
+		{
+			"keep it all below its goal",
+			campaign.Campaign{ID: 1, FundingModel: campaign.FundingModelKeepItAll, FundingStatus: campaign.FundingStatusActive, GoalAmount: 100000, CurrentAmount: 40000},
+			nil,
+			[]string{"campaign 1 funded"},
+		},
+		{
+			// The campaign fails before anything is cancelled or refunded
+			"all or nothing below its goal",
+			campaign.Campaign{ID: 1, FundingModel: campaign.FundingModelAllOrNothing, FundingStatus: campaign.FundingStatusActive, GoalAmount: 100000, CurrentAmount: 40000},
+			nil,
+			[]string{"campaign 1 failed", "cancel 2", "refund 1", "refund 3"},
+		},
+		{
+			"failed campaign swept again",
+			campaign.Campaign{ID: 1, FundingModel: campaign.FundingModelAllOrNothing, FundingStatus: campaign.FundingStatusFailed, GoalAmount: 100000, CurrentAmount: 40000},
+			nil,
+			[]string{"refund 1", "refund 3"},
+		},
+		{
+			"refund failing on the gateway",
+			campaign.Campaign{ID: 1, FundingModel: campaign.FundingModelAllOrNothing, FundingStatus: campaign.FundingStatusActive, GoalAmount: 100000, CurrentAmount: 40000},
+			map[int]bool{1: true},
+			[]string{"campaign 1 failed", "cancel 2", "refund 1", "refund 3"},
+		},
+	}
+
+	for _, tt := range tests {
+		var calls []string
+
+		endedCampaign := tt.campaign
+		campaignService := &deadlineCampaignService{campaigns: map[int]*campaign.Campaign{1: &endedCampaign}, calls: &calls}
+		transactionService := &deadlineTransactionService{
+			transactions: []transaction.Transaction{
+				{ID: 1, CampaignID: 1, Amount: 30000, Status: transaction.StatusPaid},
+				{ID: 2, CampaignID: 1, Amount: 50000, Status: transaction.StatusPending},
+				{ID: 3, CampaignID: 1, Amount: 10000, Status: transaction.StatusPartiallyRefunded, RefundedAmount: 5000},
+				{ID: 4, CampaignID: 1, Amount: 20000, Status: transaction.StatusExpired},
+			},
+			failingRefunds: tt.failingRefunds,
+			calls:          &calls,
+		}
+
+		job := NewCampaignDeadlineJob(campaignService, transactionService)
+
+		if err := job.Run(); err != nil {
+			t.Errorf("%s: Run returned error: %v", tt.name, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(calls, tt.want) {
+			t.Errorf("%s: Run made calls %v, want %v", tt.name, calls, tt.want)
+		}
+	}
+}
+
+func TestCampaignDeadlineJobRetriesFailedRefunds(t *testing.T) {
+	var calls []string
+
+	endedCampaign := campaign.Campaign{ID: 1, FundingModel: campaign.FundingModelAllOrNothing, FundingStatus: campaign.FundingStatusActive, GoalAmount: 100000, CurrentAmount: 30000}
+	campaignService := &deadlineCampaignService{campaigns: map[int]*campaign.Campaign{1: &endedCampaign}, calls: &calls}
+	transactionService := &deadlineTransactionService{
+		transactions:   []transaction.Transaction{{ID: 1, CampaignID: 1, Amount: 30000, Status: transaction.StatusPaid}},
+		failingRefunds: map[int]bool{1: true},
+		calls:          &calls,
+	}
+
+	job := NewCampaignDeadlineJob(campaignService, transactionService)
+
+	for run := 0; run < 2; run++ {
+		if err := job.Run(); err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	}
+
+	// The campaign is settled once, its refund is tried again on the next run
+	want := []string{"campaign 1 failed", "refund 1", "refund 1"}
+
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("Run made calls %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"bwastartup/entities/campaign"
+	"bwastartup/entities/upload"
+	"bwastartup/imaging"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+type uploadWorker struct {
+	uploadService   upload.Service
+	campaignService campaign.Service
+}
+
+// NewUploadWorker stores the campaign images of queued upload jobs
+func NewUploadWorker(uploadService upload.Service, campaignService campaign.Service) *uploadWorker {
+	return &uploadWorker{uploadService, campaignService}
+}
+
+// Start runs the worker pool until the process exits. Jobs interrupted by the previous shutdown are queued again
+// first, this assumes a single instance processes uploads
+func (w *uploadWorker) Start(workers int) {
+	if err := w.uploadService.ResetInterruptedJobs(); err != nil {
+		log.Printf("Upload worker: unable to reset interrupted jobs: %v\n", err)
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for jobID := range w.uploadService.Queue() {
+				if err := w.Process(jobID); err != nil {
+					log.Printf("Upload worker: job %d: %v\n", jobID, err)
+				}
+			}
+		}()
+	}
+
+	if err := w.Run(); err != nil {
+		log.Printf("Upload worker: %v\n", err)
+	}
+}
+
+// Schedule queues pending jobs every interval, in case they didn't fit in the queue when they were created
+func (w *uploadWorker) Schedule(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := w.Run(); err != nil {
+			log.Printf("Upload worker: %v\n", err)
+		}
+	}
+}
+
+func (w *uploadWorker) Run() error {
+	return w.uploadService.EnqueuePending()
+}
+
+// Process handles the files of one job in order, so the images keep the order they were uploaded in
+func (w *uploadWorker) Process(jobID int) error {
+	job, claimed, err := w.uploadService.ClaimJob(jobID)
+
+	if err != nil || !claimed {
+		return err
+	}
+
+	for i, file := range job.Files {
+		if file.Status == upload.StatusCompleted || file.Status == upload.StatusFailed {
+			continue
+		}
+
+		processedFile, err := w.processFile(job, file)
+
+		if err != nil {
+			w.release(job)
+
+			return fmt.Errorf("unable to process file %d: %v", file.ID, err)
+		}
+
+		job.Files[i] = processedFile
+	}
+
+	if _, err = w.uploadService.FinishJob(job); err != nil {
+		w.release(job)
+
+		return err
+	}
+
+	return nil
+}
+
+// release puts the job back to pending so the next sweep retries the files that are left. When that fails too the
+// job stays processing until the next restart
+func (w *uploadWorker) release(job upload.UploadJob) {
+	if err := w.uploadService.ReleaseJob(job); err != nil {
+		log.Printf("Upload worker: unable to release job %d: %v\n", job.ID, err)
+	}
+}
+
+func (w *uploadWorker) processFile(job upload.UploadJob, file upload.UploadFile) (upload.UploadFile, error) {
+	file, err := w.uploadService.StartFile(file)
+
+	if err != nil {
+		return file, err
+	}
+
+	body, err := w.uploadService.OpenStagedFile(file)
+
+	if err != nil {
+		return file, err
+	}
+
+	defer body.Close()
+
+	// A retry after a crash between storing the image and completing the file gets the image stored the first time
+	keyPrefix := fmt.Sprintf("campaigns/campaign-%d-upload-%d", job.CampaignID, file.ID)
+
+	image, err := w.campaignService.AddCampaignImage(job.CampaignID, file.ID, body, keyPrefix, file.Position == job.CoverIndex)
+
+	// Only an invalid image fails for good, anything else is left pending for a retry
+	if errors.Is(err, imaging.ErrInvalidImage) {
+		return w.uploadService.FailFile(file, err)
+	}
+
+	if err != nil {
+		return file, err
+	}
+
+	return w.uploadService.CompleteFile(file, image.ID)
+}
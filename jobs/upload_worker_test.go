@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"bwastartup/entities/campaign"
+	"bwastartup/entities/upload"
+	"bwastartup/imaging"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// workerUploadService keeps one job in memory, a staged file reads as its staging key
+type workerUploadService struct {
+	upload.Service
+	job             upload.UploadJob
+	finishErr       error
+	completeFileErr error
+}
+
+func (s *workerUploadService) ClaimJob(ID int) (upload.UploadJob, bool, error) {
+	if s.job.Status != upload.StatusPending {
+		return s.job, false, nil
+	}
+
+	s.job.Status = upload.StatusProcessing
+
+	return s.job, true, nil
+}
+
+func (s *workerUploadService) ReleaseJob(job upload.UploadJob) error {
+	s.job.Status = upload.StatusPending
+
+	for i := range s.job.Files {
+		if s.job.Files[i].Status == upload.StatusProcessing {
+			s.job.Files[i].Status = upload.StatusPending
+		}
+	}
+
+	return nil
+}
+
+func (s *workerUploadService) OpenStagedFile(file upload.UploadFile) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(file.StagingKey)), nil
+}
+
+func (s *workerUploadService) StartFile(file upload.UploadFile) (upload.UploadFile, error) {
+	return s.setFileStatus(file, upload.StatusProcessing), nil
+}
+
+func (s *workerUploadService) CompleteFile(file upload.UploadFile, campaignImageID int) (upload.UploadFile, error) {
+	if s.completeFileErr != nil {
+		return file, s.completeFileErr
+	}
+
+	return s.setFileStatus(file, upload.StatusCompleted), nil
+}
+
+func (s *workerUploadService) FailFile(file upload.UploadFile, cause error) (upload.UploadFile, error) {
+	return s.setFileStatus(file, upload.StatusFailed), nil
+}
+
+func (s *workerUploadService) FinishJob(job upload.UploadJob) (upload.UploadJob, error) {
+	if s.finishErr != nil {
+		return job, s.finishErr
+	}
+
+	s.job.Status = upload.StatusCompleted
+
+	return s.job, nil
+}
+
+func (s *workerUploadService) setFileStatus(file upload.UploadFile, status string) upload.UploadFile {
+	for i := range s.job.Files {
+		if s.job.Files[i].ID == file.ID {
+			s.job.Files[i].Status = status
+		}
+	}
+
+	file.Status = status
+
+	return file
+}
+
+// workerCampaignService fails with whatever the staged file says, "ok" stores the image
+type workerCampaignService struct {
+	campaign.Service
+}
+
+func (s *workerCampaignService) AddCampaignImage(campaignID int, uploadFileID int, body io.Reader, keyPrefix string, isCover bool) (campaign.CampaignImage, error) {
+	content, _ := ioutil.ReadAll(body)
+
+	switch string(content) {
+	case "ok":
+		return campaign.CampaignImage{ID: uploadFileID}, nil
+	case "invalid":
+		return campaign.CampaignImage{}, fmt.Errorf("%w, only JPEG, PNG and WebP images are accepted", imaging.ErrInvalidImage)
+	default:
+		return campaign.CampaignImage{}, errors.New("storage unavailable")
+	}
+}
+
+func TestUploadWorkerProcess(t *testing.T) {
+	tests := []struct {
+		name            string
+		staged          []string
+		finishErr       error
+		completeFileErr error
+		wantJobStatus   string
+		wantFileStatus  []string
+	}{
+		{"valid images", []string{"ok", "ok"}, nil, nil, upload.StatusCompleted, []string{upload.StatusCompleted, upload.StatusCompleted}},
+		{"invalid image", []string{"ok", "invalid"}, nil, nil, upload.StatusCompleted, []string{upload.StatusCompleted, upload.StatusFailed}},
+		{
+			// The file isn't failed for a storage error, the job goes back to pending for the next sweep
+			"storage error",
+			[]string{"ok", "unavailable", "ok"}, nil, nil,
+			upload.StatusPending, []string{upload.StatusCompleted, upload.StatusPending, upload.StatusPending},
+		},
+		{"completing a file fails", []string{"ok"}, nil, errors.New("database unavailable"), upload.StatusPending, []string{upload.StatusPending}},
+		{"finishing the job fails", []string{"ok"}, errors.New("database unavailable"), nil, upload.StatusPending, []string{upload.StatusCompleted}},
+	}
+
+	for _, tt := range tests {
+		job := upload.UploadJob{ID: 1, CampaignID: 1, Status: upload.StatusPending}
+
+		for i, staged := range tt.staged {
+			job.Files = append(job.Files, upload.UploadFile{ID: i + 1, Position: i, StagingKey: staged, Status: upload.StatusPending})
+		}
+
+		uploadService := &workerUploadService{job: job, finishErr: tt.finishErr, completeFileErr: tt.completeFileErr}
+		worker := NewUploadWorker(uploadService, &workerCampaignService{})
+
+		err := worker.Process(job.ID)
+
+		if (err != nil) != (tt.wantJobStatus == upload.StatusPending) {
+			t.Errorf("%s: Process returned %v", tt.name, err)
+		}
+
+		if uploadService.job.Status != tt.wantJobStatus {
+			t.Errorf("%s: job is %s, want %s", tt.name, uploadService.job.Status, tt.wantJobStatus)
+		}
+
+		for i, file := range uploadService.job.Files {
+			if file.Status != tt.wantFileStatus[i] {
+				t.Errorf("%s: file %d is %s, want %s", tt.name, file.ID, file.Status, tt.wantFileStatus[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type logMailer struct {
+	dir string
+}
+
+// NewLogMailer is meant for development, it writes every email as an .eml file into dir or to the log when dir is empty
+func NewLogMailer(dir string) Mailer {
+	return &logMailer{dir}
+}
+
+func (m *logMailer) Send(message Message) error {
+	content := buildMessage("no-reply@localhost", message)
+
+	if m.dir == "" {
+		log.Printf("Mailer: email to %s\n%s\n", message.To, content)
+
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), message.To)
+
+	if err := ioutil.WriteFile(filepath.Join(m.dir, filepath.Base(fileName)), content, 0644); err != nil {
+		return err
+	}
+
+	return nil
+}
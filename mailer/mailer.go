@@ -0,0 +1,12 @@
+package mailer
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends plain text emails, see NewSMTPMailer and NewLogMailer
+type Mailer interface {
+	Send(message Message) error
+}
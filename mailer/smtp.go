@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host string, port string, username string, password string, from string) Mailer {
+	return &smtpMailer{host, port, username, password, from}
+}
+
+func (m *smtpMailer) Send(message Message) error {
+	var auth smtp.Auth
+
+	// Local relays such as MailHog don't need credentials
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	err := smtp.SendMail(net.JoinHostPort(m.host, m.port), auth, m.from, []string{message.To}, buildMessage(m.from, message))
+
+	if err != nil {
+		return fmt.Errorf("Unable to send email to %s: %v", message.To, err)
+	}
+
+	return nil
+}
+
+func buildMessage(from string, message Message) []byte {
+	// Header values must not contain line breaks, they would let the caller inject headers
+	headerValue := strings.NewReplacer("\r", "", "\n", "")
+
+	var builder strings.Builder
+
+	builder.WriteString("From: " + headerValue.Replace(from) + "\r\n")
+	builder.WriteString("To: " + headerValue.Replace(message.To) + "\r\n")
+	builder.WriteString("Subject: " + headerValue.Replace(message.Subject) + "\r\n")
+	builder.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	return []byte(builder.String())
+}
@@ -5,16 +5,28 @@ import (
 	"bwastartup/entities/campaign"
 	"bwastartup/entities/payment"
 	"bwastartup/entities/transaction"
+	"bwastartup/entities/upload"
 	"bwastartup/entities/user"
 	"bwastartup/handlers"
 	"bwastartup/helpers"
+	"bwastartup/jobs"
+	"bwastartup/mailer"
+	"bwastartup/oauth"
+	"bwastartup/ratelimit"
+	"bwastartup/storage"
+	"bytes"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -42,29 +54,156 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
-	// * Storage
-	// * Create a Google API service
-	srv, err := gdstorage.NewStorageService()
-	if err != nil {
-		log.Fatalf("Error creating storage service: %v\n", err)
+	// * Storage, STORAGE_DRIVER picks gdrive (default), s3 or local. Existing installs keep their images on Google Drive,
+	// see migrations/README.md before switching
+	var store storage.Store
+
+	switch os.Getenv("STORAGE_DRIVER") {
+	case "local":
+		store = storage.NewLocalStore(localStorageDir(), localStorageURL())
+	case "s3":
+		store = storage.NewS3Store(storage.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+			PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+		})
+	case "", "gdrive":
+		// * Create a Google API service
+		srv, err := gdstorage.NewStorageService()
+		if err != nil {
+			log.Fatalf("Error creating storage service: %v\n", err)
+		}
+
+		store = storage.NewDriveStore(gdstorage.New(srv), map[string]string{
+			"users":     os.Getenv("DRIVE_APP_USER_IMAGES_DIR_ID"),
+			"campaigns": os.Getenv("DRIVE_APP_CAMPAIGN_IMAGES_DIR_ID"),
+		})
+	default:
+		log.Fatalf("Unknown STORAGE_DRIVER %q, use gdrive, s3 or local\n", os.Getenv("STORAGE_DRIVER"))
+	}
+
+	storage.SetDefault(store)
+
+	// * Mailer, set MAILER_DRIVER=smtp to send real emails, otherwise they are written to MAILER_LOG_DIR or the log
+	var appMailer mailer.Mailer
+
+	switch os.Getenv("MAILER_DRIVER") {
+	case "smtp":
+		appMailer = mailer.NewSMTPMailer(os.Getenv("SMTP_HOST"), os.Getenv("SMTP_PORT"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("MAIL_FROM"))
+	default:
+		appMailer = mailer.NewLogMailer(os.Getenv("MAILER_LOG_DIR"))
 	}
 
-	gds := gdstorage.New(srv)
+	// * Campaign search, set CAMPAIGN_SEARCH_DRIVER=memory to search without the Postgres index
+	var campaignSearchRepository campaign.SearchRepository
+
+	switch os.Getenv("CAMPAIGN_SEARCH_DRIVER") {
+	case "memory":
+		campaignSearchRepository = campaign.NewMemorySearchRepository()
+	default:
+		campaignSearchRepository = campaign.NewPostgresSearchRepository(db)
+	}
 
 	// * Handlers
 	userRepository := user.NewRepository(db)
-	campaignRepository := campaign.NewRepository(db)
+	campaignRepository := campaign.NewRepository(db, campaignSearchRepository)
 	transactionRepository := transaction.NewRepository(db)
+	authRepository := auth.NewRepository(db)
+	uploadRepository := upload.NewRepository(db)
+
+	// * Payment gateway, set PAYMENT_GATEWAY=fake to run the payment flow offline
+	var paymentGateway payment.Gateway
+	paymentServerKey := os.Getenv("MIDTRANS_SERVER_KEY")
+
+	switch os.Getenv("PAYMENT_GATEWAY") {
+	case "fake":
+		if paymentServerKey == "" {
+			paymentServerKey = "fake-server-key"
+		}
+
+		paymentGateway = payment.NewFakeGateway(paymentServerKey, os.Getenv("FAKE_PAYMENT_URL"))
+	default:
+		paymentGateway = payment.NewMidtransGateway(paymentServerKey, os.Getenv("MIDTRANS_CLIENT_KEY"), os.Getenv("MIDTRANS_ENV") == "production", os.Getenv("MIDTRANS_SNAP_URL"))
+	}
 
-	userService := user.NewService(userRepository, gds)
-	authService := auth.NewService()
-	campaignService := campaign.NewService(campaignRepository, gds)
-	transactionService := transaction.NewService(transactionRepository)
-	paymentService := payment.NewService()
+	paymentService := payment.NewService(paymentGateway, paymentServerKey)
+
+	userService := user.NewService(userRepository, store, appMailer)
+	authService := auth.NewService(authRepository, userService)
+	campaignService := campaign.NewService(campaignRepository, store)
+	transactionService := transaction.NewService(transactionRepository, paymentService)
+	// Uploads are staged on local disk until the upload worker has stored them in the configured storage
+	uploadService := upload.NewService(uploadRepository, storage.NewLocalStore(uploadStagingDir(), ""), 100)
+
+	// * Rate limiting, state is kept in memory so limits apply per instance
+	rateLimitStore := ratelimit.NewMemoryStore()
+	// 5 failed logins lock the account for a minute, every further failure doubles it up to an hour
+	loginLockout := ratelimit.NewLockout(rateLimitStore, 5, time.Minute, time.Hour, 24*time.Hour)
+
+	userHandler := handlers.NewUserHandler(userService, authService, loginLockout)
+	authHandler := handlers.NewAuthHandler(authService, userService)
+
+	// * Social login, a provider is enabled by setting its client ID. The endpoint URLs can point at a mock IdP for testing
+	oauthProviders := []oauth.Provider{}
+
+	if os.Getenv("GOOGLE_CLIENT_ID") != "" {
+		oauthProviders = append(oauthProviders, oauth.NewGoogleProvider(oauth.Config{
+			ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
+			AuthURL:      os.Getenv("GOOGLE_AUTH_URL"),
+			TokenURL:     os.Getenv("GOOGLE_TOKEN_URL"),
+			UserInfoURL:  os.Getenv("GOOGLE_USERINFO_URL"),
+		}))
+	}
+
+	if os.Getenv("GITHUB_CLIENT_ID") != "" {
+		oauthProviders = append(oauthProviders, oauth.NewGitHubProvider(oauth.Config{
+			ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
+			ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("GITHUB_REDIRECT_URL"),
+			AuthURL:      os.Getenv("GITHUB_AUTH_URL"),
+			TokenURL:     os.Getenv("GITHUB_TOKEN_URL"),
+			UserInfoURL:  os.Getenv("GITHUB_USER_URL"),
+		}, os.Getenv("GITHUB_EMAILS_URL")))
+	}
 
-	userHandler := handlers.NewUserHandler(userService, authService)
-	campaignHandler := handlers.NewCampaignHandler(campaignService)
+	oauthHandler := handlers.NewOAuthHandler(oauthProviders, userService, authService)
+	campaignHandler := handlers.NewCampaignHandler(campaignService, uploadService)
+	uploadHandler := handlers.NewUploadHandler(uploadService)
 	transactionHandler := handlers.NewTransactionHandler(transactionService, campaignService, paymentService)
+	paymentHandler := handlers.NewPaymentHandler(paymentService, transactionService, campaignService)
+	accountHandler := handlers.NewAccountHandler(userService, authService, campaignService, transactionService)
+
+	// * Jobs
+	campaignDeadlineJob := jobs.NewCampaignDeadlineJob(campaignService, transactionService)
+	uploadWorker := jobs.NewUploadWorker(uploadService, campaignService)
+
+	// * Commands, e.g. `bwastartup recalculate-stats` or `bwastartup settle-campaigns`
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "recalculate-stats":
+			if err := transactionService.RecalculateAllCampaignStats(); err != nil {
+				log.Fatalf("Error recalculating campaign stats: %v\n", err)
+			}
+
+			log.Println("Campaign stats recalculated")
+		case "settle-campaigns":
+			if err := campaignDeadlineJob.Run(); err != nil {
+				log.Fatalf("Error settling ended campaigns: %v\n", err)
+			}
+
+			log.Println("Ended campaigns settled")
+		default:
+			log.Fatalf("Unknown command: %s\n", os.Args[1])
+		}
+
+		return
+	}
 
 	router := gin.Default()
 
@@ -77,7 +216,7 @@ func main() {
 	router.Use(cors.New(corsConfig))
 
 	// * STATIC FILES
-	router.Static("/images", "./images")
+	router.Static("/images", localStorageDir())
 
 	api := router.Group("/api/v1")
 
@@ -86,36 +225,129 @@ func main() {
 	// ================================================================================================================
 
 	// Users & Auth
-	api.POST("/register", userHandler.RegisterUser)
-	api.POST("/login", userHandler.LoginUser)
-	api.POST("/email-check", userHandler.CheckEmailAvailability)
+	api.POST("/register", rateLimit(rateLimitStore, "register", ratelimit.Rule{Limit: 10, Per: time.Hour}, byIP), userHandler.RegisterUser)
+	api.POST("/login", rateLimit(rateLimitStore, "login", ratelimit.Rule{Limit: 20, Per: time.Minute}, byIP), rateLimit(rateLimitStore, "login", ratelimit.Rule{Limit: 10, Per: time.Minute}, byAccount), userHandler.LoginUser)
+	api.POST("/login/2fa", rateLimit(rateLimitStore, "login-2fa", ratelimit.Rule{Limit: 20, Per: time.Minute}, byIP), userHandler.LoginTwoFactor)
+	api.GET("/auth/oauth/:provider", oauthHandler.Redirect)
+	api.GET("/auth/oauth/:provider/callback", rateLimit(rateLimitStore, "oauth", ratelimit.Rule{Limit: 20, Per: time.Minute}, byIP), oauthHandler.Callback)
+	api.POST("/auth/refresh", authHandler.RefreshToken)
+	api.POST("/auth/logout", authorize(authService, userService), authHandler.Logout)
+	api.POST("/auth/logout-all", authorize(authService, userService), authHandler.LogoutAll)
+	api.POST("/email-check", rateLimit(rateLimitStore, "email-check", ratelimit.Rule{Limit: 10, Per: time.Minute}, byIP), userHandler.CheckEmailAvailability)
+	api.POST("/password/forgot", rateLimit(rateLimitStore, "password-forgot", ratelimit.Rule{Limit: 10, Per: time.Hour}, byIP), rateLimit(rateLimitStore, "password-forgot", ratelimit.Rule{Limit: 3, Per: time.Hour}, byAccount), userHandler.ForgotPassword)
+	api.POST("/password/reset", userHandler.ResetPassword)
+	api.GET("/email/verify", userHandler.VerifyEmail)
+	api.POST("/email/verify/resend", authorize(authService, userService), userHandler.ResendEmailVerification)
 	api.POST("/update-avatar", authorize(authService, userService), userHandler.UpdateAvatar)
 	api.GET("/me/fetch", authorize(authService, userService), userHandler.FetchCurrentUser)
+	api.PATCH("/me", authorize(authService, userService), userHandler.UpdateProfile)
+	api.POST("/me/email", authorize(authService, userService), userHandler.ChangeEmail)
+	api.POST("/me/password", authorize(authService, userService), userHandler.ChangePassword)
+	api.POST("/me/2fa/setup", authorize(authService, userService), userHandler.SetupTwoFactor)
+	api.POST("/me/2fa/confirm", authorize(authService, userService), userHandler.ConfirmTwoFactor)
+	api.POST("/me/2fa/disable", authorize(authService, userService), userHandler.DisableTwoFactor)
+	api.GET("/me/api-keys", authorize(authService, userService), authHandler.GetAPIKeys)
+	api.POST("/me/api-keys", authorize(authService, userService), authHandler.CreateAPIKey)
+	api.DELETE("/me/api-keys/:api_key_id", authorize(authService, userService), authHandler.RevokeAPIKey)
+	api.GET("/me/export", authorize(authService, userService), accountHandler.ExportAccount)
+	api.DELETE("/me", authorize(authService, userService), accountHandler.DeleteAccount)
 
 	// Campaign & Transactions
-	api.POST("/campaigns", authorize(authService, userService), campaignHandler.CreateCampaign)
-	api.POST("/campaigns/:campaign_id/images", authorize(authService, userService), campaignHandler.CreateCampaignImages)
-	api.POST("/campaigns/:campaign_id/back", authorize(authService, userService), transactionHandler.CreateTransaction)
-	api.PATCH("/campaigns/:campaign_id", authorize(authService, userService), campaignHandler.UpdateCampaign)
+	api.POST("/campaigns", authorize(authService, userService, auth.ScopeCampaignsWrite), requireVerifiedEmail(), campaignHandler.CreateCampaign)
+	api.POST("/campaigns/:campaign_id/images", authorize(authService, userService, auth.ScopeCampaignsWrite), campaignHandler.CreateCampaignImages)
+	api.PUT("/campaigns/:campaign_id/images/order", authorize(authService, userService, auth.ScopeCampaignsWrite), campaignHandler.ReorderCampaignImages)
+	api.PATCH("/campaigns/:campaign_id/images/:image_id", authorize(authService, userService, auth.ScopeCampaignsWrite), campaignHandler.UpdateCampaignImage)
+	api.DELETE("/campaigns/:campaign_id/images/:image_id", authorize(authService, userService, auth.ScopeCampaignsWrite), campaignHandler.DeleteCampaignImage)
+	api.GET("/uploads/:job_id", authorize(authService, userService, auth.ScopeCampaignsWrite), uploadHandler.GetUploadJob)
+	api.POST("/campaigns/:campaign_id/back", rateLimit(rateLimitStore, "back", ratelimit.Rule{Limit: 30, Per: time.Minute}, byIP), authorize(authService, userService, auth.ScopeTransactionsWrite), requireVerifiedEmail(), rateLimit(rateLimitStore, "back", ratelimit.Rule{Limit: 10, Per: time.Minute}, byAccount), transactionHandler.CreateTransaction)
+	api.PATCH("/campaigns/:campaign_id", authorize(authService, userService, auth.ScopeCampaignsWrite), campaignHandler.UpdateCampaign)
+	api.POST("/campaigns/:campaign_id/status", authorize(authService, userService, auth.ScopeCampaignsWrite), campaignHandler.UpdateCampaignStatus)
+	api.GET("/campaigns/:campaign_id/status-history", authorize(authService, userService, auth.ScopeCampaignsRead), campaignHandler.GetCampaignStatusHistory)
+	api.GET("/campaigns/:campaign_id/preview", authorize(authService, userService, auth.ScopeCampaignsRead), campaignHandler.GetCampaignPreview)
 	api.GET("/campaigns", campaignHandler.GetAllCampaigns)
+	api.GET("/campaigns/search", campaignHandler.SearchCampaigns)
+	api.GET("/campaigns/by-slug/:slug", campaignHandler.GetCampaignBySlug)
 	api.GET("/campaigns/:campaign_id", campaignHandler.GetCampaignByID)
-	api.GET("/campaigns/:campaign_id/transactions", transactionHandler.GetTransactionByCampaignID)
-	api.GET("/me/transactions", authorize(authService, userService), transactionHandler.GetOwnTransactions)
-	api.GET("/me/campaigns", authorize(authService, userService), campaignHandler.GetOwnCampaigns)
+	api.GET("/campaigns/:campaign_id/rewards", campaignHandler.GetCampaignRewards)
+	api.POST("/campaigns/:campaign_id/rewards", authorize(authService, userService, auth.ScopeCampaignsWrite), campaignHandler.CreateCampaignReward)
+	api.PATCH("/campaigns/:campaign_id/rewards/:reward_id", authorize(authService, userService, auth.ScopeCampaignsWrite), campaignHandler.UpdateCampaignReward)
+	api.DELETE("/campaigns/:campaign_id/rewards/:reward_id", authorize(authService, userService, auth.ScopeCampaignsWrite), campaignHandler.DeleteCampaignReward)
+	api.GET("/campaigns/:campaign_id/transactions", authorize(authService, userService, auth.ScopeTransactionsRead), transactionHandler.GetTransactionByCampaignID)
+	api.GET("/me/transactions", authorize(authService, userService, auth.ScopeTransactionsRead), transactionHandler.GetOwnTransactions)
+	api.GET("/me/campaigns", authorize(authService, userService, auth.ScopeCampaignsRead), campaignHandler.GetOwnCampaigns)
+
+	// Payments
+	api.POST("/payments/notification", paymentHandler.HandleNotification)
+
+	if os.Getenv("PAYMENT_GATEWAY") == "fake" {
+		api.POST("/payments/fake/notify", paymentHandler.SimulateNotification)
+	}
 
 	// ================================================================================================================
 	// ================================================================================================================
 
-	api.DELETE("/campaigns/:campaign_id", authorize(authService, userService), campaignHandler.DeleteCampaign)
-	api.GET("/transactions", authorize(authService, userService), transactionHandler.GetAllTransactions)
-	api.GET("/transactions/:transaction_id", authorize(authService, userService), transactionHandler.GetTransactionByID)
-	api.PUT("/transactions/:transaction_id/verify", authorize(authService, userService), transactionHandler.VerifyTransaction)
+	api.DELETE("/campaigns/:campaign_id", authorize(authService, userService, auth.ScopeCampaignsWrite), campaignHandler.DeleteCampaign)
+	api.GET("/transactions", authorize(authService, userService), requirePermission(user.PermissionViewAllTransactions), transactionHandler.GetAllTransactions)
+	api.GET("/transactions/:transaction_id", authorize(authService, userService, auth.ScopeTransactionsRead), transactionHandler.GetTransactionByID)
+	api.GET("/transactions/:transaction_id/history", authorize(authService, userService, auth.ScopeTransactionsRead), transactionHandler.GetTransactionHistory)
+	api.POST("/transactions/:transaction_id/refunds", authorize(authService, userService), transactionHandler.CreateRefund)
+	api.GET("/transactions/:transaction_id/refunds", authorize(authService, userService, auth.ScopeTransactionsRead), transactionHandler.GetRefunds)
+	api.PUT("/transactions/:transaction_id/verify", authorize(authService, userService), requirePermission(user.PermissionVerifyTransactions), transactionHandler.VerifyTransaction)
+
+	// Admin
+	api.POST("/admin/users/:user_id/roles", authorize(authService, userService), requirePermission(user.PermissionManageRoles), userHandler.GrantRole)
+	api.DELETE("/admin/users/:user_id/roles/:role", authorize(authService, userService), requirePermission(user.PermissionManageRoles), userHandler.RevokeRole)
+	api.GET("/admin/campaigns", authorize(authService, userService), requirePermission(user.PermissionModerateCampaigns), campaignHandler.GetCampaignsForModeration)
+
+	// * Settle campaigns once they reach their end date
+	jobInterval, err := time.ParseDuration(os.Getenv("CAMPAIGN_DEADLINE_JOB_INTERVAL"))
+	if err != nil {
+		jobInterval = 5 * time.Minute
+	}
+
+	go campaignDeadlineJob.Schedule(jobInterval)
+
+	// * Process uploaded campaign images, UPLOAD_WORKERS defaults to 2
+	uploadWorkers, err := strconv.Atoi(os.Getenv("UPLOAD_WORKERS"))
+	if err != nil || uploadWorkers < 1 {
+		uploadWorkers = 2
+	}
+
+	uploadWorker.Start(uploadWorkers)
+	go uploadWorker.Schedule(time.Minute)
 
 	router.Run()
 
 }
 
-func authorize(authService auth.Service, userService user.Service) gin.HandlerFunc {
+// localStorageDir is where the local storage driver keeps uploads, they are served under /images
+func localStorageDir() string {
+	if dir := os.Getenv("STORAGE_LOCAL_DIR"); dir != "" {
+		return dir
+	}
+
+	return "./images"
+}
+
+// localStorageURL can be set to an absolute URL (e.g. https://api.example.com/images) when the client runs on another host
+func localStorageURL() string {
+	if baseURL := os.Getenv("STORAGE_LOCAL_URL"); baseURL != "" {
+		return baseURL
+	}
+
+	return "/images"
+}
+
+func uploadStagingDir() string {
+	if dir := os.Getenv("UPLOAD_STAGING_DIR"); dir != "" {
+		return dir
+	}
+
+	return filepath.Join(os.TempDir(), "bwastartup-uploads")
+}
+
+// authorize accepts an access token, or an API key granted every one of the scopes. Without scopes the route is closed to API keys
+func authorize(authService auth.Service, userService user.Service, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 
@@ -128,6 +360,12 @@ func authorize(authService auth.Service, userService user.Service) gin.HandlerFu
 
 		accessToken := strings.Split(authHeader, " ")[1]
 
+		if strings.HasPrefix(accessToken, auth.APIKeyPrefix) {
+			authorizeAPIKey(c, authService, userService, accessToken, scopes)
+
+			return
+		}
+
 		validatedToken, err := authService.ValidateToken(accessToken)
 
 		if err != nil || !validatedToken.Valid {
@@ -137,18 +375,26 @@ func authorize(authService auth.Service, userService user.Service) gin.HandlerFu
 			return
 		}
 
-		claims, ok := validatedToken.Claims.(jwt.MapClaims)
+		claims, err := authService.GetAccessClaims(validatedToken)
 
-		if !ok {
+		if err != nil {
 			data := helpers.APIResponse("Missing or invalid access token.", http.StatusUnauthorized, "error", gin.H{"error": errors.New("Access token is either missing or invalid.")})
 			c.AbortWithStatusJSON(http.StatusUnauthorized, data)
 
 			return
 		}
 
-		userID := int(claims["user_id"].(float64))
+		// Logged out tokens stay cryptographically valid until they expire
+		isRevoked, err := authService.IsTokenRevoked(claims)
 
-		user, err := userService.GetUserByID(userID)
+		if err != nil || isRevoked {
+			data := helpers.APIResponse("Missing or invalid access token.", http.StatusUnauthorized, "error", gin.H{"error": errors.New("Access token has been revoked.")})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, data)
+
+			return
+		}
+
+		user, err := userService.GetUserByID(claims.UserID)
 
 		if err != nil {
 			data := helpers.APIResponse("Missing or invalid access token.", http.StatusUnauthorized, "error", gin.H{"error": errors.New("Access token is either missing or invalid.")})
@@ -158,5 +404,142 @@ func authorize(authService auth.Service, userService user.Service) gin.HandlerFu
 		}
 
 		c.Set("authUser", user)
+		c.Set("authClaims", claims)
+	}
+}
+
+// authorizeAPIKey sets authUser and authAPIKey, there are no access claims so handlers that need them must not declare scopes
+func authorizeAPIKey(c *gin.Context, authService auth.Service, userService user.Service, key string, scopes []string) {
+	if len(scopes) == 0 {
+		data := helpers.APIResponse("API key tidak dapat digunakan untuk endpoint ini", http.StatusForbidden, "forbidden", nil)
+		c.AbortWithStatusJSON(http.StatusForbidden, data)
+
+		return
+	}
+
+	apiKey, err := authService.AuthenticateAPIKey(key)
+
+	if err != nil {
+		data := helpers.APIResponse("Missing or invalid API key.", http.StatusUnauthorized, "error", gin.H{"error": auth.ErrInvalidAPIKey.Error()})
+		c.AbortWithStatusJSON(http.StatusUnauthorized, data)
+
+		return
 	}
+
+	if !apiKey.HasScope(scopes...) {
+		data := helpers.APIResponse("API key tidak memiliki scope untuk endpoint ini", http.StatusForbidden, "forbidden", gin.H{"required_scopes": scopes})
+		c.AbortWithStatusJSON(http.StatusForbidden, data)
+
+		return
+	}
+
+	user, err := userService.GetUserByID(apiKey.UserID)
+
+	if err != nil || user.ID <= 0 {
+		data := helpers.APIResponse("Missing or invalid API key.", http.StatusUnauthorized, "error", gin.H{"error": auth.ErrInvalidAPIKey.Error()})
+		c.AbortWithStatusJSON(http.StatusUnauthorized, data)
+
+		return
+	}
+
+	c.Set("authUser", user)
+	c.Set("authAPIKey", apiKey)
+}
+
+// requirePermission lets the request through when one of the authorized user's roles grants the permission, it must come after authorize
+func requirePermission(permission user.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser := c.MustGet("authUser").(user.User)
+
+		// HasPermission is false for them as well, this only tells them why
+		if authUser.MissingRequiredTwoFactor() {
+			data := helpers.APIResponse("Aktifkan autentikasi dua langkah untuk mengakses endpoint ini", http.StatusForbidden, "two-factor-required", nil)
+			c.AbortWithStatusJSON(http.StatusForbidden, data)
+
+			return
+		}
+
+		if !authUser.HasPermission(permission) {
+			data := helpers.APIResponse("Anda tidak punya wewenang untuk mengakses endpoint ini", http.StatusForbidden, "forbidden", nil)
+			c.AbortWithStatusJSON(http.StatusForbidden, data)
+
+			return
+		}
+	}
+}
+
+// requireVerifiedEmail keeps unverified accounts from creating or backing campaigns, it must come after authorize
+func requireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser := c.MustGet("authUser").(user.User)
+
+		if !authUser.IsEmailVerified() {
+			data := helpers.APIResponse("Silakan verifikasi email anda terlebih dahulu", http.StatusForbidden, "unverified", nil)
+			c.AbortWithStatusJSON(http.StatusForbidden, data)
+
+			return
+		}
+	}
+}
+
+// rateLimit rejects requests once the bucket of the key returned by keyFunc is empty, an empty key skips the limit
+func rateLimit(store ratelimit.Store, scope string, rule ratelimit.Rule, keyFunc func(c *gin.Context) string) gin.HandlerFunc {
+	limiter := ratelimit.NewLimiter(store, rule)
+
+	return func(c *gin.Context) {
+		key := keyFunc(c)
+
+		if key == "" {
+			return
+		}
+
+		result, err := limiter.Allow(scope + ":" + key)
+
+		if err != nil {
+			// The limiter is a safeguard, a broken store shouldn't take the endpoint down with it
+			log.Printf("Rate limit: %v\n", err)
+
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(result.ResetAt.Unix(), 10))
+
+		if !result.Allowed {
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			data := helpers.APIResponse("Terlalu banyak permintaan, coba lagi nanti", http.StatusTooManyRequests, "error", gin.H{"retry_after": retryAfter})
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, data)
+
+			return
+		}
+	}
+}
+
+// byIP keys on the client address, see helpers.ClientIP for the proxies it trusts
+func byIP(c *gin.Context) string {
+	return "ip:" + helpers.ClientIP(c)
+}
+
+// byAccount keys on the logged in user, or on the email in the JSON body for requests made before logging in
+func byAccount(c *gin.Context) string {
+	if authUser, ok := c.Get("authUser"); ok {
+		return "user:" + strconv.Itoa(authUser.(user.User).ID)
+	}
+
+	var body struct {
+		Email string `json:"email"`
+	}
+
+	// The body is put back so the handler can still bind it
+	rawBody, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20))
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(rawBody))
+
+	if err != nil || json.Unmarshal(rawBody, &body) != nil || body.Email == "" {
+		return ""
+	}
+
+	return "email:" + strings.ToLower(strings.TrimSpace(body.Email))
 }
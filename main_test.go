@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bwastartup/auth"
+	"bwastartup/entities/user"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyAuthService knows a single API key
+type apiKeyAuthService struct {
+	auth.Service
+	key    string
+	apiKey auth.APIKey
+}
+
+func (s *apiKeyAuthService) AuthenticateAPIKey(key string) (auth.APIKey, error) {
+	if key != s.key {
+		return auth.APIKey{}, auth.ErrInvalidAPIKey
+	}
+
+	return s.apiKey, nil
+}
+
+// staffUserService returns an admin for every ID, API keys must not get to use that
+type staffUserService struct {
+	user.Service
+}
+
+func (s *staffUserService) GetUserByID(ID int) (user.User, error) {
+	return user.User{ID: ID, Role: user.RoleAdmin}, nil
+}
+
+func TestAuthorizeAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	authService := &apiKeyAuthService{
+		key:    auth.APIKeyPrefix + "abcd1234_secret",
+		apiKey: auth.APIKey{ID: 1, UserID: 7, Scopes: auth.ScopeCampaignsRead},
+	}
+	userService := &staffUserService{}
+
+	router := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	router.GET("/campaigns", authorize(authService, userService, auth.ScopeCampaignsRead), ok)
+	router.POST("/campaigns", authorize(authService, userService, auth.ScopeCampaignsWrite), ok)
+	router.GET("/api-keys", authorize(authService, userService), ok)
+	router.GET("/transactions", authorize(authService, userService), requirePermission(user.PermissionViewAllTransactions), ok)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		key      string
+		wantCode int
+	}{
+		{"granted scope", http.MethodGet, "/campaigns", authService.key, http.StatusOK},
+		{"scope the key wasn't granted", http.MethodPost, "/campaigns", authService.key, http.StatusForbidden},
+		{"route without scopes", http.MethodGet, "/api-keys", authService.key, http.StatusForbidden},
+		{"staff route of an admin's key", http.MethodGet, "/transactions", authService.key, http.StatusForbidden},
+		{"unknown key", http.MethodGet, "/campaigns", auth.APIKeyPrefix + "abcd1234_guess", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		request := httptest.NewRequest(tt.method, tt.path, nil)
+		request.Header.Set("Authorization", "Bearer "+tt.key)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != tt.wantCode {
+			t.Errorf("%s: %s %s responded %d, want %d", tt.name, tt.method, tt.path, recorder.Code, tt.wantCode)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS transaction_status_histories (
+	id SERIAL PRIMARY KEY,
+	transaction_id INTEGER NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+	old_status VARCHAR(32) NOT NULL,
+	new_status VARCHAR(32) NOT NULL,
+	actor VARCHAR(16) NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS transaction_status_histories_transaction_id_idx ON transaction_status_histories (transaction_id);
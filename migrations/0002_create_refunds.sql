@@ -0,0 +1,13 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS refunded_amount INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS refunds (
+	id SERIAL PRIMARY KEY,
+	transaction_id INTEGER NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users (id),
+	amount INTEGER NOT NULL CHECK (amount > 0),
+	reason TEXT NOT NULL,
+	refund_key VARCHAR(64) NOT NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refunds_transaction_id_idx ON refunds (transaction_id);
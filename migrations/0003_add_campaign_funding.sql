@@ -0,0 +1,7 @@
+ALTER TABLE campaigns
+	ADD COLUMN IF NOT EXISTS funding_model VARCHAR(32) NOT NULL DEFAULT 'keep_it_all',
+	ADD COLUMN IF NOT EXISTS funding_status VARCHAR(32) NOT NULL DEFAULT 'active',
+	ADD COLUMN IF NOT EXISTS starts_at TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS ends_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS campaigns_funding_status_ends_at_idx ON campaigns (funding_status, ends_at);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS campaign_rewards (
+	id SERIAL PRIMARY KEY,
+	campaign_id INTEGER NOT NULL REFERENCES campaigns (id) ON DELETE CASCADE,
+	title VARCHAR(255) NOT NULL,
+	description TEXT NOT NULL,
+	minimum_amount INTEGER NOT NULL CHECK (minimum_amount > 0),
+	quantity INTEGER CHECK (quantity > 0),
+	claimed_count INTEGER NOT NULL DEFAULT 0 CHECK (claimed_count >= 0),
+	estimated_delivery_at TIMESTAMP,
+	requires_shipping BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	CHECK (quantity IS NULL OR claimed_count <= quantity)
+);
+
+CREATE INDEX IF NOT EXISTS campaign_rewards_campaign_id_idx ON campaign_rewards (campaign_id);
+
+ALTER TABLE transactions
+	ADD COLUMN IF NOT EXISTS reward_id INTEGER REFERENCES campaign_rewards (id),
+	ADD COLUMN IF NOT EXISTS shipping_address TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+
+CREATE INDEX IF NOT EXISTS campaigns_search_vector_idx ON campaigns USING GIN (search_vector);
+
+-- Existing campaigns, new and updated ones are indexed by the campaign repository
+UPDATE campaigns SET search_vector =
+	setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce(highlight, '')), 'B') ||
+	setweight(to_tsvector('simple', coalesce(description, '')), 'C');
@@ -0,0 +1,14 @@
+-- Older campaigns could share a slug, keep the oldest one as is and suffix the others with their id
+UPDATE campaigns SET slug = slug || '-' || id
+WHERE id NOT IN (SELECT MIN(id) FROM campaigns GROUP BY slug);
+
+CREATE UNIQUE INDEX IF NOT EXISTS campaigns_slug_idx ON campaigns (slug);
+
+CREATE TABLE IF NOT EXISTS campaign_slug_redirects (
+	id SERIAL PRIMARY KEY,
+	campaign_id INTEGER NOT NULL REFERENCES campaigns (id) ON DELETE CASCADE,
+	slug VARCHAR(255) NOT NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS campaign_slug_redirects_campaign_id_idx ON campaign_slug_redirects (campaign_id);
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	family_id VARCHAR(64) NOT NULL,
+	token_hash VARCHAR(64) NOT NULL UNIQUE,
+	access_token_jti VARCHAR(64) NOT NULL DEFAULT '',
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP,
+	replaced_by_id INTEGER REFERENCES refresh_tokens (id),
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- Rows past expires_at can be deleted at any time, the access token they block is expired as well
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti VARCHAR(64) PRIMARY KEY,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
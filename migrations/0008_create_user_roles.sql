@@ -0,0 +1,9 @@
+-- users.role stays the role an account registered with, additional roles are granted here
+CREATE TABLE IF NOT EXISTS user_roles (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	role VARCHAR(32) NOT NULL CHECK (role IN ('user', 'creator', 'moderator', 'admin', 'finance')),
+	granted_by_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	UNIQUE (user_id, role)
+);
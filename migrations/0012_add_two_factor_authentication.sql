@@ -0,0 +1,13 @@
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS two_factor_secret TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS two_factor_enabled_at TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS two_factor_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS backup_codes (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	code_hash VARCHAR(64) NOT NULL,
+	used_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	UNIQUE (user_id, code_hash)
+);
@@ -0,0 +1,6 @@
+-- Images uploaded before renditions existed keep only the full size, the formatters fall back to it
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_card VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_thumbnail VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE campaign_images ADD COLUMN IF NOT EXISTS card_filename VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE campaign_images ADD COLUMN IF NOT EXISTS thumbnail_filename VARCHAR(255) NOT NULL DEFAULT '';
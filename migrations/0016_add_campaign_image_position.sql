@@ -0,0 +1,11 @@
+ALTER TABLE campaign_images ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0;
+
+-- Existing images keep their upload order
+UPDATE campaign_images SET position = ordered.position
+FROM (
+	SELECT id, ROW_NUMBER() OVER (PARTITION BY campaign_id ORDER BY id) - 1 AS position
+	FROM campaign_images
+) AS ordered
+WHERE campaign_images.id = ordered.id;
+
+CREATE INDEX IF NOT EXISTS campaign_images_campaign_id_position_idx ON campaign_images (campaign_id, position);
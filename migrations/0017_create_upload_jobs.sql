@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS upload_jobs (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	campaign_id INTEGER NOT NULL REFERENCES campaigns (id) ON DELETE CASCADE,
+	cover_index INTEGER NOT NULL DEFAULT -1,
+	status VARCHAR(16) NOT NULL DEFAULT 'pending',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS upload_jobs_status_idx ON upload_jobs (status);
+
+CREATE TABLE IF NOT EXISTS upload_files (
+	id SERIAL PRIMARY KEY,
+	upload_job_id INTEGER NOT NULL REFERENCES upload_jobs (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	staging_key VARCHAR(255) NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'pending',
+	error TEXT NOT NULL DEFAULT '',
+	campaign_image_id INTEGER REFERENCES campaign_images (id) ON DELETE SET NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS upload_files_upload_job_id_idx ON upload_files (upload_job_id);
@@ -0,0 +1,20 @@
+-- Campaigns created before the review workflow were already public
+ALTER TABLE campaigns
+	ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'published';
+
+ALTER TABLE campaigns
+	ALTER COLUMN status SET DEFAULT 'draft';
+
+CREATE INDEX IF NOT EXISTS campaigns_status_idx ON campaigns (status);
+
+CREATE TABLE IF NOT EXISTS campaign_status_histories (
+	id SERIAL PRIMARY KEY,
+	campaign_id INTEGER NOT NULL REFERENCES campaigns (id) ON DELETE CASCADE,
+	old_status VARCHAR(16) NOT NULL,
+	new_status VARCHAR(16) NOT NULL,
+	user_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+	notes TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS campaign_status_histories_campaign_id_idx ON campaign_status_histories (campaign_id);
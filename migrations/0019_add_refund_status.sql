@@ -0,0 +1,8 @@
+-- Refunds stored before this migration were all paid out already
+ALTER TABLE refunds
+	ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'completed';
+
+ALTER TABLE refunds
+	ALTER COLUMN status SET DEFAULT 'pending';
+
+CREATE INDEX IF NOT EXISTS refunds_transaction_id_status_idx ON refunds (transaction_id, status);
@@ -0,0 +1,5 @@
+-- An upload file gets at most one image, retried upload jobs find the image stored the first time
+ALTER TABLE campaign_images
+	ADD COLUMN IF NOT EXISTS upload_file_id INTEGER REFERENCES upload_files (id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS campaign_images_upload_file_id_idx ON campaign_images (upload_file_id);
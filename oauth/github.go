@@ -0,0 +1,89 @@
+package oauth
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type githubProvider struct {
+	config    Config
+	emailsURL string
+}
+
+// NewGitHubProvider logs in with GitHub's OAuth apps, emailsURL defaults to the API next to UserInfoURL
+func NewGitHubProvider(config Config, emailsURL string) Provider {
+	if config.AuthURL == "" {
+		config.AuthURL = "https://github.com/login/oauth/authorize"
+	}
+
+	if config.TokenURL == "" {
+		config.TokenURL = "https://github.com/login/oauth/access_token"
+	}
+
+	if config.UserInfoURL == "" {
+		config.UserInfoURL = "https://api.github.com/user"
+	}
+
+	if emailsURL == "" {
+		emailsURL = strings.TrimSuffix(config.UserInfoURL, "/") + "/emails"
+	}
+
+	return &githubProvider{config, emailsURL}
+}
+
+func (p *githubProvider) Name() string {
+	return "github"
+}
+
+func (p *githubProvider) AuthCodeURL(state string) string {
+	return authCodeURL(p.config, "read:user user:email", state)
+}
+
+func (p *githubProvider) Exchange(code string) (Identity, error) {
+	accessToken, err := exchangeCode(p.config, code)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var profile struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+
+	if err := getJSON(p.config.UserInfoURL, accessToken, &profile); err != nil {
+		return Identity{}, err
+	}
+
+	if profile.ID == 0 {
+		return Identity{}, errors.New("GitHub did not return a user ID")
+	}
+
+	// The profile email is whatever the user made public, the primary one and whether it's verified only come from here
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+
+	if err := getJSON(p.emailsURL, accessToken, &emails); err != nil {
+		return Identity{}, err
+	}
+
+	identity := Identity{Provider: p.Name(), Subject: strconv.FormatInt(profile.ID, 10), Name: profile.Name}
+
+	if identity.Name == "" {
+		identity.Name = profile.Login
+	}
+
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+type googleProvider struct {
+	config Config
+}
+
+// NewGoogleProvider logs in with Google's OpenID Connect, the identity comes from the userinfo endpoint
+func NewGoogleProvider(config Config) Provider {
+	if config.AuthURL == "" {
+		config.AuthURL = "https://accounts.google.com/o/oauth2/v2/auth"
+	}
+
+	if config.TokenURL == "" {
+		config.TokenURL = "https://oauth2.googleapis.com/token"
+	}
+
+	if config.UserInfoURL == "" {
+		config.UserInfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+	}
+
+	return &googleProvider{config}
+}
+
+func (p *googleProvider) Name() string {
+	return "google"
+}
+
+func (p *googleProvider) AuthCodeURL(state string) string {
+	return authCodeURL(p.config, "openid email profile", state)
+}
+
+func (p *googleProvider) Exchange(code string) (Identity, error) {
+	accessToken, err := exchangeCode(p.config, code)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var userInfo struct {
+		Subject string `json:"sub"`
+		Email   string `json:"email"`
+		// Usually a boolean, some IdPs send it as a string
+		EmailVerified json.RawMessage `json:"email_verified"`
+		Name          string          `json:"name"`
+	}
+
+	if err := getJSON(p.config.UserInfoURL, accessToken, &userInfo); err != nil {
+		return Identity{}, err
+	}
+
+	if userInfo.Subject == "" {
+		return Identity{}, errors.New("Google did not return a subject")
+	}
+
+	return Identity{
+		Provider:      p.Name(),
+		Subject:       userInfo.Subject,
+		Email:         userInfo.Email,
+		EmailVerified: string(userInfo.EmailVerified) == "true" || string(userInfo.EmailVerified) == `"true"`,
+		Name:          userInfo.Name,
+	}, nil
+}
@@ -0,0 +1,132 @@
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Identity is who the provider says the user is
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type Provider interface {
+	Name() string
+	AuthCodeURL(state string) string
+	// Exchange trades the authorization code from the callback for the user's identity
+	Exchange(code string) (Identity, error)
+}
+
+// Config holds the client credentials, the endpoints only need to be set to point at something else than the real provider
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+func authCodeURL(config Config, scope string, state string) string {
+	query := url.Values{}
+	query.Set("client_id", config.ClientID)
+	query.Set("redirect_uri", config.RedirectURL)
+	query.Set("response_type", "code")
+	query.Set("scope", scope)
+	query.Set("state", state)
+
+	separator := "?"
+
+	if strings.Contains(config.AuthURL, "?") {
+		separator = "&"
+	}
+
+	return config.AuthURL + separator + query.Encode()
+}
+
+// exchangeCode runs the authorization code grant and returns the access token
+func exchangeCode(config Config, code string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", config.RedirectURL)
+	form.Set("client_id", config.ClientID)
+	form.Set("client_secret", config.ClientSecret)
+
+	req, err := http.NewRequest(http.MethodPost, config.TokenURL, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers with a form encoded body unless asked for JSON
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := doJSON(req, &token); err != nil {
+		return "", err
+	}
+
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("Token exchange failed: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	return token.AccessToken, nil
+}
+
+func getJSON(endpoint string, accessToken string, target interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	return doJSON(req, target)
+}
+
+func doJSON(req *http.Request, target interface{}) error {
+	res, err := httpClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+
+	if err != nil {
+		return err
+	}
+
+	// Token errors come back as 400 with a JSON body, let the caller look at them
+	if res.StatusCode >= 500 || (res.StatusCode >= 300 && res.StatusCode != http.StatusBadRequest && res.StatusCode != http.StatusUnauthorized) {
+		return fmt.Errorf("%s %s returned %d", req.Method, req.URL.Host, res.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("Unable to read response from %s: %v", req.URL.Host, err)
+	}
+
+	return nil
+}
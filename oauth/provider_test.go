@@ -0,0 +1,174 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newMockIdP answers the token endpoint for the code "good-code" and the profile endpoints for the token it hands out
+func newMockIdP(t *testing.T, userInfo interface{}, emails interface{}) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("token request isn't a form: %v", err)
+		}
+
+		if r.Method != http.MethodPost || r.PostForm.Get("grant_type") != "authorization_code" {
+			t.Errorf("token request is %s with grant type %q", r.Method, r.PostForm.Get("grant_type"))
+		}
+
+		if r.PostForm.Get("code") != "good-code" || r.PostForm.Get("client_secret") != "client-secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "Bad code"})
+
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "idp-token", "token_type": "bearer"})
+	})
+
+	profileHandler := func(response interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer idp-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{}`))
+
+				return
+			}
+
+			json.NewEncoder(w).Encode(response)
+		}
+	}
+
+	mux.HandleFunc("/userinfo", profileHandler(userInfo))
+	mux.HandleFunc("/userinfo/emails", profileHandler(emails))
+
+	return httptest.NewServer(mux)
+}
+
+func mockConfig(server *httptest.Server) Config {
+	return Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost/callback",
+		AuthURL:      server.URL + "/authorize",
+		TokenURL:     server.URL + "/token",
+		UserInfoURL:  server.URL + "/userinfo",
+	}
+}
+
+func TestGoogleExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		userInfo map[string]interface{}
+		want     Identity
+		wantErr  bool
+	}{
+		{
+			"verified email",
+			map[string]interface{}{"sub": "123", "email": "user@example.com", "email_verified": true, "name": "User"},
+			Identity{Provider: "google", Subject: "123", Email: "user@example.com", EmailVerified: true, Name: "User"},
+			false,
+		},
+		{
+			"verified email sent as a string",
+			map[string]interface{}{"sub": "123", "email": "user@example.com", "email_verified": "true"},
+			Identity{Provider: "google", Subject: "123", Email: "user@example.com", EmailVerified: true},
+			false,
+		},
+		{
+			"unverified email",
+			map[string]interface{}{"sub": "123", "email": "user@example.com", "email_verified": false},
+			Identity{Provider: "google", Subject: "123", Email: "user@example.com"},
+			false,
+		},
+		{"no subject", map[string]interface{}{"email": "user@example.com", "email_verified": true}, Identity{}, true},
+	}
+
+	for _, tt := range tests {
+		server := newMockIdP(t, tt.userInfo, nil)
+
+		identity, err := NewGoogleProvider(mockConfig(server)).Exchange("good-code")
+
+		server.Close()
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Exchange returned %v", tt.name, err)
+
+			continue
+		}
+
+		if identity != tt.want {
+			t.Errorf("%s: Exchange = %+v, want %+v", tt.name, identity, tt.want)
+		}
+	}
+}
+
+func TestGitHubExchange(t *testing.T) {
+	profile := map[string]interface{}{"id": 42, "login": "octocat", "name": ""}
+
+	tests := []struct {
+		name    string
+		profile map[string]interface{}
+		emails  []map[string]interface{}
+		want    Identity
+		wantErr bool
+	}{
+		{
+			"verified primary email",
+			profile,
+			[]map[string]interface{}{
+				{"email": "other@example.com", "primary": false, "verified": true},
+				{"email": "octocat@example.com", "primary": true, "verified": true},
+			},
+			Identity{Provider: "github", Subject: "42", Email: "octocat@example.com", EmailVerified: true, Name: "octocat"},
+			false,
+		},
+		{
+			// A verified secondary email doesn't make the primary one verified
+			"unverified primary email",
+			profile,
+			[]map[string]interface{}{
+				{"email": "octocat@example.com", "primary": true, "verified": false},
+				{"email": "other@example.com", "primary": false, "verified": true},
+			},
+			Identity{Provider: "github", Subject: "42", Email: "octocat@example.com", Name: "octocat"},
+			false,
+		},
+		{"no user ID", map[string]interface{}{"login": "octocat"}, nil, Identity{}, true},
+	}
+
+	for _, tt := range tests {
+		server := newMockIdP(t, tt.profile, tt.emails)
+
+		identity, err := NewGitHubProvider(mockConfig(server), "").Exchange("good-code")
+
+		server.Close()
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Exchange returned %v", tt.name, err)
+
+			continue
+		}
+
+		if identity != tt.want {
+			t.Errorf("%s: Exchange = %+v, want %+v", tt.name, identity, tt.want)
+		}
+	}
+}
+
+func TestExchangeRejectsBadCodes(t *testing.T) {
+	server := newMockIdP(t, map[string]interface{}{"sub": "123"}, nil)
+	defer server.Close()
+
+	providers := []Provider{NewGoogleProvider(mockConfig(server)), NewGitHubProvider(mockConfig(server), "")}
+
+	for _, provider := range providers {
+		if _, err := provider.Exchange("stolen-code"); err == nil {
+			t.Errorf("%s: Exchange with a bad code returned no error", provider.Name())
+		}
+	}
+}
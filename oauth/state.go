@@ -0,0 +1,63 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dchest/uniuri"
+)
+
+var ErrInvalidState = errors.New("Invalid or expired OAuth state")
+
+// stateTTL is how long the user has to finish logging in at the provider
+const stateTTL = 10 * time.Minute
+
+// NewState returns a signed state for the provider and the nonce it carries, the nonce is also kept
+// in a cookie so the callback can only be completed by the browser that started the login
+func NewState(provider string, secret []byte) (string, string) {
+	nonce := uniuri.NewLen(32)
+	payload := provider + "|" + nonce + "|" + strconv.FormatInt(time.Now().Add(stateTTL).Unix(), 10)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + signState(payload, secret), nonce
+}
+
+func VerifyState(state string, provider string, nonce string, secret []byte) error {
+	parts := strings.SplitN(state, ".", 2)
+
+	if len(parts) != 2 {
+		return ErrInvalidState
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil || !hmac.Equal([]byte(signState(string(payload), secret)), []byte(parts[1])) {
+		return ErrInvalidState
+	}
+
+	fields := strings.Split(string(payload), "|")
+
+	if len(fields) != 3 || fields[0] != provider || nonce == "" || !hmac.Equal([]byte(fields[1]), []byte(nonce)) {
+		return ErrInvalidState
+	}
+
+	expires, err := strconv.ParseInt(fields[2], 10, 64)
+
+	if err != nil || time.Now().Unix() > expires {
+		return ErrInvalidState
+	}
+
+	return nil
+}
+
+func signState(payload string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,66 @@
+package oauth
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyState(t *testing.T) {
+	secret := []byte("state-secret")
+	state, nonce := NewState("google", secret)
+
+	// forged signs a payload of our own with the real secret, as if it had leaked out of NewState
+	forged := func(payload string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + signState(payload, secret)
+	}
+
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	parts := strings.SplitN(state, ".", 2)
+
+	tests := []struct {
+		name     string
+		state    string
+		provider string
+		nonce    string
+		secret   []byte
+		wantErr  bool
+	}{
+		{"valid", state, "google", nonce, secret, false},
+		{"another provider", state, "github", nonce, secret, true},
+		{"another browser", state, "google", "another-nonce", secret, true},
+		{"no nonce cookie", state, "google", "", secret, true},
+		{"another secret", state, "google", nonce, []byte("another-secret"), true},
+		{"tampered payload", base64.RawURLEncoding.EncodeToString([]byte("github|"+nonce+"|9999999999")) + "." + parts[1], "github", nonce, secret, true},
+		{"tampered signature", parts[0] + "." + strings.Repeat("0", len(parts[1])), "google", nonce, secret, true},
+		{"expired", forged("google|" + nonce + "|" + expired), "google", nonce, secret, true},
+		{"malformed expiry", forged("google|" + nonce + "|soon"), "google", nonce, secret, true},
+		{"missing fields", forged("google|" + nonce), "google", nonce, secret, true},
+		{"no signature", parts[0], "google", nonce, secret, true},
+		{"not base64", "!!!." + parts[1], "google", nonce, secret, true},
+		{"empty", "", "google", nonce, secret, true},
+	}
+
+	for _, tt := range tests {
+		err := VerifyState(tt.state, tt.provider, tt.nonce, tt.secret)
+
+		if tt.wantErr && err != ErrInvalidState {
+			t.Errorf("%s: VerifyState returned %v, want ErrInvalidState", tt.name, err)
+		}
+
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: VerifyState returned %v", tt.name, err)
+		}
+	}
+}
+
+func TestNewStateIsUnique(t *testing.T) {
+	first, firstNonce := NewState("google", []byte("state-secret"))
+	second, secondNonce := NewState("google", []byte("state-secret"))
+
+	if first == second || firstNonce == secondNonce {
+		t.Error("NewState returned the same state twice")
+	}
+}
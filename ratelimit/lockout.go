@@ -0,0 +1,67 @@
+package ratelimit
+
+import "time"
+
+// Lockout blocks a key after repeated attempts that didn't succeed, every attempt past the threshold doubles the
+// wait up to maxDelay
+type Lockout struct {
+	store     Store
+	threshold int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	window    time.Duration
+}
+
+// NewLockout forgets the attempts of a key once window passes without a new one
+func NewLockout(store Store, threshold int, baseDelay time.Duration, maxDelay time.Duration, window time.Duration) *Lockout {
+	return &Lockout{store, threshold, baseDelay, maxDelay, window}
+}
+
+// Attempt records an attempt unless the key is locked and returns how long the lock lasts, zero means the attempt
+// may go ahead. Every attempt counts until Succeed, checking and counting in one store operation keeps concurrent
+// attempts from all getting in before the lock
+func (l *Lockout) Attempt(key string) (time.Duration, error) {
+	now := time.Now()
+
+	counter, counted, err := l.store.IncrementUnless(l.storeKey(key), l.window, now, func(counter Counter) bool {
+		return l.remaining(counter, now) > 0
+	})
+
+	if err != nil || counted {
+		return 0, err
+	}
+
+	return l.remaining(counter, now), nil
+}
+
+func (l *Lockout) Succeed(key string) error {
+	return l.store.Reset(l.storeKey(key))
+}
+
+func (l *Lockout) remaining(counter Counter, now time.Time) time.Duration {
+	if counter.Count < l.threshold {
+		return 0
+	}
+
+	delay := l.baseDelay
+
+	for i := l.threshold; i < counter.Count && delay < l.maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > l.maxDelay {
+		delay = l.maxDelay
+	}
+
+	remaining := counter.LastAt.Add(delay).Sub(now)
+
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+func (l *Lockout) storeKey(key string) string {
+	return "lockout:" + key
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLockoutRemaining(t *testing.T) {
+	lockout := NewLockout(NewMemoryStore(), 3, time.Second, 10*time.Second, time.Hour)
+	now := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name   string
+		count  int
+		lastAt time.Time
+		want   time.Duration
+	}{
+		{"no failures", 0, now, 0},
+		{"below the threshold", 2, now, 0},
+		{"at the threshold", 3, now, time.Second},
+		{"one past the threshold doubles", 4, now, 2 * time.Second},
+		{"two past the threshold doubles twice", 5, now, 4 * time.Second},
+		{"three past the threshold doubles three times", 6, now, 8 * time.Second},
+		{"capped at the maximum delay", 7, now, 10 * time.Second},
+		{"stays at the maximum delay", 50, now, 10 * time.Second},
+		{"counts down from the last failure", 5, now.Add(-3 * time.Second), time.Second},
+		{"elapsed lock", 5, now.Add(-time.Minute), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lockout.remaining(Counter{Count: tt.count, LastAt: tt.lastAt}, now)
+
+			if got != tt.want {
+				t.Errorf("remaining(%d failures) = %v, want %v", tt.count, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockoutAttemptAndSucceed(t *testing.T) {
+	lockout := NewLockout(NewMemoryStore(), 2, time.Hour, time.Hour, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if delay, err := lockout.Attempt("user@example.com"); err != nil || delay != 0 {
+			t.Fatalf("attempt %d = (%v, %v), want no lock", i+1, delay, err)
+		}
+	}
+
+	if delay, err := lockout.Attempt("user@example.com"); err != nil || delay <= 0 {
+		t.Errorf("attempt past the threshold = (%v, %v), want a lock", delay, err)
+	}
+
+	if delay, err := lockout.Attempt("other@example.com"); err != nil || delay != 0 {
+		t.Errorf("attempt for another key = (%v, %v), want no lock", delay, err)
+	}
+
+	if err := lockout.Succeed("user@example.com"); err != nil {
+		t.Fatalf("Succeed returned error: %v", err)
+	}
+
+	if delay, err := lockout.Attempt("user@example.com"); err != nil || delay != 0 {
+		t.Errorf("attempt after Succeed = (%v, %v), want no lock", delay, err)
+	}
+}
+
+func TestLockoutConcurrentAttempts(t *testing.T) {
+	lockout := NewLockout(NewMemoryStore(), 5, time.Hour, time.Hour, time.Hour)
+
+	var wg sync.WaitGroup
+	var allowed int32
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if delay, err := lockout.Attempt("user@example.com"); err == nil && delay == 0 {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if allowed != 5 {
+		t.Errorf("%d concurrent attempts got in, want 5", allowed)
+	}
+}
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+type counter struct {
+	Counter
+	expiresAt time.Time
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	counters  map[string]*counter
+	lastSweep time.Time
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: map[string]*bucket{}, counters: map[string]*counter{}}
+}
+
+func (s *memoryStore) Take(key string, rule Rule, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	limit := float64(rule.Limit)
+	refillRate := limit / rule.Per.Seconds()
+
+	b, ok := s.buckets[key]
+
+	if !ok {
+		b = &bucket{tokens: limit, updatedAt: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(limit, b.tokens+now.Sub(b.updatedAt).Seconds()*refillRate)
+	b.updatedAt = now
+
+	result := Result{Limit: rule.Limit}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) / refillRate * float64(time.Second))
+	}
+
+	b.fullAt = now.Add(time.Duration((limit - b.tokens) / refillRate * float64(time.Second)))
+	result.Remaining = int(b.tokens)
+	result.ResetAt = b.fullAt
+
+	return result, nil
+}
+
+func (s *memoryStore) IncrementUnless(key string, ttl time.Duration, now time.Time, blocked func(Counter) bool) (Counter, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	c, ok := s.counters[key]
+
+	if !ok || !now.Before(c.expiresAt) {
+		c = &counter{}
+	}
+
+	if blocked != nil && blocked(c.Counter) {
+		return c.Counter, false, nil
+	}
+
+	c.Count++
+	c.LastAt = now
+	c.expiresAt = now.Add(ttl)
+	s.counters[key] = c
+
+	return c.Counter, true, nil
+}
+
+func (s *memoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.buckets, key)
+	delete(s.counters, key)
+
+	return nil
+}
+
+// sweep drops full buckets and expired counters once a minute so the maps don't grow with every client ever seen
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if !now.Before(b.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+
+	for key, c := range s.counters {
+		if !now.Before(c.expiresAt) {
+			delete(s.counters, key)
+		}
+	}
+}
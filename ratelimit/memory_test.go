@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	rule := Rule{Limit: 3, Per: 30 * time.Second}
+
+	tests := []struct {
+		name          string
+		after         time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{"first request of the burst", 0, true, 2, 0},
+		{"second request of the burst", 0, true, 1, 0},
+		{"last request of the burst", 0, true, 0, 0},
+		{"burst used up", 0, false, 0, 10 * time.Second},
+		{"half a token refilled", 5 * time.Second, false, 0, 5 * time.Second},
+		{"one token refilled", 10 * time.Second, true, 0, 0},
+		{"bucket refilled to its limit only", 5 * time.Minute, true, 2, 0},
+	}
+
+	store := NewMemoryStore()
+
+	// The cases share the bucket, each one runs against what the previous ones left
+	for _, tt := range tests {
+		result, err := store.Take("key", rule, start.Add(tt.after))
+
+		if err != nil {
+			t.Fatalf("%s: Take returned error: %v", tt.name, err)
+		}
+
+		if result.Allowed != tt.wantAllowed || result.Remaining != tt.wantRemaining || result.RetryAfter != tt.wantRetry {
+			t.Errorf("%s: Take = (allowed %v, remaining %d, retry after %v), want (%v, %d, %v)", tt.name, result.Allowed, result.Remaining, result.RetryAfter, tt.wantAllowed, tt.wantRemaining, tt.wantRetry)
+		}
+
+		if result.Limit != rule.Limit {
+			t.Errorf("%s: Take limit = %d, want %d", tt.name, result.Limit, rule.Limit)
+		}
+	}
+}
+
+func TestMemoryStoreKeysAreIndependent(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	rule := Rule{Limit: 1, Per: time.Minute}
+	store := NewMemoryStore()
+
+	if result, _ := store.Take("a", rule, now); !result.Allowed {
+		t.Fatal("first request for a was refused")
+	}
+
+	if result, _ := store.Take("a", rule, now); result.Allowed {
+		t.Error("second request for a was allowed")
+	}
+
+	if result, _ := store.Take("b", rule, now); !result.Allowed {
+		t.Error("first request for b was refused because of a")
+	}
+
+	if err := store.Reset("a"); err != nil {
+		t.Fatalf("Reset returned error: %v", err)
+	}
+
+	if result, _ := store.Take("a", rule, now); !result.Allowed {
+		t.Error("request for a was refused after a reset")
+	}
+}
+
+func TestMemoryStoreIncrementUnless(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	ttl := time.Minute
+
+	// Counters of three or more are blocked
+	blocked := func(counter Counter) bool { return counter.Count >= 3 }
+
+	tests := []struct {
+		name        string
+		after       time.Duration
+		wantCount   int
+		wantCounted bool
+	}{
+		{"first attempt", 0, 1, true},
+		{"second attempt", 30 * time.Second, 2, true},
+		{"ttl counts from the last increment", 80 * time.Second, 3, true},
+		{"blocked attempt", 100 * time.Second, 3, false},
+		{"blocked attempts don't extend the ttl", 140 * time.Second, 1, true},
+	}
+
+	store := NewMemoryStore()
+
+	for _, tt := range tests {
+		now := start.Add(tt.after)
+
+		counter, counted, err := store.IncrementUnless("key", ttl, now, blocked)
+
+		if err != nil {
+			t.Fatalf("%s: IncrementUnless returned error: %v", tt.name, err)
+		}
+
+		if counter.Count != tt.wantCount || counted != tt.wantCounted {
+			t.Errorf("%s: IncrementUnless = (%d, %v), want (%d, %v)", tt.name, counter.Count, counted, tt.wantCount, tt.wantCounted)
+		}
+
+		if counted && !counter.LastAt.Equal(now) {
+			t.Errorf("%s: counter was last bumped at %v, want %v", tt.name, counter.LastAt, now)
+		}
+	}
+
+	if counter, counted, _ := store.IncrementUnless("other", ttl, start, nil); !counted || counter.Count != 1 {
+		t.Errorf("IncrementUnless without a check = (%d, %v), want (1, true)", counter.Count, counted)
+	}
+}
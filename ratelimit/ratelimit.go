@@ -0,0 +1,46 @@
+package ratelimit
+
+import "time"
+
+// Rule allows Limit requests in a burst, refilled evenly over Per
+type Rule struct {
+	Limit int
+	Per   time.Duration
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAt    time.Time
+	RetryAfter time.Duration
+}
+
+type Counter struct {
+	Count  int
+	LastAt time.Time
+}
+
+// Store keeps the limiter state, the in-memory store only works for a single instance
+type Store interface {
+	// Take removes a token from the key's bucket if there's one left
+	Take(key string, rule Rule, now time.Time) (Result, error)
+	// IncrementUnless bumps the key's counter unless blocked returns true for its current value, the check and the
+	// increment are one operation. It returns the counter and whether it was bumped, counters are forgotten ttl after
+	// their last increment
+	IncrementUnless(key string, ttl time.Duration, now time.Time, blocked func(Counter) bool) (Counter, bool, error)
+	Reset(key string) error
+}
+
+type Limiter struct {
+	store Store
+	rule  Rule
+}
+
+func NewLimiter(store Store, rule Rule) *Limiter {
+	return &Limiter{store, rule}
+}
+
+func (l *Limiter) Allow(key string) (Result, error) {
+	return l.store.Take(key, l.rule, time.Now())
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/muktiwbw/gdstorage"
+)
+
+type driveStore struct {
+	gds     gdstorage.GoogleDriveStorage
+	folders map[string]string
+	client  *http.Client
+}
+
+// NewDriveStore adapts gdstorage, folders maps the first segment of a key (users, campaigns) to a Drive folder ID.
+// Drive names files itself, Put returns the file ID as the key
+func NewDriveStore(gds gdstorage.GoogleDriveStorage, folders map[string]string) Store {
+	return &driveStore{gds, folders, &http.Client{Timeout: 60 * time.Second}}
+}
+
+func (s *driveStore) Put(key string, body io.Reader, contentType string) (string, error) {
+	cleaned, err := cleanKey(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	folderID, ok := s.folders[strings.SplitN(cleaned, "/", 2)[0]]
+
+	if !ok {
+		return "", fmt.Errorf("%w, no Drive folder for %s", ErrInvalidKey, cleaned)
+	}
+
+	fileHeader, err := newFileHeader(path.Base(cleaned), body, contentType)
+
+	if err != nil {
+		return "", err
+	}
+
+	fileID, err := s.gds.StoreFile(&gdstorage.StoreFileInput{Name: path.Base(cleaned), FileHeader: fileHeader}, folderID)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fileID, nil
+}
+
+func (s *driveStore) Delete(key string) error {
+	err := s.gds.DeleteFile(key)
+
+	if err != nil {
+		e := strings.Split(err.Error(), ", ")
+		if e[len(e)-1] == "notFound" {
+			return ErrNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *driveStore) URL(key string) string {
+	return gdstorage.GetURL(key)
+}
+
+func (s *driveStore) Open(key string) (io.ReadCloser, error) {
+	response, err := s.client.Get(gdstorage.GetURL(key))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+
+		return nil, ErrNotFound
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+
+		return nil, fmt.Errorf("Unable to download Drive file %s: %s", key, response.Status)
+	}
+
+	return response.Body, nil
+}
+
+// newFileHeader wraps the body in a multipart file header, the only input gdstorage accepts
+func newFileHeader(name string, body io.Reader, contentType string) (*multipart.FileHeader, error) {
+	var buffer bytes.Buffer
+
+	writer := multipart.NewWriter(&buffer)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, strings.ReplaceAll(name, `"`, "")))
+
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	part, err := writer.CreatePart(header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(part, body); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	form, err := multipart.NewReader(&buffer, writer.Boundary()).ReadForm(32 << 20)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := form.File["file"]
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("Unable to read %s", name)
+	}
+
+	return files[0], nil
+}
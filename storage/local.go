@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type localStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalStore keeps files under dir, they are expected to be served at baseURL (e.g. router.Static("/images", dir))
+func NewLocalStore(dir string, baseURL string) Store {
+	return &localStore{dir, strings.TrimSuffix(baseURL, "/")}
+}
+
+func (s *localStore) path(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(cleaned)), nil
+}
+
+func (s *localStore) Put(key string, body io.Reader, contentType string) (string, error) {
+	filePath, err := s.path(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file first so a failed upload never leaves half a file behind
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filePath), ".upload-*")
+
+	if err != nil {
+		return "", err
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := io.Copy(tmpFile, body); err != nil {
+		tmpFile.Close()
+
+		return "", err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmpFile.Name(), filePath); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+func (s *localStore) Delete(key string) error {
+	filePath, err := s.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filePath)
+
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (s *localStore) URL(key string) string {
+	return s.baseURL + "/" + strings.TrimPrefix(key, "/")
+}
+
+func (s *localStore) Open(key string) (io.ReadCloser, error) {
+	filePath, err := s.path(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "storage")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "images")
+	store := NewLocalStore(dir, "http://localhost:8080/images/")
+
+	if _, err := store.Put("users/ava.png", strings.NewReader("avatar"), "image/png"); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+
+	body, err := store.Open("users/ava.png")
+
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+
+	content, _ := ioutil.ReadAll(body)
+	body.Close()
+
+	if string(content) != "avatar" {
+		t.Errorf("Open returned %q, want %q", content, "avatar")
+	}
+
+	if got := store.URL("users/ava.png"); got != "http://localhost:8080/images/users/ava.png" {
+		t.Errorf("URL = %q", got)
+	}
+
+	// Nothing may be written next to the store's directory
+	for _, key := range []string{"../escaped.txt", "users/../../escaped.txt"} {
+		if _, err := store.Put(key, strings.NewReader("x"), ""); err != ErrInvalidKey {
+			t.Errorf("Put(%q) returned %v, want ErrInvalidKey", key, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "escaped.txt")); !os.IsNotExist(err) {
+		t.Error("a file was written outside the store's directory")
+	}
+
+	if err := store.Delete("users/ava.png"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+
+	if err := store.Delete("users/ava.png"); err != ErrNotFound {
+		t.Errorf("second Delete returned %v, want ErrNotFound", err)
+	}
+
+	if _, err := store.Open("users/ava.png"); err != ErrNotFound {
+		t.Errorf("Open after Delete returned %v, want ErrNotFound", err)
+	}
+}
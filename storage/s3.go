@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config works with AWS S3 and S3 compatible services such as MinIO, which need PathStyle
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PublicURL       string
+	PathStyle       bool
+}
+
+type s3Store struct {
+	config S3Config
+	client *http.Client
+}
+
+func NewS3Store(config S3Config) Store {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	config.PublicURL = strings.TrimSuffix(config.PublicURL, "/")
+
+	return &s3Store{config, &http.Client{Timeout: 60 * time.Second}}
+}
+
+func (s *s3Store) Put(key string, body io.Reader, contentType string) (string, error) {
+	payload, err := ioutil.ReadAll(body)
+
+	if err != nil {
+		return "", err
+	}
+
+	if contentType == "" {
+		contentType = http.DetectContentType(payload)
+	}
+
+	response, err := s.do(http.MethodPut, key, payload, contentType)
+
+	if err != nil {
+		return "", err
+	}
+
+	response.Body.Close()
+
+	return key, nil
+}
+
+// Delete succeeds for missing objects as well, S3 doesn't tell them apart
+func (s *s3Store) Delete(key string) error {
+	response, err := s.do(http.MethodDelete, key, nil, "")
+
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+
+	return nil
+}
+
+func (s *s3Store) URL(key string) string {
+	if s.config.PublicURL != "" {
+		return s.config.PublicURL + "/" + escapePath(strings.TrimPrefix(key, "/"))
+	}
+
+	objectURL, err := s.objectURL(key)
+
+	if err != nil {
+		return ""
+	}
+
+	return objectURL.String()
+}
+
+func (s *s3Store) Open(key string) (io.ReadCloser, error) {
+	response, err := s.do(http.MethodGet, key, nil, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+func (s *s3Store) objectURL(key string) (*url.URL, error) {
+	cleaned, err := cleanKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := url.Parse(s.config.Endpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	objectPath := "/" + cleaned
+
+	if s.config.PathStyle {
+		objectPath = "/" + s.config.Bucket + objectPath
+	} else {
+		endpoint.Host = s.config.Bucket + "." + endpoint.Host
+	}
+
+	endpoint.Path = objectPath
+	endpoint.RawPath = escapePath(objectPath)
+
+	return endpoint, nil
+}
+
+// do sends a signed request and turns error statuses into errors, the caller closes the body
+func (s *s3Store) do(method string, key string, payload []byte, contentType string) (*http.Response, error) {
+	objectURL, err := s.objectURL(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest(method, objectURL.String(), bytes.NewReader(payload))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	s.sign(request, hex.EncodeToString(payloadHash[:]), time.Now())
+
+	response, err := s.client.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		response.Body.Close()
+
+		return nil, ErrNotFound
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		response.Body.Close()
+
+		return nil, fmt.Errorf("S3 %s %s failed with %s: %s", method, key, response.Status, message)
+	}
+
+	return response, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header
+func (s *s3Store) sign(request *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + s.config.Region + "/s3/aws4_request"
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": request.URL.Host}
+
+	for name := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(request.Header.Get(name))
+	}
+
+	names := []string{}
+
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), amzDate[:8])
+	signingKey = hmacSHA256(signingKey, s.config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// escapePath encodes everything but unreserved characters and slashes, as S3 expects in the canonical request
+func escapePath(objectPath string) string {
+	var escaped strings.Builder
+
+	for _, b := range []byte(objectPath) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' || b == '/' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
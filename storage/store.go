@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"path"
+	"strings"
+)
+
+// Store keeps uploaded files. Keys are slash separated paths such as users/ava-1.png, Put returns the key to save
+// since some drivers (Google Drive) assign their own IDs
+type Store interface {
+	Put(key string, body io.Reader, contentType string) (string, error)
+	Delete(key string) error
+	URL(key string) string
+	Open(key string) (io.ReadCloser, error)
+}
+
+var ErrNotFound = errors.New("File not found")
+var ErrInvalidKey = errors.New("Invalid file key")
+
+var defaultStore Store
+
+// SetDefault sets the store used by URL, formatters turn stored keys into links with it
+func SetDefault(store Store) {
+	defaultStore = store
+}
+
+// URL returns the public URL of the key in the default store
+func URL(key string) string {
+	if key == "" || defaultStore == nil {
+		return key
+	}
+
+	return defaultStore.URL(key)
+}
+
+// PutFile stores an uploaded multipart file under the key
+func PutFile(store Store, key string, file *multipart.FileHeader) (string, error) {
+	body, err := file.Open()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer body.Close()
+
+	return store.Put(key, body, file.Header.Get("Content-Type"))
+}
+
+// cleanKey rejects keys that would escape the store's root
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))[1:]
+
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") {
+		return "", ErrInvalidKey
+	}
+
+	return cleaned, nil
+}
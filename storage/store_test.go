@@ -0,0 +1,43 @@
+package storage
+
+import "testing"
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{"users/ava-1.png", "users/ava-1.png", false},
+		{"/users/ava-1.png", "users/ava-1.png", false},
+		{"campaigns/1/cover.jpg", "campaigns/1/cover.jpg", false},
+		{"", "", true},
+		{"/", "", true},
+		{".", "", true},
+		{"..", "", true},
+		{"../secret", "", true},
+		{"users/../../secret", "", true},
+		{"users/../ava.png", "", true},
+		{"users/./ava.png", "", true},
+		{"users//ava.png", "", true},
+		{"users/", "", true},
+		{"..\\secret", "", true},
+		{"users\\ava.png", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := cleanKey(tt.key)
+
+		if tt.wantErr {
+			if err != ErrInvalidKey {
+				t.Errorf("cleanKey(%q) = (%q, %v), want ErrInvalidKey", tt.key, got, err)
+			}
+
+			continue
+		}
+
+		if err != nil || got != tt.want {
+			t.Errorf("cleanKey(%q) = (%q, %v), want %q", tt.key, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The ASCII secret "12345678901234567890" from RFC 4226 appendix D, base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		step int64
+		want string
+	}{
+		{0, "755224"},
+		{1, "287082"},
+		{2, "359152"},
+		{3, "969429"},
+		{4, "338314"},
+		{5, "254676"},
+		{6, "287922"},
+		{7, "162583"},
+		{8, "399871"},
+		{9, "520489"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, tt.step)
+
+		if err != nil {
+			t.Fatalf("Code(%d) returned error: %v", tt.step, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestCodeAcceptsLowercaseAndPaddedSecrets(t *testing.T) {
+	for _, secret := range []string{strings.ToLower(rfcSecret), rfcSecret + "===="} {
+		got, err := Code(secret, 1)
+
+		if err != nil {
+			t.Fatalf("Code(%q) returned error: %v", secret, err)
+		}
+
+		if got != "287082" {
+			t.Errorf("Code(%q) = %s, want 287082", secret, got)
+		}
+	}
+}
+
+func TestCodeRejectsInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code with an invalid secret returned no error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(100*Period+10, 0)
+	current := Step(now)
+
+	codeAt := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+
+		if err != nil {
+			t.Fatalf("Code(%d) returned error: %v", step, err)
+		}
+
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", codeAt(current), current, true},
+		{"previous step", codeAt(current - 1), current - 1, true},
+		{"next step", codeAt(current + 1), current + 1, true},
+		{"two steps behind", codeAt(current - 2), 0, false},
+		{"two steps ahead", codeAt(current + 2), 0, false},
+		{"surrounding whitespace", " " + codeAt(current) + "\n", current, true},
+		{"too short", codeAt(current)[:Digits-1], 0, false},
+		{"too long", codeAt(current) + "0", 0, false},
+		{"empty", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now)
+
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate(%q) = (%d, %v), want (%d, %v)", tt.code, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+
+	if err != nil {
+		t.Fatalf("GenerateSecret returned error: %v", err)
+	}
+
+	// 160 bits are 32 base32 characters without padding
+	if len(secret) != 32 {
+		t.Errorf("GenerateSecret returned %d characters, want 32", len(secret))
+	}
+
+	if _, err := Code(secret, 0); err != nil {
+		t.Errorf("Code with a generated secret returned error: %v", err)
+	}
+}